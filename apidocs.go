@@ -0,0 +1,19 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed doc/openapi.json
+var openAPISpec []byte
+
+func handleOpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPISpec)
+}
+
+func showAPIDocs(c *gin.Context) {
+	c.HTML(http.StatusOK, "api-docs.html", nil)
+}
@@ -0,0 +1,65 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// Error codes returned alongside the human-readable message, so API clients
+// can branch on them instead of matching strings. They are part of the API
+// and must not change once published.
+const (
+	codeInvalidRequest    = "INVALID_REQUEST"
+	codeInvalidJSON       = "INVALID_JSON"
+	codeInvalidType       = "INVALID_TYPE"
+	codeInvalidTag        = "INVALID_TAG"
+	codeInvalidQuery      = "INVALID_QUERY"
+	codeInvalidID         = "INVALID_ID"
+	codeInvalidContent    = "INVALID_CONTENT"
+	codeInvalidAssetName  = "INVALID_ASSET_NAME"
+	codeInvalidTheme      = "INVALID_THEME"
+	codeInvalidKey        = "INVALID_IDEMPOTENCY_KEY"
+	codeInvalidConfig     = "INVALID_CONFIG"
+	codeUnauthorized      = "UNAUTHORIZED"
+	codeForbidden         = "FORBIDDEN"
+	codeNotFound          = "NOT_FOUND"
+	codeTooLarge          = "TOO_LARGE"
+	codeUnsupportedMedia  = "UNSUPPORTED_MEDIA_TYPE"
+	codeURLNotAllowed     = "URL_NOT_ALLOWED"
+	codeFetchFailed       = "FETCH_FAILED"
+	codeRenderFailed      = "RENDER_FAILED"
+	codePDFUnavailable    = "PDF_UNAVAILABLE"
+	codeGitUnavailable    = "GIT_UNAVAILABLE"
+	codePageLimit         = "PAGE_LIMIT_REACHED"
+	codePagePinned        = "PAGE_PINNED"
+	codePageExists        = "PAGE_EXISTS"
+	codePageUnrendered    = "PAGE_UNRENDERED"
+	codePageGone          = "PAGE_GONE"
+	codeRebuildRunning    = "REBUILD_RUNNING"
+	codeReadOnly          = "READ_ONLY"
+	codeSetupRequired     = "SETUP_REQUIRED"
+	codeAuditDisabled     = "AUDIT_DISABLED"
+	codeRedirectsDisabled = "REDIRECTS_DISABLED"
+	codeBusy              = "SERVER_BUSY"
+	codeRateLimited       = "RATE_LIMITED"
+	codeConfirmRequired   = "CONFIRMATION_REQUIRED"
+	codeTimeout           = "TIMEOUT"
+	codeInternal          = "INTERNAL_ERROR"
+	codePanic             = "PANIC"
+)
+
+// APIError is the body of every JSON error response.
+type APIError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	// RequestID matches the access log line of the request.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// respondError writes a JSON error with its stable code.
+func respondError(c *gin.Context, status int, code, message string) {
+	respondJSON(c, status, APIError{Error: message, Code: code, RequestID: requestIDOf(c)})
+}
+
+// abortWithError is respondError for middleware, stopping the handler chain.
+func abortWithError(c *gin.Context, status int, code, message string) {
+	c.Abort()
+	respondJSON(c, status, APIError{Error: message, Code: code, RequestID: requestIDOf(c)})
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const assetsDirName = "assets"
+
+var assetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// assetContentTypes are the media types of common asset extensions, which
+// mime.TypeByExtension only knows from the system's mime.types, missing from
+// minimal images. Without them, SVG would be served as text and fonts as
+// application/octet-stream.
+var assetContentTypes = map[string]string{
+	".avif":  "image/avif",
+	".css":   "text/css; charset=utf-8",
+	".csv":   "text/csv; charset=utf-8",
+	".eot":   "application/vnd.ms-fontobject",
+	".gif":   "image/gif",
+	".ico":   "image/vnd.microsoft.icon",
+	".jpeg":  "image/jpeg",
+	".jpg":   "image/jpeg",
+	".js":    "text/javascript; charset=utf-8",
+	".json":  "application/json",
+	".mp3":   "audio/mpeg",
+	".mp4":   "video/mp4",
+	".ogg":   "audio/ogg",
+	".otf":   "font/otf",
+	".pdf":   "application/pdf",
+	".png":   "image/png",
+	".svg":   "image/svg+xml",
+	".ttf":   "font/ttf",
+	".txt":   "text/plain; charset=utf-8",
+	".wasm":  "application/wasm",
+	".webm":  "video/webm",
+	".webp":  "image/webp",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// assetContentType returns the media type an asset is served with, from its
+// extension only: content is never sniffed, so a file cannot pass for
+// another type.
+func assetContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if contentType, ok := assetContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// setAssetHeaders prepares the response for an asset: its content type,
+// PNG_ASSET_CACHE_MAX_AGE and PNG_ASSET_CSP, which replaces the page's policy.
+// The default policy keeps an SVG opened on its own from running scripts or
+// loading anything.
+func setAssetHeaders(c *gin.Context, name string) {
+	cfg := getConfig()
+	c.Header("Content-Type", assetContentType(name))
+	c.Header("X-Content-Type-Options", "nosniff")
+	if cfg.AssetCacheMaxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cfg.AssetCacheMaxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", "public, no-cache")
+	}
+	if cfg.AssetCSP != "" {
+		c.Header("Content-Security-Policy", cfg.AssetCSP)
+	} else {
+		c.Writer.Header().Del("Content-Security-Policy")
+	}
+}
+
+// isValidAssetName only accepts plain file names so assets cannot escape the
+// page's assets folder.
+func isValidAssetName(name string) bool {
+	return assetNamePattern.MatchString(name) && filepath.Base(name) == name
+}
+
+// handleUploadAsset stores a file in the page's assets folder so markdown can
+// reference it as assets/<name>.
+func handleUploadAsset(c *gin.Context) {
+	cfg := getConfig()
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	folderPath := filepath.Join("public", pageID)
+	if info, err := os.Stat(folderPath); err != nil || !info.IsDir() {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+
+	started := time.Now()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxAssetSize)
+	part, err := nextFilePart(c.Request)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondError(c, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("The file exceeds the maximum size of %d bytes", cfg.MaxAssetSize))
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("A file field is required (max %d bytes)", cfg.MaxAssetSize))
+		return
+	}
+	defer part.Close()
+	name := part.FileName()
+	if !isValidAssetName(name) {
+		respondError(c, http.StatusBadRequest, codeInvalidAssetName, "Invalid asset name: use letters, digits, '.', '-' and '_' only")
+		return
+	}
+
+	assetsPath := filepath.Join(folderPath, assetsDirName)
+	if err := os.MkdirAll(assetsPath, 0755); err != nil {
+		log.Printf("Error creating assets folder %s: %v", assetsPath, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to store asset")
+		return
+	}
+	assetPath := filepath.Join(assetsPath, name)
+	written, err := saveUploadedFile(part, assetPath, cfg.UploadBufferSize)
+	if errors.As(err, &tooLarge) {
+		respondError(c, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("The file exceeds the maximum size of %d bytes", cfg.MaxAssetSize))
+		return
+	}
+	if err != nil {
+		log.Printf("Error writing asset %s: %v", assetPath, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to store asset")
+		return
+	}
+
+	if cfg.OptimizeImages {
+		optimizeImage(assetPath)
+	}
+
+	respondJSON(c, http.StatusOK, AssetUpload{
+		URL:           pagePath(pageID) + assetsDirName + "/" + name,
+		BytesReceived: written,
+		DurationMS:    time.Since(started).Milliseconds(),
+	})
+}
+
+// AssetUpload is the response to a stored asset: how much was received and
+// how long receiving and storing it took.
+type AssetUpload struct {
+	URL           string `json:"url"`
+	BytesReceived int64  `json:"bytesReceived"`
+	DurationMS    int64  `json:"durationMs"`
+}
+
+// nextFilePart skips the fields of a multipart request up to its file field,
+// so the file can be read straight from the connection. Unlike c.FormFile,
+// nothing is buffered in memory or copied to a temporary file first.
+func nextFilePart(r *http.Request) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			return part, nil
+		}
+		// Drain the field so a huge one still counts against the size limit
+		if _, err := io.Copy(io.Discard, part); err != nil {
+			return nil, err
+		}
+		part.Close()
+	}
+}
+
+// Asset is a file attached to a page, as returned by the API.
+type Asset struct {
+	Name        string `json:"name"`
+	SizeBytes   int64  `json:"sizeBytes"`
+	ContentType string `json:"contentType"`
+	URL         string `json:"url"`
+}
+
+// pageAssetsPath returns the page's assets folder, answering the request
+// itself when the ID is invalid or the page does not exist.
+func pageAssetsPath(c *gin.Context) (string, bool) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return "", false
+	}
+	folderPath := filepath.Join("public", pageID)
+	if info, err := os.Stat(folderPath); err != nil || !info.IsDir() {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return "", false
+	}
+	return filepath.Join(folderPath, assetsDirName), true
+}
+
+// handleListAssets lists the files attached to a page, sorted by name.
+func handleListAssets(c *gin.Context) {
+	assetsPath, ok := pageAssetsPath(c)
+	if !ok {
+		return
+	}
+	entries, err := os.ReadDir(assetsPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Error reading assets folder %s: %v", assetsPath, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list assets")
+		return
+	}
+
+	assets := []Asset{}
+	for _, entry := range entries {
+		// Skip temporary upload files and anything the API could not have stored
+		if !entry.Type().IsRegular() || !isValidAssetName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		assets = append(assets, Asset{
+			Name:        entry.Name(),
+			SizeBytes:   info.Size(),
+			ContentType: assetContentType(entry.Name()),
+			URL:         pagePath(c.Param("id")) + assetsDirName + "/" + entry.Name(),
+		})
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Name < assets[j].Name })
+	respondJSON(c, http.StatusOK, assets)
+}
+
+// handleDeleteAsset removes a single file from a page's assets folder.
+func handleDeleteAsset(c *gin.Context) {
+	assetsPath, ok := pageAssetsPath(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	if !isValidAssetName(name) {
+		respondError(c, http.StatusBadRequest, codeInvalidAssetName, "Invalid asset name")
+		return
+	}
+	assetPath := filepath.Join(assetsPath, name)
+	if info, err := os.Lstat(assetPath); err != nil || !info.Mode().IsRegular() {
+		respondError(c, http.StatusNotFound, codeNotFound, "Asset not found")
+		return
+	}
+	if err := os.Remove(assetPath); err != nil {
+		log.Printf("Error deleting asset %s: %v", assetPath, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to delete asset")
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{"message": "Asset deleted successfully"})
+}
+
+// saveUploadedFile streams an uploaded file to path through a temporary file,
+// bufferSize bytes at a time, so a failed upload never leaves a truncated
+// asset behind and large files are never held in memory.
+func saveUploadedFile(src io.Reader, path string, bufferSize int) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	// Hide ReadFrom so io.CopyBuffer uses the configured buffer
+	written, err := io.CopyBuffer(struct{ io.Writer }{tmp}, src, make([]byte, bufferSize))
+	if err != nil {
+		tmp.Close()
+		return written, err
+	}
+	if err := tmp.Close(); err != nil {
+		return written, err
+	}
+	return written, os.Rename(tmp.Name(), path)
+}
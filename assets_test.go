@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartFile streams a multipart body with a file field of size bytes,
+// generated on the fly so the test itself holds none of it in memory.
+func multipartFile(size int64, name string) (io.Reader, string) {
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		_ = form.WriteField("note", "fields before the file are skipped")
+		part, err := form.CreateFormFile("file", name)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		chunk := make([]byte, 64<<10)
+		for i := range chunk {
+			chunk[i] = byte(i)
+		}
+		for remaining := size; remaining > 0; {
+			n := min(remaining, int64(len(chunk)))
+			if _, err := part.Write(chunk[:n]); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			remaining -= n
+		}
+		writer.CloseWithError(form.Close())
+	}()
+	return reader, form.FormDataContentType()
+}
+
+func TestUploadAssetStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Join("public", "page"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.POST("/api/pages/:id/assets", handleUploadAsset)
+
+	tests := []struct {
+		name       string
+		size       int64
+		maxSize    int64
+		wantStatus int
+		// maxAlloc bounds the memory allocated while handling the upload
+		maxAlloc uint64
+	}{
+		{name: "small file", size: 1 << 10, maxSize: 1 << 20, wantStatus: http.StatusOK, maxAlloc: 4 << 20},
+		{name: "large file is streamed", size: 128 << 20, maxSize: 256 << 20, wantStatus: http.StatusOK, maxAlloc: 16 << 20},
+		{name: "file over the limit", size: 8 << 20, maxSize: 1 << 20, wantStatus: http.StatusRequestEntityTooLarge, maxAlloc: 16 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, Config{MaxAssetSize: tt.maxSize, UploadBufferSize: 32 << 10})
+			assetName := fmt.Sprintf("file-%d.bin", tt.size)
+			body, contentType := multipartFile(tt.size, assetName)
+			req := httptest.NewRequest(http.MethodPost, "/api/pages/page/assets", body)
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			router.ServeHTTP(rec, req)
+			runtime.ReadMemStats(&after)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > tt.maxAlloc {
+				t.Errorf("allocated %d bytes for a %d byte upload, want at most %d", allocated, tt.size, tt.maxAlloc)
+			}
+			assetPath := filepath.Join("public", "page", assetsDirName, assetName)
+			if tt.wantStatus != http.StatusOK {
+				if _, err := os.Stat(assetPath); !os.IsNotExist(err) {
+					t.Errorf("rejected asset was stored: %v", err)
+				}
+				return
+			}
+			var upload AssetUpload
+			if err := json.Unmarshal(rec.Body.Bytes(), &upload); err != nil {
+				t.Fatal(err)
+			}
+			if upload.BytesReceived != tt.size || upload.URL != "/page/assets/"+assetName {
+				t.Errorf("response = %+v, want %d bytes at /page/assets/%s", upload, tt.size, assetName)
+			}
+			if info, err := os.Stat(assetPath); err != nil || info.Size() != tt.size {
+				t.Errorf("stored asset = %v, %v, want %d bytes", info, err, tt.size)
+			}
+		})
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join("public", "page", assetsDirName, ".upload-*")); len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
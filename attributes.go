@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// safeAttributes are the authored attributes kept when raw HTML is not
+// allowed: enough to style elements with a theme, but no inline styles or
+// behavior. Event handlers are never rendered by goldmark either way.
+var safeAttributes = map[string]bool{
+	"id":    true,
+	"class": true,
+	"title": true,
+	"lang":  true,
+	"dir":   true,
+	"role":  true,
+}
+
+// blockAttributeTransformer implements PNG_MARKDOWN_ATTRIBUTES for blocks
+// other than headings, which goldmark handles itself. A paragraph whose last
+// line is an attribute list such as {.warning #note} gets those attributes;
+// a paragraph made only of one applies it to the block before, such as a list
+// or a quote. Unless Unsafe, attributes outside safeAttributes are dropped,
+// on headings too.
+type blockAttributeTransformer struct {
+	Unsafe bool
+}
+
+func (t blockAttributeTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var paragraphs []*ast.Paragraph
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			t.filter(n)
+			return ast.WalkSkipChildren, nil
+		case *ast.Paragraph:
+			paragraphs = append(paragraphs, n)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, paragraph := range paragraphs {
+		lines := paragraph.Lines()
+		if lines.Len() == 0 {
+			continue
+		}
+		last := lines.At(lines.Len() - 1)
+		attrs, ok := parseAttributeLine(last.Value(source))
+		if !ok {
+			continue
+		}
+		if lines.Len() == 1 {
+			target := paragraph.PreviousSibling()
+			if target == nil || target.Type() != ast.TypeBlock {
+				continue
+			}
+			t.apply(target, attrs, pc)
+			paragraph.Parent().RemoveChild(paragraph.Parent(), paragraph)
+			continue
+		}
+		if !removeLastLine(paragraph, last, source) {
+			continue
+		}
+		lines.SetSliced(0, lines.Len()-1)
+		t.apply(paragraph, attrs, pc)
+	}
+}
+
+// apply sets attrs on node, keeping the IDs given unique among the heading
+// IDs of the page.
+func (t blockAttributeTransformer) apply(node ast.Node, attrs parser.Attributes, pc parser.Context) {
+	for _, attr := range attrs {
+		if !t.Unsafe && !safeAttributes[string(attr.Name)] {
+			continue
+		}
+		if bytes.Equal(attr.Name, []byte("id")) {
+			if id, ok := attr.Value.([]byte); ok {
+				pc.IDs().Put(id)
+			}
+		}
+		node.SetAttribute(attr.Name, attr.Value)
+	}
+}
+
+// filter drops the attributes of node outside safeAttributes, unless Unsafe.
+func (t blockAttributeTransformer) filter(node ast.Node) {
+	if t.Unsafe {
+		return
+	}
+	attrs := node.Attributes()
+	node.RemoveAttributes()
+	for _, attr := range attrs {
+		if safeAttributes[string(attr.Name)] {
+			node.SetAttribute(attr.Name, attr.Value)
+		}
+	}
+}
+
+// parseAttributeLine parses a line made only of an attribute list.
+func parseAttributeLine(line []byte) (parser.Attributes, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) < 2 || line[0] != '{' || line[len(line)-1] != '}' {
+		return nil, false
+	}
+	reader := text.NewReader(line)
+	attrs, ok := parser.ParseAttributes(reader)
+	if !ok {
+		return nil, false
+	}
+	reader.SkipSpaces()
+	if reader.Peek() != text.EOF {
+		return nil, false
+	}
+	return attrs, true
+}
+
+// removeLastLine drops the inline text of a paragraph's last line, reporting
+// false when that line holds anything but plain text.
+func removeLastLine(paragraph *ast.Paragraph, last text.Segment, source []byte) bool {
+	value := last.Value(source)
+	lineStart := last.Start + len(value) - len(bytes.TrimLeft(value, " \t"))
+	var lineNodes []ast.Node
+	for child := paragraph.LastChild(); ; child = child.PreviousSibling() {
+		textNode, ok := child.(*ast.Text)
+		if !ok {
+			return false
+		}
+		lineNodes = append(lineNodes, child)
+		if textNode.Segment.Start <= lineStart {
+			break
+		}
+	}
+	for _, node := range lineNodes {
+		paragraph.RemoveChild(paragraph, node)
+	}
+	if previous, ok := paragraph.LastChild().(*ast.Text); ok {
+		previous.SetSoftLineBreak(false)
+		previous.SetHardLineBreak(false)
+	}
+	return true
+}
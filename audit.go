@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditActionUpload  = "upload"
+	auditActionEdit    = "edit"
+	auditActionDelete  = "delete"
+	auditActionPrune   = "prune"
+	auditActionRebuild = "rebuild"
+	auditActionRestore = "restore"
+	auditActionMove    = "move"
+
+	defaultAuditTail = 100
+	maxAuditTail     = 1000
+)
+
+// AuditEntry is one line of the JSONL audit log.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	PageID string    `json:"pageId"`
+	// From is the previous ID of a moved page.
+	From string `json:"from,omitempty"`
+	// User is empty when authentication is disabled, see AuthDisabled.
+	User         string `json:"user,omitempty"`
+	AuthDisabled bool   `json:"authDisabled,omitempty"`
+	IP           string `json:"ip"`
+}
+
+var auditMu sync.Mutex
+
+// recordAudit appends an event to PNG_AUDIT_LOG, if configured. Failures are
+// logged but never fail the request that triggered them.
+func recordAudit(c *gin.Context, action, pageID string) {
+	writeAudit(c, AuditEntry{Action: action, PageID: pageID})
+}
+
+// recordMoveAudit records a page moving from one ID to another.
+func recordMoveAudit(c *gin.Context, from, to string) {
+	writeAudit(c, AuditEntry{Action: auditActionMove, PageID: to, From: from})
+}
+
+// writeAudit completes entry with the time and client and appends it to
+// PNG_AUDIT_LOG, if configured.
+func writeAudit(c *gin.Context, entry AuditEntry) {
+	cfg := getConfig()
+	if cfg.AuditLog == "" {
+		return
+	}
+	entry.Time = time.Now().UTC()
+	entry.IP = c.ClientIP()
+	if authDisabled() {
+		entry.AuthDisabled = true
+	} else {
+		entry.User = cfg.Username
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding audit entry: %v", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	rotateAuditLog()
+	file, err := os.OpenFile(cfg.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Error opening audit log: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+// rotateAuditLog moves the log to <path>.1 once it exceeds
+// PNG_AUDIT_LOG_MAX_SIZE, replacing any previous backup.
+func rotateAuditLog() {
+	cfg := getConfig()
+	if cfg.AuditLogMaxSize <= 0 {
+		return
+	}
+	info, err := os.Stat(cfg.AuditLog)
+	if err != nil || info.Size() < cfg.AuditLogMaxSize {
+		return
+	}
+	if err := os.Rename(cfg.AuditLog, cfg.AuditLog+".1"); err != nil {
+		log.Printf("Error rotating audit log: %v", err)
+	}
+}
+
+// handleListAudit returns the most recent audit entries, newest last.
+func handleListAudit(c *gin.Context) {
+	cfg := getConfig()
+	if cfg.AuditLog == "" {
+		respondError(c, http.StatusNotFound, codeAuditDisabled, "Audit log is not enabled")
+		return
+	}
+	limit := defaultAuditTail
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAuditTail {
+			respondError(c, http.StatusBadRequest, codeInvalidQuery, "limit must be between 1 and "+strconv.Itoa(maxAuditTail))
+			return
+		}
+		limit = parsed
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	file, err := os.Open(cfg.AuditLog)
+	if errors.Is(err, os.ErrNotExist) {
+		respondJSON(c, http.StatusOK, []AuditEntry{})
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening audit log: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not read audit log")
+		return
+	}
+	defer file.Close()
+
+	entries := make([]AuditEntry, 0, limit)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if len(entries) == limit {
+			entries = entries[1:]
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading audit log: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not read audit log")
+		return
+	}
+	respondJSON(c, http.StatusOK, entries)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	stdhtml "html"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	backlinksStart = "<!--backlinks-->"
+	backlinksEnd   = "<!--/backlinks-->"
+)
+
+var (
+	hrefPattern             = regexp.MustCompile(`(?i)\shref\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	backlinksSectionPattern = regexp.MustCompile(`(?s)` + regexp.QuoteMeta(backlinksStart) + `.*?` + regexp.QuoteMeta(backlinksEnd))
+	pageFooterPattern       = regexp.MustCompile(`(?s)<footer class="page-footer">.*?</footer>`)
+)
+
+// linkGraph records which pages link to which, so a page's backlinks are
+// known without reading every page. It is built at startup from meta.json
+// and kept up to date as pages are written and deleted.
+type linkGraph struct {
+	mu       sync.RWMutex
+	outbound map[string][]string
+	inbound  map[string]map[string]bool
+}
+
+var pageLinks = &linkGraph{outbound: map[string][]string{}, inbound: map[string]map[string]bool{}}
+
+// set replaces the outbound links of a page and returns the pages whose
+// backlinks changed as a result.
+func (g *linkGraph) set(pageID string, links []string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	previous := g.outbound[pageID]
+	for _, target := range previous {
+		delete(g.inbound[target], pageID)
+	}
+	for _, target := range links {
+		if g.inbound[target] == nil {
+			g.inbound[target] = map[string]bool{}
+		}
+		g.inbound[target][pageID] = true
+	}
+	if len(links) == 0 {
+		delete(g.outbound, pageID)
+	} else {
+		g.outbound[pageID] = links
+	}
+
+	var changed []string
+	for _, target := range previous {
+		if !slices.Contains(links, target) {
+			changed = append(changed, target)
+		}
+	}
+	for _, target := range links {
+		if !slices.Contains(previous, target) {
+			changed = append(changed, target)
+		}
+	}
+	return changed
+}
+
+// remove forgets the links of a deleted page. Links pointing to it are kept,
+// in case a page is published again under the same ID.
+func (g *linkGraph) remove(pageID string) []string {
+	return g.set(pageID, nil)
+}
+
+// backlinks returns the IDs of the pages linking to pageID, sorted.
+func (g *linkGraph) backlinks(pageID string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	sources := make([]string, 0, len(g.inbound[pageID]))
+	for source := range g.inbound[pageID] {
+		sources = append(sources, source)
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+// load builds the graph from the links stored in every page's metadata.
+func (g *linkGraph) load() error {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !isPageDir(entry) {
+			continue
+		}
+		meta, err := readPageMeta(entry.Name())
+		if err != nil {
+			continue
+		}
+		g.set(entry.Name(), meta.Links)
+	}
+	return nil
+}
+
+// extractPageLinks returns the other pages of this site linked from a
+// rendered page: hrefs such as /<id>/, with or without PNG_BASE_URL and
+// PNG_PATH_PREFIX. The backlinks section and the page footer are not the
+// page's own content and are skipped.
+func extractPageLinks(pageID, renderedHTML string) []string {
+	cfg := getConfig()
+	renderedHTML = backlinksSectionPattern.ReplaceAllString(renderedHTML, "")
+	renderedHTML = pageFooterPattern.ReplaceAllString(renderedHTML, "")
+	var links []string
+	for _, match := range hrefPattern.FindAllStringSubmatch(renderedHTML, -1) {
+		href := stdhtml.UnescapeString(match[1] + match[2])
+		if cfg.BaseURL != "" {
+			href = strings.TrimPrefix(href, strings.TrimSuffix(cfg.BaseURL, "/"))
+		}
+		path, ok := strings.CutPrefix(href, cfg.PathPrefix+"/")
+		if !ok {
+			continue
+		}
+		target, _, _ := strings.Cut(path, "/")
+		target, _, _ = strings.Cut(target, "?")
+		target, _, _ = strings.Cut(target, "#")
+		if target == pageID || !isValidPageID(target) || slices.Contains(links, target) {
+			continue
+		}
+		links = append(links, target)
+	}
+	slices.Sort(links)
+	return links
+}
+
+// backlinksSection lists the pages linking to pageID, between markers so it
+// can be refreshed in place. It is empty unless PNG_BACKLINKS_FOOTER is on.
+func backlinksSection(pageID string) string {
+	if !getConfig().BacklinksFooter {
+		return ""
+	}
+	var items []string
+	for _, source := range pageLinks.backlinks(pageID) {
+		meta, err := readPageMeta(source)
+		if err != nil {
+			continue
+		}
+		title := cmp.Or(meta.Title, source)
+		items = append(items, fmt.Sprintf(`<li><a href="%s">%s</a></li>`, stdhtml.EscapeString(pagePath(source)), stdhtml.EscapeString(title)))
+	}
+	if len(items) == 0 {
+		return backlinksStart + backlinksEnd
+	}
+	return backlinksStart + `<nav class="backlinks"><h2>Linked from</h2><ul>` + strings.Join(items, "") + `</ul></nav>` + backlinksEnd
+}
+
+// updatePageLinks records the links of a page that was just written and
+// refreshes the backlinks sections of the pages it started or stopped
+// linking to. The refresh runs in the background, as it locks those pages.
+func updatePageLinks(pageID string, links []string) {
+	changed := pageLinks.set(pageID, links)
+	if len(changed) > 0 && getConfig().BacklinksFooter {
+		go refreshBacklinks(changed)
+	}
+}
+
+// removePageLinks forgets the links of a deleted page, refreshing the pages
+// it linked to.
+func removePageLinks(pageID string) {
+	changed := pageLinks.remove(pageID)
+	if len(changed) > 0 && getConfig().BacklinksFooter {
+		go refreshBacklinks(changed)
+	}
+}
+
+// refreshBacklinks rewrites the backlinks section of already rendered pages.
+// Pages rendered without one, such as raw HTML pages, are left alone.
+func refreshBacklinks(pageIDs []string) {
+	for _, pageID := range pageIDs {
+		if err := refreshPageBacklinks(pageID); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error refreshing backlinks of %s: %v", pageID, err)
+		}
+	}
+}
+
+func refreshPageBacklinks(pageID string) error {
+	unlock := lockPageMeta(pageID)
+	defer unlock()
+	indexPath := filepath.Join("public", pageID, "index.html")
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return err
+	}
+	section := backlinksSection(pageID)
+	if section == "" || !backlinksSectionPattern.Match(data) {
+		return nil
+	}
+	updated := backlinksSectionPattern.ReplaceAllLiteral(data, []byte(section))
+	if err := writeFileAtomic(indexPath, updated, 0644); err != nil {
+		return err
+	}
+	pageCache.remove(pageID)
+	// The content changed, and so must its immutable URL
+	meta, err := readPageMeta(pageID)
+	if err != nil || meta.RenderHash == "" {
+		return err
+	}
+	if meta.RenderHash, err = hashRenderedPage(filepath.Join("public", pageID), meta.Files); err != nil {
+		return err
+	}
+	if err := writePageMeta(pageID, meta); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Backlink is a page linking to another, as returned by the API.
+type Backlink struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
+}
+
+func handleListBacklinks(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	if info, err := os.Stat(filepath.Join("public", pageID)); err != nil || !info.IsDir() {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+	backlinks := []Backlink{}
+	for _, source := range pageLinks.backlinks(pageID) {
+		meta, err := readPageMeta(source)
+		if err != nil {
+			continue
+		}
+		backlinks = append(backlinks, Backlink{ID: source, Title: meta.Title, URL: pagePath(source)})
+	}
+	respondJSON(c, http.StatusOK, backlinks)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report fields by their JSON names rather than the Go struct field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// respondBindError answers a failed bindJSON with a 400 carrying a
+// field-specific message and the matching error code.
+func respondBindError(c *gin.Context, err error) {
+	respondError(c, http.StatusBadRequest, bindErrorCode(err), bindErrorMessage(err))
+}
+
+func bindErrorCode(err error) string {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, fieldErr := range validationErrs {
+			if fieldErr.Field() == "type" && fieldErr.Tag() == "oneof" {
+				return codeInvalidType
+			}
+		}
+		return codeInvalidRequest
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooDeep jsonTooDeepError
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &tooDeep) {
+		return codeInvalidJSON
+	}
+	return codeInvalidRequest
+}
+
+// bindErrorMessage turns the errors returned by bindJSON into messages
+// naming the offending field, so API clients can fix their request.
+func bindErrorMessage(err error) string {
+	var validationErrs validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		messages := make([]string, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			messages = append(messages, fieldErrorMessage(fieldErr))
+		}
+		return strings.Join(messages, "; ")
+	case errors.Is(err, io.EOF):
+		return "Request body is empty, expected a JSON object"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "Request body is not valid JSON: unexpected end of input"
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("Request body is not valid JSON: %s at offset %d", syntaxErr.Error(), syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Sprintf("Request body must be a JSON object, not %s", typeErr.Value)
+		}
+		return fmt.Sprintf("%s must be %s, not %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+	default:
+		if field, ok := unknownJSONField(err); ok {
+			return fmt.Sprintf("Unknown field %s", field)
+		}
+		return err.Error()
+	}
+}
+
+func fieldErrorMessage(fieldErr validator.FieldError) string {
+	field := fieldErr.Field()
+	switch fieldErr.Tag() {
+	case "required":
+		return field + " is required"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.ReplaceAll(fieldErr.Param(), " ", ", "))
+	case "min", "max":
+		bound := "at least"
+		if fieldErr.Tag() == "max" {
+			bound = "at most"
+		}
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be %s %s characters", field, bound, fieldErr.Param())
+		}
+		return fmt.Sprintf("%s must be %s %s", field, bound, fieldErr.Param())
+	case "bcp47_language_tag":
+		return field + " must be a language tag such as en or pt-BR"
+	default:
+		return fmt.Sprintf("%s is invalid (%s)", field, fieldErr.Tag())
+	}
+}
+
+// jsonTypeName describes a Go type the way it appears in a JSON document.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	default:
+		return "an object"
+	}
+}
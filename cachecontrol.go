@@ -0,0 +1,28 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+const (
+	// cacheControlAPI keeps API responses, page listings and sources among
+	// them, out of browser and proxy caches.
+	cacheControlAPI = "no-store"
+	// cacheControlRevalidate lets the client keep a response it must check
+	// with the server, through its ETag or Last-Modified, before reusing it.
+	// Shared caches still may not store it.
+	cacheControlRevalidate = "private, no-cache"
+	// cacheControlImmutable is for responses whose URL changes along with
+	// their content, which any cache may keep for a year.
+	cacheControlImmutable = "public, max-age=31536000, immutable"
+)
+
+// apiCacheControl marks every API response as not cacheable, so listings and
+// sources fetched with credentials are never served from a shared proxy to
+// someone else. Handlers supporting conditional requests relax it to
+// cacheControlRevalidate. Published pages are served outside the API and
+// keep their own caching.
+func apiCacheControl() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", cacheControlAPI)
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadRetryAfter is the Retry-After hint, in seconds, sent when all upload
+// slots stayed busy for PNG_UPLOAD_QUEUE_TIMEOUT.
+const uploadRetryAfter = 5
+
+// uploadSlots bounds how many uploads and re-renders run at once. The slots
+// channel is rebuilt when PNG_MAX_CONCURRENT_UPLOADS changes on reload;
+// requests holding a slot of the old channel release it there.
+type uploadSlots struct {
+	mu    sync.Mutex
+	size  int
+	slots chan struct{}
+}
+
+var uploadLimiter uploadSlots
+
+// channel returns the slots for the given limit, nil when unlimited.
+func (u *uploadSlots) channel(size int) chan struct{} {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if size != u.size {
+		u.size = size
+		u.slots = nil
+		if size > 0 {
+			u.slots = make(chan struct{}, size)
+		}
+	}
+	return u.slots
+}
+
+// limitUploads holds requests until an upload slot is free, rejecting them
+// with a 503 when none frees up within PNG_UPLOAD_QUEUE_TIMEOUT.
+func limitUploads() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := getConfig()
+		slots := uploadLimiter.channel(cfg.MaxConcurrentUploads)
+		if slots == nil {
+			c.Next()
+			return
+		}
+
+		timer := time.NewTimer(cfg.UploadQueueTimeout)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+		case <-timer.C:
+			c.Header("Retry-After", strconv.Itoa(uploadRetryAfter))
+			abortWithError(c, http.StatusServiceUnavailable, codeBusy, "Too many uploads in progress, please retry later")
+			return
+		case <-c.Request.Context().Done():
+			abortWithError(c, http.StatusServiceUnavailable, codeTimeout, "Request timed out")
+			return
+		}
+		defer func() { <-slots }()
+		c.Next()
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// confirmPublishHeader must be sent as true with uploads when
+// PNG_REQUIRE_CONFIRM is on.
+const confirmPublishHeader = "X-Confirm-Publish"
+
+// requireConfirm implements PNG_REQUIRE_CONFIRM: requests publishing new
+// pages are rejected with 428 unless they carry X-Confirm-Publish: true, so
+// scripts cannot publish by accident. The dashboard always sends it, clicking
+// its publish button being the confirmation.
+func requireConfirm() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !getConfig().RequireConfirm {
+			c.Next()
+			return
+		}
+		if confirmed, _ := strconv.ParseBool(c.GetHeader(confirmPublishHeader)); !confirmed {
+			abortWithError(c, http.StatusPreconditionRequired, codeConfirmRequired, "Publishing requires the "+confirmPublishHeader+": true header")
+			return
+		}
+		c.Next()
+	}
+}
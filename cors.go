@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	corsAllowMethods  = "GET, HEAD, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders  = "Authorization, Content-Type, Idempotency-Key, Range, X-Confirm-Publish"
+	corsExposeHeaders = "Content-Disposition, ETag, Idempotent-Replayed, Retry-After"
+	corsMaxAge        = "600"
+)
+
+// parseCORSOrigins normalizes PNG_CORS_ORIGINS entries to the form browsers
+// send in the Origin header: a scheme and host, with the port if any.
+func parseCORSOrigins(entries []string) ([]string, error) {
+	var origins []string
+	for _, entry := range entries {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), "/")
+		if entry == "" {
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+			return nil, fmt.Errorf("%q is not an origin such as https://example.com", entry)
+		}
+		origins = append(origins, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	return origins, nil
+}
+
+// corsHeaders lets the browsers of PNG_CORS_ORIGINS call the API from
+// another site, cookies included. Other origins get no CORS headers, so
+// browsers keep them to same-origin requests.
+func corsHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !slices.Contains(getConfig().corsOrigins, strings.ToLower(origin)) {
+			c.Next()
+			return
+		}
+		c.Header("Vary", "Origin")
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Credentials", "true")
+		exposed := corsExposeHeaders
+		if header := getConfig().RequestIDHeader; header != "" {
+			exposed += ", " + header
+		}
+		c.Header("Access-Control-Expose-Headers", exposed)
+		c.Next()
+	}
+}
+
+// handlePreflight answers the OPTIONS requests browsers send before
+// cross-origin calls. The allow headers are only added for PNG_CORS_ORIGINS,
+// by corsHeaders.
+func handlePreflight(c *gin.Context) {
+	if c.Writer.Header().Get("Access-Control-Allow-Origin") != "" {
+		c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+		c.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+		c.Header("Access-Control-Max-Age", corsMaxAge)
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultPageCSP allows the inline <style> of rendered pages and media
+	// from anywhere, but only scripts served by the instance itself.
+	defaultPageCSP = "default-src 'self'; img-src * data:; media-src *; frame-src *; font-src * data:; " +
+		"style-src 'self' 'unsafe-inline'; script-src 'self'; object-src 'none'; base-uri 'none'"
+	// defaultAssetCSP applies to page assets, so an SVG opened directly rather
+	// than through an <img> can neither run scripts nor load anything but
+	// inline styles and data URIs.
+	defaultAssetCSP = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; font-src data:; sandbox"
+	// defaultDashboardCSP covers the CDNs the panel's templates load and
+	// forbids framing it. Their inline scripts are allowed by hash.
+	defaultDashboardCSP = "default-src 'self'; script-src 'self' https://cdn.tailwindcss.com; " +
+		"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; font-src https://fonts.gstatic.com; " +
+		"img-src 'self' data:; connect-src 'self'; object-src 'none'; base-uri 'none'; frame-ancestors 'none'"
+)
+
+// scriptHash returns the CSP source allowing an inline script by its hash.
+func scriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+var taskListScriptHash = scriptHash(taskListJS)
+
+var (
+	inlineScriptPattern = regexp.MustCompile(`(?is)<script\b([^>]*)>(.*?)</script\s*>`)
+	scriptSrcPattern    = regexp.MustCompile(`(?i)(^|\s)src\s*=`)
+)
+
+// inlineScriptHashes returns the CSP sources allowing the inline scripts of
+// trusted snippets, such as the custom head, as they are written. Scripts
+// loaded with src are left to the policy's own sources.
+func inlineScriptHashes(snippets ...string) []string {
+	var hashes []string
+	for _, snippet := range snippets {
+		for _, match := range inlineScriptPattern.FindAllStringSubmatch(snippet, -1) {
+			if scriptSrcPattern.MatchString(match[1]) {
+				continue
+			}
+			if hash := scriptHash(match[2]); !slices.Contains(hashes, hash) {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes
+}
+
+// withScriptSources adds sources to the policy's script-src directive. A
+// policy without one restricts scripts through default-src, so a script-src
+// copying its sources is added instead; without either, scripts are not
+// restricted and the policy is returned as is. So is a policy allowing
+// 'unsafe-inline' scripts, which browsers would stop honoring once a hash is
+// listed.
+func withScriptSources(policy string, sources ...string) string {
+	if len(sources) == 0 {
+		return policy
+	}
+	var directives []string
+	var defaultSources []string
+	scriptSrc := -1
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "script-src":
+			scriptSrc = len(directives)
+			if slices.Contains(fields[1:], "'unsafe-inline'") {
+				return policy
+			}
+		case "default-src":
+			defaultSources = fields[1:]
+		}
+		directives = append(directives, strings.Join(fields, " "))
+	}
+	switch {
+	case scriptSrc < 0 && slices.Contains(defaultSources, "'unsafe-inline'"):
+		return policy
+	case scriptSrc >= 0:
+		directives[scriptSrc] += " " + strings.Join(sources, " ")
+	case defaultSources != nil:
+		directives = append(directives, "script-src "+strings.Join(append(defaultSources, sources...), " "))
+	default:
+		return policy
+	}
+	return strings.Join(directives, "; ")
+}
+
+// pageCSP returns the Content-Security-Policy for a page. Markdown and text
+// pages get PNG_PAGE_CSP plus the hashes of the scripts enabled features
+// inject and of the inline scripts of its custom head and footers, recorded
+// when it was rendered; raw HTML pages get PNG_HTML_PAGE_CSP, empty by
+// default, as they are complete documents written by the author.
+func pageCSP(meta PageMeta) string {
+	cfg := getConfig()
+	if meta.Type == "html" || meta.Type == "" {
+		return cfg.HTMLPageCSP
+	}
+	sources := slices.Clone(meta.ScriptHashes)
+	if cfg.InteractiveTasks {
+		sources = append(sources, taskListScriptHash)
+	}
+	return withScriptSources(cfg.PageCSP, sources...)
+}
+
+// pageSecurityHeaders sets the page CSP on requests for a published page or
+// its files, ahead of the cache and the file server. Unlisted and draft pages
+// are also kept out of search engines with X-Robots-Tag, rather than listed
+// in the public robots.txt.
+func pageSecurityHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pageID, _, _ := strings.Cut(strings.TrimPrefix(c.Request.URL.Path, "/"), "/")
+		if (c.Request.Method == "GET" || c.Request.Method == "HEAD") && isValidPageID(pageID) {
+			if meta, err := readPageMeta(pageID); err == nil {
+				if policy := pageCSP(meta); policy != "" {
+					c.Header("Content-Security-Policy", policy)
+				}
+				if pageVisibility(meta) != visibilityPublic {
+					c.Header("X-Robots-Tag", "noindex")
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// dashboardSecurityHeaders sets PNG_DASHBOARD_CSP on the panel and login
+// pages, with the hashes of the templates' inline scripts.
+func dashboardSecurityHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy := getConfig().DashboardCSP; policy != "" {
+			c.Header("Content-Security-Policy", withScriptSources(policy, htmlTemplates.inlineScripts()...))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireScriptsAllowed checks that every inline script of document is
+// allowed by the script-src of policy.
+func requireScriptsAllowed(t *testing.T, document, policy string, wantScripts int) {
+	t.Helper()
+	scripts := 0
+	for _, match := range inlineScriptPattern.FindAllStringSubmatch(document, -1) {
+		if scriptSrcPattern.MatchString(match[1]) {
+			continue
+		}
+		scripts++
+		if hash := scriptHash(match[2]); !strings.Contains(policy, hash) {
+			t.Errorf("script %q is not allowed by %s (%s missing)", match[2], policy, hash)
+		}
+	}
+	if scripts != wantScripts {
+		t.Errorf("found %d inline scripts, want %d", scripts, wantScripts)
+	}
+}
+
+func TestWithScriptSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{name: "script-src", policy: "default-src 'self'; script-src 'self'", want: "default-src 'self'; script-src 'self' 'sha256-x'"},
+		{name: "default-src only", policy: "default-src 'self'; img-src *", want: "default-src 'self'; img-src *; script-src 'self' 'sha256-x'"},
+		{name: "no script restriction", policy: "img-src *", want: "img-src *"},
+		{name: "unsafe-inline scripts", policy: "script-src 'self' 'unsafe-inline'", want: "script-src 'self' 'unsafe-inline'"},
+		{name: "unsafe-inline default", policy: "default-src 'self' 'unsafe-inline'", want: "default-src 'self' 'unsafe-inline'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withScriptSources(tt.policy, "'sha256-x'"); got != tt.want {
+				t.Errorf("withScriptSources = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageSnippetScriptsAllowed(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("PNG_CUSTOM_HEAD", "<script>\n  // analytics for {{siteTitle}}\n  window.site = 1;\n</script><script src=\"/x.js\"></script>")
+	t.Setenv("PNG_PAGE_FOOTER", "<script>window.footer = 1;</script>")
+	t.Setenv("PNG_MARKDOWN_UNSAFE_ALLOWED", "true")
+	allowRaw := true
+	req := UploadRequest{
+		Type:         "markdown",
+		Content:      "# Hi\n\n- [ ] task\n",
+		AllowRawHTML: &allowRaw,
+		HeadHTML:     "<script>window.head = 1;</script>",
+		FooterHTML:   "<script>\n/* page */ window.pageFooter = 1;\n</script>",
+	}
+	for _, minify := range []bool{false, true} {
+		cfg := defaultTestConfig(t)
+		cfg.OGImage, cfg.InteractiveTasks, cfg.Minify = false, true, minify
+		setTestConfig(t, cfg)
+		meta := PageMeta{}
+		page, err := renderPage(context.Background(), "page", req, &meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(meta.ScriptHashes) != 4 {
+			t.Errorf("minify %v: recorded %d script hashes, want 4: %v", minify, len(meta.ScriptHashes), meta.ScriptHashes)
+		}
+		requireScriptsAllowed(t, page.html, pageCSP(meta), 5)
+	}
+}
+
+func TestDashboardScriptsAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setTestConfig(t, Config{DashboardCSP: defaultDashboardCSP, PathPrefix: "/blog"})
+	if err := htmlTemplates.load(""); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.HTMLRender = htmlTemplates
+	router.GET("/", dashboardSecurityHeaders(), func(c *gin.Context) { c.HTML(http.StatusOK, "index.html", nil) })
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	policy := rec.Header().Get("Content-Security-Policy")
+	if strings.Contains(policy, "'unsafe-inline' https://cdn") || strings.Contains(policy, "script-src 'self' 'unsafe-inline'") {
+		t.Errorf("dashboard policy allows any inline script: %s", policy)
+	}
+	requireScriptsAllowed(t, rec.Body.String(), policy, 1)
+	if !strings.Contains(rec.Body.String(), `data-base-path="/blog"`) {
+		t.Error("panel script does not get the path prefix")
+	}
+}
+
+func TestTemplateScriptWithActionIsNotHashed(t *testing.T) {
+	hashes := templateScriptHashes("login.html", `<script>const a = {{ basePath }};</script><script>const b = 1;</script>`)
+	if len(hashes) != 1 || hashes[0] != scriptHash("const b = 1;") {
+		t.Errorf("hashes = %v, want only the static script", hashes)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// headBreakoutPattern matches tags that would close the <head> early and move
+// the rest of the template into the body.
+var headBreakoutPattern = regexp.MustCompile(`(?i)</?(head|body|html)[\s>/]`)
+
+// readCustomHead loads and checks the operator-provided snippet from
+// PNG_CUSTOM_HEAD or PNG_CUSTOM_HEAD_FILE, inserted verbatim into the <head>
+// of rendered markdown pages. It comes from the deployment's configuration
+// only, never from uploaded content.
+func readCustomHead(cfg Config) (string, error) {
+	snippet := cfg.CustomHead
+	if cfg.CustomHeadFile != "" {
+		content, err := os.ReadFile(cfg.CustomHeadFile)
+		if err != nil {
+			return "", fmt.Errorf("PNG_CUSTOM_HEAD_FILE: %w", err)
+		}
+		snippet = string(content)
+	}
+	snippet = strings.TrimSpace(snippet)
+	if headBreakoutPattern.MatchString(snippet) {
+		return "", errors.New("custom head must not contain <html>, <head> or <body> tags")
+	}
+	return snippet, nil
+}
+
+// customHeadTag renders the snippet for a page, wrapped in markers that
+// separate it from the page's own head elements, or "" when none is
+// configured.
+func customHeadTag(page snippetData) string {
+	head := renderSnippet(getConfig().customHead, page)
+	if head == "" {
+		return ""
+	}
+	return "<!-- custom head -->\n" + head + "\n<!-- /custom head -->"
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startedAt is when the process started, for the uptime in GET /api/debug.
+var startedAt = time.Now()
+
+// secretSettings are never shown by GET /api/debug.
+var secretSettings = map[string]bool{
+	"PNG_PASSWORD":         true,
+	"PNG_COOKIE_HASH_KEY":  true,
+	"PNG_COOKIE_BLOCK_KEY": true,
+	"PNG_COOKIE_KEYS":      true,
+}
+
+const redactedValue = "[redacted]"
+
+// handleDebug returns runtime statistics and the configuration, for quick
+// diagnosis without a metrics stack. Passwords and keys are redacted.
+func handleDebug(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	pages, err := countPages()
+	if err != nil {
+		log.Printf("Error counting pages: %v", err)
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"version":       buildInfo(),
+		"uptimeSeconds": int64(time.Since(startedAt).Seconds()),
+		"goroutines":    runtime.NumGoroutine(),
+		"memory": gin.H{
+			"allocBytes":      mem.Alloc,
+			"totalAllocBytes": mem.TotalAlloc,
+			"sysBytes":        mem.Sys,
+			"heapObjects":     mem.HeapObjects,
+			"numGC":           mem.NumGC,
+		},
+		"pages":    pages,
+		"readOnly": readOnly.Load(),
+		"cache":    pageCache.stats(),
+		"config":   configSummary(getConfig()),
+	})
+}
+
+// configSummary lists the settings by their environment variable names, with
+// the value of any secret replaced. Unset secrets stay empty, so the summary
+// still shows whether one is configured.
+func configSummary(cfg *Config) map[string]any {
+	summary := make(map[string]any)
+	value := reflect.ValueOf(*cfg)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || !field.IsExported() {
+			continue
+		}
+		setting := value.Field(i).Interface()
+		if secretSettings[name] && !isEmptySetting(value.Field(i)) {
+			setting = redactedValue
+		}
+		if d, ok := setting.(time.Duration); ok {
+			setting = d.String()
+		}
+		summary[name] = setting
+	}
+	return summary
+}
+
+func isEmptySetting(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
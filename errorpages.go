@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const htmlContentType = "text/html; charset=utf-8"
+
+// readErrorPages loads the custom error pages from PNG_404_PAGE and
+// PNG_500_PAGE. When unset, the bundled templates are used instead.
+func readErrorPages(cfg Config) (notFound, serverError []byte, err error) {
+	if notFound, err = readErrorPage(cfg.NotFoundPage); err != nil {
+		return nil, nil, fmt.Errorf("PNG_404_PAGE: %w", err)
+	}
+	if serverError, err = readErrorPage(cfg.ServerErrorPage); err != nil {
+		return nil, nil, fmt.Errorf("PNG_500_PAGE: %w", err)
+	}
+	return notFound, serverError, nil
+}
+
+func readErrorPage(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+// wantsJSON reports whether the client should get a JSON error rather than
+// an HTML page: API routes and requests that explicitly accept JSON.
+func wantsJSON(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	if path == "/api" || strings.HasPrefix(path, "/api/") {
+		return true
+	}
+	return c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+func renderNotFound(c *gin.Context) {
+	if wantsJSON(c) {
+		respondError(c, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	if page := getConfig().notFoundPage; page != nil {
+		c.Data(http.StatusNotFound, htmlContentType, page)
+		return
+	}
+	c.HTML(http.StatusNotFound, "404.html", nil)
+}
+
+func renderServerError(c *gin.Context) {
+	if page := getConfig().serverErrorPage; page != nil {
+		c.Data(http.StatusInternalServerError, htmlContentType, page)
+		return
+	}
+	c.HTML(http.StatusInternalServerError, "500.html", nil)
+}
+
+// recoverPanics turns a panicking handler into a 500: a PANIC error for API
+// clients, the error page for browsers. The panic is logged with the request
+// ID and stack trace, so the ID a client reports leads to it. A client that
+// went away gets no response, and http.ErrAbortHandler is passed on to the
+// server, which uses it to drop the connection.
+func recoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			err, _ := recovered.(error)
+			if isBrokenConnection(err) {
+				log.Printf("Connection lost serving %s %s (request %s): %v", c.Request.Method, c.Request.URL.Path, requestIDOf(c), err)
+				c.Abort()
+				return
+			}
+			log.Printf("Panic serving %s %s (request %s): %v\n%s", c.Request.Method, c.Request.URL.Path, requestIDOf(c), recovered, debug.Stack())
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			if wantsJSON(c) {
+				abortWithError(c, http.StatusInternalServerError, codePanic, "internal")
+				return
+			}
+			renderServerError(c)
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
+
+// isBrokenConnection reports whether err comes from writing to a client that
+// closed the connection.
+func isBrokenConnection(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	if !errors.As(opErr, &syscallErr) {
+		return false
+	}
+	message := strings.ToLower(syscallErr.Error())
+	return strings.Contains(message, "broken pipe") || strings.Contains(message, "connection reset by peer")
+}
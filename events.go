@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	eventPageCreated = "created"
+	eventPageUpdated = "updated"
+	eventPageDeleted = "deleted"
+
+	eventsPath        = "/api/events"
+	eventsHeartbeat   = 25 * time.Second
+	eventsClientQueue = 16
+)
+
+type pageEvent struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// eventBroker fans page changes out to the connected SSE clients.
+type eventBroker struct {
+	mu      sync.Mutex
+	clients map[chan pageEvent]struct{}
+}
+
+var pageEvents = &eventBroker{clients: make(map[chan pageEvent]struct{})}
+
+func (b *eventBroker) subscribe() chan pageEvent {
+	ch := make(chan pageEvent, eventsClientQueue)
+	b.mu.Lock()
+	b.clients[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan pageEvent) {
+	b.mu.Lock()
+	delete(b.clients, ch)
+	b.mu.Unlock()
+}
+
+// publish never blocks: a client too slow to drain its queue misses events
+// rather than holding up the handler that triggered them.
+func (b *eventBroker) publish(eventType, pageID string) {
+	event := pageEvent{Type: eventType, ID: pageID}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// handleEvents streams page changes as server-sent events until the client
+// disconnects. A comment is sent periodically so proxies keep the connection.
+func handleEvents(c *gin.Context) {
+	events := pageEvents.subscribe()
+	defer pageEvents.unsubscribe(events)
+
+	// The stream outlives PNG_SERVER_WRITE_TIMEOUT by design
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
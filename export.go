@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export formats accepted by GET /api/pages/:id/export.
+const (
+	exportFormatSingleFile = "singlefile"
+	exportFormatPDF        = "pdf"
+)
+
+var imageSrcPattern = regexp.MustCompile(`(?i)(<img\b[^>]*?\ssrc\s*=\s*)("[^"]*"|'[^']*')`)
+
+// handleExportPage returns a page as one self-contained HTML file to save or
+// send around. Styles are already inline; images attached as assets are
+// embedded as data URIs, while external images are left untouched. With
+// format=pdf that file is converted to PDF by PNG_PDF_RENDERER.
+func handleExportPage(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	format := c.DefaultQuery("format", exportFormatSingleFile)
+	if format != exportFormatSingleFile && format != exportFormatPDF {
+		respondError(c, http.StatusBadRequest, codeInvalidQuery, "format must be singlefile or pdf")
+		return
+	}
+	data, err := os.ReadFile(filepath.Join("public", pageID, "index.html"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+
+	if format == exportFormatPDF {
+		respondPDF(c, pageID, inlinePageImages(pageID, data))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.html"`, pageID))
+	c.Data(http.StatusOK, htmlContentType, inlinePageImages(pageID, data))
+}
+
+// inlinePageImages rewrites the <img> tags pointing at the page's assets,
+// whether as assets/<name> or by their full path, to data URIs. Images that
+// cannot be read keep their original source.
+func inlinePageImages(pageID string, data []byte) []byte {
+	assetsPrefix := pagePath(pageID) + assetsDirName + "/"
+	return imageSrcPattern.ReplaceAllFunc(data, func(tag []byte) []byte {
+		match := imageSrcPattern.FindSubmatch(tag)
+		src := string(match[2][1 : len(match[2])-1])
+		name, ok := strings.CutPrefix(strings.TrimPrefix(src, "./"), assetsDirName+"/")
+		if !ok {
+			if name, ok = strings.CutPrefix(src, assetsPrefix); !ok {
+				return tag
+			}
+		}
+		if !isValidAssetName(name) {
+			return tag
+		}
+		content, err := os.ReadFile(filepath.Join("public", pageID, assetsDirName, name))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Error inlining asset %s of %s: %v", name, pageID, err)
+			}
+			return tag
+		}
+		mediaType := assetContentType(name)
+		if mediaType == "application/octet-stream" {
+			mediaType = http.DetectContentType(content)
+		}
+		dataURI := "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(content)
+		return append(append([]byte{}, match[1]...), `"`+dataURI+`"`...)
+	})
+}
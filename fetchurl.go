@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const maxFetchRedirects = 5
+
+// UploadFromURLRequest is an upload whose content is fetched from URL. The
+// other fields are those of UploadRequest, which is validated separately as
+// its content is not in the request.
+type UploadFromURLRequest struct {
+	URL           string `json:"url" binding:"required"`
+	UploadRequest `binding:"-"`
+}
+
+var errFetchTooLarge = errors.New("fetched content too large")
+
+// urlNotAllowedError rejects a URL, or an address it resolved or redirected
+// to, that uploads may not fetch.
+type urlNotAllowedError struct{ reason string }
+
+func (e *urlNotAllowedError) Error() string {
+	return "URL not allowed: " + e.reason
+}
+
+// nonPublicPrefixes are ranges netip counts as global unicast that are not
+// reachable from the internet, or that translate or tunnel to an IPv4
+// address which could be internal.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network", reaches the host itself
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2001::/32"),      // Teredo
+	netip.MustParsePrefix("2002::/16"),      // 6to4
+}
+
+// isPublicAddress reports whether addr is a globally routable unicast
+// address, as opposed to loopback, private, link-local and the like.
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchClient fetches remote content for uploads. Every connection, including
+// those made to follow redirects, is checked after DNS resolution, right
+// before connecting, so a hostname cannot point the server at itself or its
+// internal network. Proxies from the environment are ignored, as they would
+// connect on the server's behalf without that check.
+var fetchClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil || !isPublicAddress(addrPort.Addr()) {
+					return &urlNotAllowedError{reason: address + " is not a public address"}
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxFetchRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+		}
+		return checkFetchURL(req.URL)
+	},
+}
+
+// checkFetchURL only lets http and https URLs through. Where they point to is
+// checked when connecting.
+func checkFetchURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return &urlNotAllowedError{reason: "only http and https URLs without credentials can be fetched"}
+	}
+	return nil
+}
+
+// fetchContent downloads the document at rawURL, within PNG_FETCH_TIMEOUT
+// and PNG_MAX_UPLOAD_SIZE.
+func fetchContent(ctx context.Context, rawURL string) (string, error) {
+	cfg := getConfig()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", &urlNotAllowedError{reason: err.Error()}
+	}
+	if err := checkFetchURL(u); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.FetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "press-n-go/"+version)
+	if traceParent, ok := ctx.Value(traceParentContextKey{}).(string); ok {
+		req.Header.Set("traceparent", traceParent)
+	}
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the server answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cfg.MaxUploadSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(body)) > cfg.MaxUploadSize {
+		return "", fmt.Errorf("%w: more than %d bytes", errFetchTooLarge, cfg.MaxUploadSize)
+	}
+	return string(body), nil
+}
+
+// handleUploadFromURL publishes a document fetched from a URL, exactly as if
+// its content had been sent to POST /api/upload.
+func handleUploadFromURL(c *gin.Context) {
+	start := time.Now()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, getConfig().MaxUploadSize)
+	var req UploadFromURLRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.Content != "" || len(req.Files) > 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "content and files cannot be sent along with url")
+		return
+	}
+	// Check the other fields before fetching anything
+	upload := req.UploadRequest
+	upload.Content = req.URL
+	if err := binding.Validator.ValidateStruct(upload); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	content, err := fetchContent(c.Request.Context(), req.URL)
+	var notAllowed *urlNotAllowedError
+	switch {
+	case errors.As(err, &notAllowed):
+		respondError(c, http.StatusBadRequest, codeURLNotAllowed, notAllowed.Error())
+		return
+	case errors.Is(err, errFetchTooLarge):
+		respondError(c, http.StatusRequestEntityTooLarge, codeTooLarge, err.Error())
+		return
+	case err != nil:
+		respondError(c, http.StatusBadGateway, codeFetchFailed, "Could not fetch "+req.URL+": "+err.Error())
+		return
+	}
+
+	if content == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidContent, "The fetched document is empty")
+		return
+	}
+	upload.Content = content
+	publishUpload(c, start, upload)
+}
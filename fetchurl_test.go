@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "8.8.8.8", want: true},
+		{addr: "100.63.255.255", want: true},
+		{addr: "198.20.0.1", want: true},
+		{addr: "2606:2800:220:1::1", want: true},
+		{addr: "::ffff:93.184.216.34", want: true},
+		{addr: "2001:4860:4860::8888", want: true},
+
+		{addr: "0.0.0.0", want: false},
+		{addr: "0.1.2.3", want: false},
+		{addr: "127.0.0.1", want: false},
+		{addr: "10.0.0.1", want: false},
+		{addr: "172.16.0.1", want: false},
+		{addr: "192.168.1.1", want: false},
+		{addr: "169.254.169.254", want: false},
+		{addr: "100.64.0.1", want: false},
+		{addr: "198.18.0.1", want: false},
+		{addr: "198.19.255.255", want: false},
+		{addr: "240.0.0.1", want: false},
+		{addr: "224.0.0.1", want: false},
+		{addr: "255.255.255.255", want: false},
+		{addr: "::", want: false},
+		{addr: "::1", want: false},
+		{addr: "::ffff:127.0.0.1", want: false},
+		{addr: "fe80::1", want: false},
+		{addr: "fc00::1", want: false},
+		{addr: "ff02::1", want: false},
+		{addr: "64:ff9b::7f00:1", want: false},
+		{addr: "64:ff9b::5db8:d822", want: false},
+		{addr: "64:ff9b:1::a00:1", want: false},
+		{addr: "2001:0:4136:e378:8000:63bf:3fff:fdd2", want: false},
+		{addr: "2002:7f00:1::1", want: false},
+		{addr: "2002:c0a8:101::1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isPublicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("isPublicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
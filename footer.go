@@ -0,0 +1,24 @@
+package main
+
+import "strings"
+
+const attributionHTML = `Published with <a href="https://github.com/decima/press-n-go">press-n-go</a>`
+
+// pageFooterTag builds the footer appended to rendered markdown pages from
+// PNG_PAGE_FOOTER and the default attribution. Like the custom head, the
+// footer is trusted configuration: its text is inserted verbatim and its
+// template actions, such as {{year}}, are rendered for the page.
+func pageFooterTag(page snippetData) string {
+	cfg := getConfig()
+	var parts []string
+	if footer := renderSnippet(cfg.pageFooter, page); footer != "" {
+		parts = append(parts, `<span class="page-footer-text">`+footer+`</span>`)
+	}
+	if cfg.PageAttribution {
+		parts = append(parts, `<span class="page-footer-attribution">`+attributionHTML+`</span>`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return `<footer class="page-footer">` + strings.Join(parts, " ") + `</footer>`
+}
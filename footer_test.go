@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPageFooter(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		wantFooter      bool
+		wantAttribution bool
+		wantText        string
+	}{
+		{name: "no footer by default"},
+		{name: "attribution when enabled", env: map[string]string{"PNG_PAGE_ATTRIBUTION": "true"}, wantFooter: true, wantAttribution: true},
+		{name: "custom footer alone", env: map[string]string{"PNG_PAGE_FOOTER": "&copy; {{siteTitle}}", "PNG_SITE_TITLE": "Notes"},
+			wantFooter: true, wantText: `<span class="page-footer-text">&copy; Notes</span>`},
+		{name: "custom footer with attribution", env: map[string]string{"PNG_PAGE_FOOTER": "Mine", "PNG_PAGE_ATTRIBUTION": "true"},
+			wantFooter: true, wantAttribution: true, wantText: `<span class="page-footer-text">Mine</span>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg := defaultTestConfig(t)
+			cfg.OGImage = false
+			setTestConfig(t, cfg)
+			page, err := renderPage(context.Background(), "page", UploadRequest{Type: "markdown", Content: "# Hi\n"}, &PageMeta{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(page.html, `<footer class="page-footer">`); got != tt.wantFooter {
+				t.Errorf("footer rendered = %v, want %v", got, tt.wantFooter)
+			}
+			if got := strings.Contains(page.html, attributionHTML); got != tt.wantAttribution {
+				t.Errorf("attribution rendered = %v, want %v", got, tt.wantAttribution)
+			}
+			if tt.wantText != "" && !strings.Contains(page.html, tt.wantText) {
+				t.Errorf("page has no %s:\n%s", tt.wantText, page.html)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forceHTTPS implements PNG_FORCE_HTTPS. Requests a trusted proxy reports as
+// plain HTTP through X-Forwarded-Proto are redirected to the same URL over
+// HTTPS, and responses to secure requests carry Strict-Transport-Security.
+//
+// Only an explicit "http" from PNG_TRUSTED_PROXIES triggers a redirect. A
+// request without the header, or from a proxy that is not trusted, is served
+// as is: the app cannot tell whether TLS was terminated in front of it, and
+// redirecting it anyway would loop forever behind a proxy that talks plain
+// HTTP to the app. Paths in PNG_FORCE_HTTPS_EXCLUDE, such as health checks
+// probing the app directly, are never redirected.
+func forceHTTPS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := getConfig()
+		if !cfg.ForceHTTPS {
+			c.Next()
+			return
+		}
+		switch requestScheme(c) {
+		case "https":
+			if cfg.HSTSMaxAge > 0 {
+				c.Header("Strict-Transport-Security", "max-age="+strconv.FormatInt(int64(cfg.HSTSMaxAge.Seconds()), 10))
+			}
+		case "http":
+			forwarded := fromTrustedProxy(c) && firstHeaderValue(c.GetHeader("X-Forwarded-Proto")) == "http"
+			if !forwarded || slices.Contains(cfg.ForceHTTPSExclude, c.Request.URL.Path) {
+				break
+			}
+			host := requestHost(c)
+			if !hostPattern.MatchString(host) {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			// 308 keeps the method and body of API writes, which a 301 lets
+			// clients turn into a GET
+			status := http.StatusPermanentRedirect
+			if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+				status = http.StatusMovedPermanently
+			}
+			c.Redirect(status, "https://"+host+c.Request.RequestURI)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
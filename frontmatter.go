@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// frontMatter holds the metadata fields recognized in a markdown document's
+// YAML front matter block.
+type frontMatter struct {
+	Title       string
+	Description string
+	Author      string
+	Tags        []string
+	Draft       bool
+}
+
+// parseFrontMatter extracts the known fields from the values decoded by the
+// goldmark meta extension. Unknown keys are ignored.
+func parseFrontMatter(values map[string]interface{}) (frontMatter, error) {
+	var fm frontMatter
+	if title, ok := values["title"]; ok {
+		fm.Title = strings.TrimSpace(fmt.Sprint(title))
+	}
+	if description, ok := values["description"]; ok {
+		fm.Description = strings.TrimSpace(fmt.Sprint(description))
+	}
+	if author, ok := values["author"]; ok {
+		fm.Author = strings.TrimSpace(fmt.Sprint(author))
+	}
+	switch tags := values["tags"].(type) {
+	case nil:
+	case string:
+		// Allow the shorthand "tags: go, web"
+		fm.Tags = strings.Split(tags, ",")
+	case []interface{}:
+		for _, tag := range tags {
+			fm.Tags = append(fm.Tags, fmt.Sprint(tag))
+		}
+	default:
+		return fm, fmt.Errorf("%w: front matter tags must be a list or a comma-separated string", errInvalidContent)
+	}
+	switch draft := values["draft"].(type) {
+	case nil:
+	case bool:
+		fm.Draft = draft
+	default:
+		return fm, fmt.Errorf("%w: front matter draft must be true or false", errInvalidContent)
+	}
+	return fm, nil
+}
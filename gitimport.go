@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Outcomes of importing one file, or of a page whose file is gone.
+const (
+	importCreated   = "created"
+	importUpdated   = "updated"
+	importUnchanged = "unchanged"
+	importDeleted   = "deleted"
+	importKept      = "kept"
+	importFailed    = "failed"
+)
+
+var (
+	gitBranchPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+	slugPartPattern  = regexp.MustCompile(`[^a-z0-9_]+`)
+)
+
+// GitImportRequest publishes the markdown files of a Git repository. The
+// other fields are those of UploadRequest, applied to every imported page;
+// Overwrite lets the import replace pages it did not create.
+type GitImportRequest struct {
+	URL string `json:"url" binding:"required"`
+	// Branch defaults to the repository's default branch.
+	Branch string `json:"branch"`
+	// Token is sent with HTTP Basic auth, as access tokens of the common Git
+	// hosts are.
+	Token string `json:"token"`
+	// Path limits the import to a folder of the repository.
+	Path string `json:"path"`
+	// Prefix is put before the slugs derived from file paths.
+	Prefix        string `json:"prefix"`
+	UploadRequest `binding:"-"`
+}
+
+// GitImportResult is the outcome for one markdown file of the repository, or
+// one page whose file was removed from it.
+type GitImportResult struct {
+	Path   string `json:"path"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GitImportSummary answers POST /api/import/git. Complete is false when
+// PNG_REQUEST_TIMEOUT stopped the import, in which case no page was deleted.
+type GitImportSummary struct {
+	Commit    string            `json:"commit"`
+	Complete  bool              `json:"complete"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Deleted   int               `json:"deleted"`
+	Failed    int               `json:"failed"`
+	Results   []GitImportResult `json:"results"`
+}
+
+func (s *GitImportSummary) add(result GitImportResult) {
+	switch result.Status {
+	case importCreated:
+		s.Created++
+	case importUpdated:
+		s.Updated++
+	case importUnchanged:
+		s.Unchanged++
+	case importDeleted:
+		s.Deleted++
+	case importFailed:
+		s.Failed++
+	}
+	s.Results = append(s.Results, result)
+}
+
+// checkGitURL only lets through http and https URLs of hosts resolving to
+// public addresses, and returns the address git must connect to. Git
+// connects on its own, so unlike fetchContent the addresses are checked
+// beforehand, and it is not allowed to follow redirects elsewhere.
+func checkGitURL(ctx context.Context, rawURL string) (*url.URL, netip.Addr, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, netip.Addr{}, &urlNotAllowedError{reason: err.Error()}
+	}
+	if err := checkFetchURL(u); err != nil {
+		return nil, netip.Addr{}, err
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return nil, netip.Addr{}, err
+	}
+	if len(addrs) == 0 {
+		return nil, netip.Addr{}, &net.DNSError{Err: "no addresses", Name: u.Hostname(), IsNotFound: true}
+	}
+	for _, addr := range addrs {
+		if !isPublicAddress(addr) {
+			return nil, netip.Addr{}, &urlNotAllowedError{reason: u.Hostname() + " is not a public address"}
+		}
+	}
+	return u, addrs[0].Unmap(), nil
+}
+
+// gitResolveOption pins the host of u to addr for git, which would otherwise
+// resolve it again and could be answered with a private address the second
+// time. It is empty when the host is already an address.
+func gitResolveOption(u *url.URL, addr netip.Addr) string {
+	if _, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	ip := addr.String()
+	if addr.Is6() {
+		ip = "[" + ip + "]"
+	}
+	return "http.curloptResolve=" + u.Hostname() + ":" + port + ":" + ip
+}
+
+// runGit runs PNG_GIT_COMMAND without the system and user configuration,
+// prompts or LFS downloads. The token goes through the environment rather
+// than the command line, where other processes could read it.
+func runGit(ctx context.Context, token string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, getConfig().GitCommand, args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_LFS_SKIP_SMUDGE=1")
+	if token != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		cmd.Env = append(cmd.Env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials)
+	}
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// cloneRepository makes a shallow clone of one branch into dir and returns
+// the commit checked out, connecting to the address checked by checkGitURL.
+// Symbolic links are checked out as plain files, so they cannot point the
+// import at files outside the clone.
+func cloneRepository(ctx context.Context, u *url.URL, addr netip.Addr, branch, token, dir string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, getConfig().GitTimeout)
+	defer cancel()
+	args := []string{
+		"-c", "protocol.allow=never", "-c", "protocol.https.allow=always", "-c", "protocol.http.allow=always",
+		"-c", "http.followRedirects=false", "-c", "core.symlinks=false",
+	}
+	if resolve := gitResolveOption(u, addr); resolve != "" {
+		args = append(args, "-c", resolve)
+	}
+	args = append(args, "clone", "--quiet", "--depth=1", "--single-branch", "--no-tags")
+	if branch != "" {
+		args = append(args, "--branch="+branch)
+	}
+	if _, err := runGit(ctx, token, append(args, "--", u.String(), dir)...); err != nil {
+		return "", err
+	}
+	return runGit(ctx, "", "-C", dir, "rev-parse", "HEAD")
+}
+
+// importSlug derives a page ID from the path of a markdown file: docs/Getting
+// Started.md becomes docs-getting-started, and an index file takes the name of
+// its folder.
+func importSlug(prefix, filePath string) (string, error) {
+	name := strings.TrimSuffix(filePath, path.Ext(filePath))
+	if dir, base := path.Split(name); dir != "" && strings.EqualFold(base, "index") {
+		name = dir
+	}
+	slug := strings.Trim(slugPartPattern.ReplaceAllString(strings.ToLower(name), "-"), "-_")
+	return normalizeSlug(prefix + slug)
+}
+
+// findMarkdownFiles lists the markdown files below folder, as slash-separated
+// paths relative to the repository.
+func findMarkdownFiles(repoDir, folder string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(filepath.Join(repoDir, filepath.FromSlash(folder)), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.Type().IsRegular() || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+		rel, err := filepath.Rel(repoDir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// handleGitImport publishes the markdown files of a Git repository, one page
+// per file, and deletes the pages of files removed since the last import of
+// the same repository and branch. Running it again only re-renders the files
+// that changed, so it can be called from a CI job or cron to keep the pages in
+// sync.
+func handleGitImport(c *gin.Context) {
+	cfg := getConfig()
+	if !cfg.GitImport {
+		respondError(c, http.StatusNotImplemented, codeGitUnavailable, "Git import is disabled: set PNG_GIT_IMPORT to enable it")
+		return
+	}
+	if _, err := exec.LookPath(cfg.GitCommand); err != nil {
+		log.Printf("Git unavailable: %v", err)
+		respondError(c, http.StatusNotImplemented, codeGitUnavailable, cfg.GitCommand+" is not installed")
+		return
+	}
+
+	var req GitImportRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.Content != "" || len(req.Files) > 0 || req.Slug != "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "content, files and slug cannot be sent along with url")
+		return
+	}
+	if req.Type != "" && req.Type != "markdown" {
+		respondError(c, http.StatusBadRequest, codeInvalidType, "Git imports only publish markdown files")
+		return
+	}
+	if req.Branch != "" && (!gitBranchPattern.MatchString(req.Branch) || strings.HasPrefix(req.Branch, "-")) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid branch name")
+		return
+	}
+	folder := path.Clean("/" + req.Path)[1:]
+	if req.Prefix != "" && !slugPattern.MatchString(req.Prefix) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "prefix may only contain lowercase letters, digits, '-' and '_', starting with a letter or digit")
+		return
+	}
+	// Check the options shared by every page before cloning anything
+	upload := req.UploadRequest
+	upload.Type, upload.Content = "markdown", req.URL
+	if err := binding.Validator.ValidateStruct(upload); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if err := validateUploadRequest(&upload); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidTag, err.Error())
+		return
+	}
+	if err := checkTOCLevels(upload); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if err := checkTypeAllowed(upload); err != nil {
+		respondError(c, http.StatusForbidden, codeForbidden, err.Error())
+		return
+	}
+	if err := checkRawHTMLAllowed(upload); err != nil {
+		respondError(c, http.StatusForbidden, codeForbidden, err.Error())
+		return
+	}
+	if !checkPageHTML(c, upload) {
+		return
+	}
+	if upload.ThemeCSS != nil {
+		if err := validateThemeCSS(*upload.ThemeCSS); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidTheme, err.Error())
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	u, addr, err := checkGitURL(ctx, req.URL)
+	var notAllowed *urlNotAllowedError
+	switch {
+	case errors.As(err, &notAllowed):
+		respondError(c, http.StatusBadRequest, codeURLNotAllowed, notAllowed.Error())
+		return
+	case err != nil:
+		respondError(c, http.StatusBadGateway, codeFetchFailed, "Could not resolve "+req.URL+": "+err.Error())
+		return
+	}
+	dir, err := os.MkdirTemp("", "press-n-go-git-")
+	if err != nil {
+		log.Printf("Error creating Git work directory: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not clone the repository")
+		return
+	}
+	defer os.RemoveAll(dir)
+	repoDir := filepath.Join(dir, "repo")
+	commit, err := cloneRepository(ctx, u, addr, req.Branch, req.Token, repoDir)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		respondError(c, http.StatusServiceUnavailable, codeTimeout, "Cloning the repository timed out")
+		return
+	case err != nil:
+		respondError(c, http.StatusBadGateway, codeFetchFailed, "Could not clone "+req.URL+": "+err.Error())
+		return
+	}
+	files, err := findMarkdownFiles(repoDir, folder)
+	if errors.Is(err, fs.ErrNotExist) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "The repository has no folder "+folder)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing files of %s: %v", req.URL, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list the repository files")
+		return
+	}
+	if cfg.GitImportMaxFiles > 0 && len(files) > cfg.GitImportMaxFiles {
+		respondError(c, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("The repository has %d markdown files, more than the %d allowed by PNG_GIT_IMPORT_MAX_FILES", len(files), cfg.GitImportMaxFiles))
+		return
+	}
+
+	// Pages remember the repository and branch they come from, so the next
+	// import finds those whose file is gone
+	source := u.String()
+	if req.Branch != "" {
+		source += "#" + req.Branch
+	}
+	summary := GitImportSummary{Commit: commit, Complete: true, Results: []GitImportResult{}}
+	paths := make(map[string]bool, len(files))
+	slugPaths := make(map[string]string, len(files))
+	for _, file := range files {
+		if ctx.Err() != nil {
+			summary.Complete = false
+			break
+		}
+		paths[file] = true
+		result := GitImportResult{Path: file, Status: importFailed}
+		slug, err := importSlug(req.Prefix, file)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case slugPaths[slug] != "":
+			result.Error = "same page ID " + slug + " as " + slugPaths[slug]
+		default:
+			slugPaths[slug] = file
+			result = importGitFile(c, source, filepath.Join(repoDir, filepath.FromSlash(file)), file, slug, upload)
+		}
+		summary.add(result)
+	}
+	if summary.Complete {
+		for _, result := range removeImportedPages(c, source, folder, paths) {
+			summary.add(result)
+		}
+	}
+	log.Printf("Imported %s at %s: %d created, %d updated, %d unchanged, %d deleted, %d failed", source, commit, summary.Created, summary.Updated, summary.Unchanged, summary.Deleted, summary.Failed)
+	respondJSON(c, http.StatusOK, summary)
+}
+
+// importGitFile publishes one markdown file under slug, as a new page or over
+// the one imported from it before.
+func importGitFile(c *gin.Context, source, filePath, file, slug string, upload UploadRequest) GitImportResult {
+	cfg := getConfig()
+	result := GitImportResult{Path: file, ID: slug, Status: importFailed}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if info.Size() > cfg.MaxUploadSize {
+		result.Error = fmt.Sprintf("larger than PNG_MAX_UPLOAD_SIZE (%d bytes)", cfg.MaxUploadSize)
+		return result
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	upload.Content = string(content)
+	if err := validateContent(upload); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	pageCreateMu.Lock()
+	defer pageCreateMu.Unlock()
+	ctx := c.Request.Context()
+	if _, err := os.Stat(filepath.Join("public", slug)); err == nil {
+		meta, err := readPageMeta(slug)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if meta.ImportSource != source && !upload.Overwrite {
+			result.Error = "a page not imported from this repository already uses this ID: pass \"overwrite\": true to replace it"
+			return result
+		}
+		if meta.ImportSource == source && meta.ImportPath == file && meta.ContentHash == contentHash(upload) {
+			result.Status = importUnchanged
+			return result
+		}
+		if err := replacePage(ctx, slug, upload); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Status = importUpdated
+		recordAudit(c, auditActionEdit, slug)
+	} else {
+		if cfg.MaxPages > 0 {
+			count, err := countPages()
+			if err != nil {
+				result.Error = err.Error()
+				return result
+			}
+			if count >= cfg.MaxPages {
+				result.Error = fmt.Sprintf("page limit reached: this instance allows at most %d pages", cfg.MaxPages)
+				return result
+			}
+		}
+		if err := createPageFile(ctx, slug, upload); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Status = importCreated
+		recordAudit(c, auditActionUpload, slug)
+	}
+
+	if _, err := updatePageMeta(slug, func(meta *PageMeta) error {
+		meta.ImportSource, meta.ImportPath = source, file
+		return nil
+	}); err != nil {
+		log.Printf("Error recording the source of imported page %s: %v", slug, err)
+	}
+	if result.Status == importCreated {
+		pageEvents.publish(eventPageCreated, slug)
+		if cfg.MaxPagesKeep > 0 {
+			prunePages(c, cfg.MaxPagesKeep, slug)
+		}
+	} else {
+		pageEvents.publish(eventPageUpdated, slug)
+	}
+	return result
+}
+
+// removeImportedPages deletes the pages imported from source whose file below
+// folder is no longer in the repository. Pinned pages are kept.
+func removeImportedPages(c *gin.Context, source, folder string, paths map[string]bool) []GitImportResult {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		log.Printf("Error listing pages for removal: %v", err)
+		return nil
+	}
+	var results []GitImportResult
+	for _, entry := range entries {
+		if !isPageDir(entry) {
+			continue
+		}
+		pageID := entry.Name()
+		meta, err := readPageMeta(pageID)
+		if err != nil || meta.ImportSource != source || paths[meta.ImportPath] {
+			continue
+		}
+		if folder != "" && !strings.HasPrefix(meta.ImportPath, folder+"/") {
+			continue
+		}
+		result := GitImportResult{Path: meta.ImportPath, ID: pageID, Status: importDeleted}
+		if meta.Pinned {
+			result.Status, result.Error = importKept, "the page is pinned"
+			results = append(results, result)
+			continue
+		}
+		if err := deletePage(c, pageID, auditActionDelete); err != nil {
+			log.Printf("Error deleting imported page %s: %v", pageID, err)
+			result.Status, result.Error = importFailed, "could not delete the page"
+		}
+		results = append(results, result)
+	}
+	return results
+}
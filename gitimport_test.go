@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGitResolveOption(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		addr string
+		want string
+	}{
+		{name: "https default port", url: "https://git.example.com/repo.git", addr: "93.184.216.34", want: "http.curloptResolve=git.example.com:443:93.184.216.34"},
+		{name: "http default port", url: "http://git.example.com/repo.git", addr: "93.184.216.34", want: "http.curloptResolve=git.example.com:80:93.184.216.34"},
+		{name: "explicit port", url: "https://git.example.com:8443/repo.git", addr: "93.184.216.34", want: "http.curloptResolve=git.example.com:8443:93.184.216.34"},
+		{name: "IPv6 address", url: "https://git.example.com/repo.git", addr: "2606:2800:220:1::1", want: "http.curloptResolve=git.example.com:443:[2606:2800:220:1::1]"},
+		{name: "host is an address", url: "https://93.184.216.34/repo.git", addr: "93.184.216.34", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := gitResolveOption(u, netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("gitResolveOption = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckGitURLRejectsPrivateHosts(t *testing.T) {
+	for _, rawURL := range []string{"http://localhost/repo.git", "http://127.0.0.1/repo.git", "http://[::1]/repo.git", "file:///etc/repo"} {
+		if _, _, err := checkGitURL(context.Background(), rawURL); err == nil {
+			t.Errorf("checkGitURL(%q) accepted a private host", rawURL)
+		}
+	}
+}
+
+// TestCloneUsesCheckedAddress serves a repository over smart HTTP on the
+// loopback address and clones it through a host name that does not resolve,
+// which only succeeds if git connects to the address it was given.
+func TestCloneUsesCheckedAddress(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git has no exec path")
+	}
+	backend := filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git-http-backend is not installed")
+	}
+	setTestConfig(t, Config{GitCommand: "git", GitTimeout: time.Minute})
+
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull,
+			"GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@example.com", "GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@example.com")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("init", "--quiet", work)
+	if err := os.WriteFile(filepath.Join(work, "index.md"), []byte("# Hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("-C", work, "add", "index.md")
+	git("-C", work, "commit", "--quiet", "-m", "init")
+	git("clone", "--quiet", "--bare", work, filepath.Join(root, "repo.git"))
+
+	server := httptest.NewServer(&cgi.Handler{
+		Path: backend,
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse("http://pinned.invalid:" + serverURL.Port() + "/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := cloneRepository(context.Background(), u, netip.MustParseAddr("127.0.0.1"), "", "", filepath.Join(root, "clone"))
+	if err != nil {
+		t.Fatalf("clone through the pinned address failed: %v", err)
+	}
+	if len(commit) != 40 {
+		t.Errorf("commit = %q, want a hash", commit)
+	}
+	if _, err := os.Stat(filepath.Join(root, "clone", "index.md")); err != nil {
+		t.Errorf("cloned file missing: %v", err)
+	}
+}
+
+func TestRemoveImportedPages(t *testing.T) {
+	auditLog := useTestDeletion(t)
+	const source = "https://git.example.com/repo.git#main"
+	newTestPage(t, "kept-file", PageMeta{Type: "markdown", ImportSource: source, ImportPath: "docs/kept.md"})
+	newTestPage(t, "removed-file", PageMeta{Type: "markdown", ImportSource: source, ImportPath: "docs/removed.md"})
+	newTestPage(t, "pinned-file", PageMeta{Type: "markdown", ImportSource: source, ImportPath: "docs/pinned.md", Pinned: true})
+	newTestPage(t, "other-folder", PageMeta{Type: "markdown", ImportSource: source, ImportPath: "blog/post.md"})
+	newTestPage(t, "other-repo", PageMeta{Type: "markdown", ImportSource: "https://git.example.com/other.git", ImportPath: "docs/removed.md"})
+	newTestPage(t, "uploaded", PageMeta{Type: "markdown"})
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/import/git", nil)
+	results := removeImportedPages(c, source, "docs", map[string]bool{"docs/kept.md": true})
+
+	statuses := map[string]string{}
+	for _, result := range results {
+		statuses[result.ID] = result.Status
+	}
+	if len(statuses) != 2 || statuses["removed-file"] != importDeleted || statuses["pinned-file"] != importKept {
+		t.Errorf("results = %+v, want removed-file deleted and pinned-file kept", results)
+	}
+	for _, id := range []string{"kept-file", "pinned-file", "other-folder", "other-repo", "uploaded"} {
+		if _, err := os.Stat(filepath.Join("public", id)); err != nil {
+			t.Errorf("%s was removed: %v", id, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join("public", "removed-file")); !os.IsNotExist(err) {
+		t.Errorf("removed-file still exists: %v", err)
+	}
+	if !isDeletedPage("removed-file") {
+		t.Error("removed-file is not recorded as deleted")
+	}
+	if got := strings.Join(auditActions(t, auditLog), ", "); got != "delete removed-file" {
+		t.Errorf("audit = %s, want the deletion", got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDeletedPages bounds the deleted pages remembered: past it, the oldest
+// deletions are forgotten and their URLs answer 404 again.
+const maxDeletedPages = 10_000
+
+// deletedPages remembers which pages were deleted and when, so their URLs
+// answer 410 Gone rather than the 404 of a page that never existed. It is
+// kept in PNG_DELETED_PAGES_FILE.
+var deletedPages = newPageLog[time.Time]()
+
+// loadDeletedPages reads PNG_DELETED_PAGES_FILE at startup. An empty setting
+// disables the log: deleted pages then answer 404 like any missing page.
+func loadDeletedPages() {
+	path := getConfig().DeletedPagesFile
+	if path == "" {
+		return
+	}
+	if err := deletedPages.load(path); err != nil {
+		log.Printf("Warning: could not load deleted pages from %s: %v", path, err)
+	}
+}
+
+// recordDeletedPage remembers that pageID was deleted. Failures are logged
+// but never fail the deletion.
+func recordDeletedPage(pageID string) {
+	path := getConfig().DeletedPagesFile
+	if path == "" {
+		return
+	}
+	err := deletedPages.update(path, func(pages map[string]time.Time) bool {
+		pages[pageID] = time.Now().UTC()
+		if len(pages) > maxDeletedPages {
+			ids := slices.SortedFunc(maps.Keys(pages), func(a, b string) int {
+				return pages[a].Compare(pages[b])
+			})
+			for _, id := range ids[:len(ids)-maxDeletedPages] {
+				delete(pages, id)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.Printf("Error saving deleted pages to %s: %v", path, err)
+	}
+}
+
+// forgetDeletedPage is called when a page is published, in case its ID
+// belonged to a deleted page.
+func forgetDeletedPage(pageID string) {
+	path := getConfig().DeletedPagesFile
+	if path == "" {
+		return
+	}
+	if _, err := deletedPages.remove(path, pageID); err != nil {
+		log.Printf("Error saving deleted pages to %s: %v", path, err)
+	}
+}
+
+// isDeletedPage reports whether pageID belongs to a page that was deleted
+// and not published again.
+func isDeletedPage(pageID string) bool {
+	if getConfig().DeletedPagesFile == "" {
+		return false
+	}
+	_, ok := deletedPages.get(pageID)
+	return ok
+}
+
+// renderGone answers the URL of a deleted page with 410 Gone.
+func renderGone(c *gin.Context) {
+	if wantsJSON(c) {
+		abortWithError(c, http.StatusGone, codePageGone, "The page was deleted")
+		return
+	}
+	c.HTML(http.StatusGone, "410.html", nil)
+	c.Abort()
+}
+
+// renderMissingPage answers the URL of a page that does not exist: 410 if it
+// was deleted, 404 otherwise.
+func renderMissingPage(c *gin.Context, pageID string) {
+	if isDeletedPage(pageID) {
+		renderGone(c)
+		return
+	}
+	renderNotFound(c)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// headingAnchorCSS hides the anchors until their heading is hovered or the
+// anchor itself is focused.
+const headingAnchorCSS = `<style>
+.heading-anchor { margin-left: 0.3em; text-decoration: none; opacity: 0; }
+h1:hover .heading-anchor, h2:hover .heading-anchor, h3:hover .heading-anchor,
+h4:hover .heading-anchor, h5:hover .heading-anchor, h6:hover .heading-anchor,
+.heading-anchor:focus { opacity: 0.6; }
+</style>`
+
+var headingAnchorPattern = regexp.MustCompile(`<a href="[^"]*" class="heading-anchor"[^>]*>¶</a>`)
+
+// stripHeadingAnchors removes the anchors from rendered HTML, so they do not
+// end up in extracted titles or word counts.
+func stripHeadingAnchors(renderedHTML string) string {
+	return headingAnchorPattern.ReplaceAllString(renderedHTML, "")
+}
+
+// headingAnchorTransformer appends a "¶" link to every heading having an ID
+// when PNG_HEADING_ANCHORS is enabled, so readers can copy deep links.
+type headingAnchorTransformer struct{}
+
+func (headingAnchorTransformer) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	if !getConfig().HeadingAnchors {
+		return
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		id, ok := heading.AttributeString("id")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		var anchor []byte
+		switch id := id.(type) {
+		case []byte:
+			anchor = id
+		case string:
+			anchor = []byte(id)
+		}
+		link := ast.NewLink()
+		link.Destination = append([]byte("#"), anchor...)
+		link.SetAttributeString("class", []byte("heading-anchor"))
+		link.SetAttributeString("title", []byte("Link to this section"))
+		link.AppendChild(link, ast.NewString([]byte("¶")))
+		heading.AppendChild(heading, link)
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// headingAnchorStyle returns the anchor CSS for rendered pages, or nothing
+// when the anchors are disabled.
+func headingAnchorStyle() string {
+	if !getConfig().HeadingAnchors {
+		return ""
+	}
+	return headingAnchorCSS
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+const pageIDPlaceholder = "{id}"
+
+var headingPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+// prefixedIDs generates heading IDs like goldmark's default generator but
+// prepends a prefix, so anchors from several pages embedded in one document
+// do not collide. It remembers what it generated for prefixedLinkTransformer.
+type prefixedIDs struct {
+	parser.IDs
+	prefix    string
+	generated map[string]bool
+}
+
+func (p *prefixedIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	id := p.prefix + string(p.IDs.Generate(value, kind))
+	p.generated[id] = true
+	return []byte(id)
+}
+
+// headingIDPrefix expands PNG_HEADING_ID_PREFIX for a page.
+func headingIDPrefix(pageID string) string {
+	return strings.ReplaceAll(getConfig().HeadingIDPrefix, pageIDPlaceholder, pageID)
+}
+
+// newMarkdownContext returns the parser context for rendering a page, with
+// prefixed heading IDs when PNG_HEADING_ID_PREFIX is set.
+func newMarkdownContext(pageID string) parser.Context {
+	prefix := headingIDPrefix(pageID)
+	if prefix == "" {
+		return parser.NewContext()
+	}
+	return parser.NewContext(parser.WithIDs(&prefixedIDs{
+		IDs:       parser.NewContext().IDs(),
+		prefix:    prefix,
+		generated: make(map[string]bool),
+	}))
+}
+
+// prefixedLinkTransformer rewrites in-page links such as [Intro](#intro) to
+// the prefixed heading ID, so tables of contents keep working.
+type prefixedLinkTransformer struct{}
+
+func (prefixedLinkTransformer) Transform(doc *ast.Document, _ text.Reader, pc parser.Context) {
+	ids, ok := pc.IDs().(*prefixedIDs)
+	if !ok {
+		return
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := n.(*ast.Link)
+		if !entering || !ok || !bytes.HasPrefix(link.Destination, []byte("#")) {
+			return ast.WalkContinue, nil
+		}
+		if target := ids.prefix + string(link.Destination[1:]); ids.generated[target] {
+			link.Destination = []byte("#" + target)
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+var headingNumberPattern = regexp.MustCompile(`<span class="heading-number">[0-9.]*</span> `)
+
+// headingNumberTransformer prepends section numbers such as 1, 1.1 and 1.2 to
+// the headings of pages rendered with numberHeadings. A lone h1 is taken to
+// be the page title and left unnumbered; numbering starts at the shallowest
+// remaining level, and a level skipped between two headings counts as 0.
+//
+// Heading IDs are generated while parsing, before this runs, so anchors
+// follow the heading text and do not change when sections are renumbered.
+type headingNumberTransformer struct{}
+
+func (headingNumberTransformer) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	var headings []*ast.Heading
+	h1s := 0
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		headings = append(headings, heading)
+		if heading.Level == 1 {
+			h1s++
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	if h1s == 1 {
+		headings = slices.DeleteFunc(headings, func(heading *ast.Heading) bool { return heading.Level == 1 })
+	}
+	if len(headings) == 0 {
+		return
+	}
+	base := 6
+	for _, heading := range headings {
+		base = min(base, heading.Level)
+	}
+
+	var counters [6]int
+	for _, heading := range headings {
+		depth := heading.Level - base
+		counters[depth]++
+		clear(counters[depth+1:])
+		parts := make([]string, depth+1)
+		for i := range parts {
+			parts[i] = strconv.Itoa(counters[i])
+		}
+		// A code string is written as is, so the number gets its own element
+		// to style and to leave out of extracted titles
+		number := ast.NewString([]byte(`<span class="heading-number">` + strings.Join(parts, ".") + `</span> `))
+		number.SetCode(true)
+		heading.InsertBefore(heading, heading.FirstChild(), number)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// codeHighlighter renders fenced code blocks with chroma when PNG_HIGHLIGHT is
+// on. Colors are inline styles, so highlighting works with any theme and the
+// page needs no extra stylesheet. Blocks in a language chroma does not know
+// render as goldmark would without it.
+type codeHighlighter struct {
+	Style string
+	// Detect guesses the language of untagged blocks, highlighting them when
+	// the best lexer scores at least Threshold.
+	Detect    bool
+	Threshold float32
+}
+
+func (h codeHighlighter) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, h.renderFencedCodeBlock)
+}
+
+func (h codeHighlighter) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	language := n.Language(source)
+	var lexer chroma.Lexer
+	if language != nil {
+		lexer = lexers.Get(string(language))
+	} else if h.Detect {
+		lexer = detectLexer(code.String(), h.Threshold)
+	}
+	if lexer != nil {
+		iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+		if err == nil {
+			formatter := chromahtml.New(chromahtml.WithClasses(false))
+			if err := formatter.Format(w, styles.Get(h.Style), iterator); err == nil {
+				return ast.WalkSkipChildren, nil
+			}
+		}
+	}
+
+	_, _ = w.WriteString("<pre><code")
+	if language != nil {
+		_, _ = w.WriteString(` class="language-`)
+		html.DefaultWriter.Write(w, language)
+		_ = w.WriteByte('"')
+	}
+	_ = w.WriteByte('>')
+	html.DefaultWriter.RawWrite(w, code.Bytes())
+	_, _ = w.WriteString("</code></pre>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// isHighlightStyle reports whether chroma has a style called name.
+func isHighlightStyle(name string) bool {
+	_, ok := styles.Registry[strings.ToLower(name)]
+	return ok
+}
+
+// detectLexer returns the lexer whose analysis scores code highest, or nil
+// when none reaches threshold. Few lexers analyse text, so detection mostly
+// recognizes languages with telltale lines such as shebangs or doctypes.
+func detectLexer(code string, threshold float32) chroma.Lexer {
+	var best chroma.Lexer
+	var bestScore float32
+	for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+		analyser, ok := lexer.(chroma.Analyser)
+		if !ok {
+			continue
+		}
+		if score := analyser.AnalyseText(code); score > bestScore {
+			best, bestScore = lexer, score
+		}
+	}
+	if best == nil || bestScore < threshold {
+		return nil
+	}
+	return best
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCodeHighlighter(t *testing.T) {
+	setTestConfig(t, Config{})
+	tests := []struct {
+		name      string
+		source    string
+		detect    bool
+		threshold float32
+		want      string
+		notWant   string
+	}{
+		{
+			name:    "tagged block is highlighted",
+			source:  "```go\nfunc main() {}\n```\n",
+			want:    `<span style=`,
+			notWant: `class="language-go"`,
+		},
+		{
+			name:   "unknown language stays plain",
+			source: "```nosuchlanguage\n<b>x</b>\n```\n",
+			want:   `<pre><code class="language-nosuchlanguage">&lt;b&gt;x&lt;/b&gt;` + "\n</code></pre>",
+		},
+		{
+			name:   "untagged block stays plain without detection",
+			source: "```\n#!/bin/bash\necho hi\n```\n",
+			want:   "<pre><code>#!/bin/bash\necho hi\n</code></pre>",
+		},
+		{
+			name:      "untagged block is detected",
+			source:    "```\n#!/bin/bash\necho hi\n```\n",
+			detect:    true,
+			threshold: 0.5,
+			want:      `<span style=`,
+		},
+		{
+			name:      "guess below the threshold stays plain",
+			source:    "```\nsome words\n```\n",
+			detect:    true,
+			threshold: 0.5,
+			want:      "<pre><code>some words\n</code></pre>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := buildMarkdown(markdownOptions{
+				Highlight:          true,
+				HighlightStyle:     "github",
+				HighlightDetect:    tt.detect,
+				HighlightThreshold: tt.threshold,
+			})
+			var out bytes.Buffer
+			if err := converter.Convert([]byte(tt.source), &out); err != nil {
+				t.Fatal(err)
+			}
+			got := out.String()
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("output %q does not contain %q", got, tt.want)
+			}
+			if tt.notWant != "" && strings.Contains(got, tt.notWant) {
+				t.Errorf("output %q contains %q", got, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestDetectLexer(t *testing.T) {
+	tests := []struct {
+		code      string
+		threshold float32
+		want      string
+	}{
+		{"#!/bin/bash\necho hi\n", 0.5, "Bash"},
+		{"package main\n\nfunc main() { fmt.Println(1) }\n", 0.5, "Go"},
+		{"package main\n", 0.5, ""},
+		{"package main\n", 0.1, "Go"},
+		{"just some prose\n", 0.5, ""},
+		{"#!/bin/bash\necho hi\n", 1.1, ""},
+	}
+	for _, tt := range tests {
+		lexer := detectLexer(tt.code, tt.threshold)
+		got := ""
+		if lexer != nil {
+			got = lexer.Config().Name
+		}
+		if got != tt.want {
+			t.Errorf("detectLexer(%q, %v) = %q, want %q", tt.code, tt.threshold, got, tt.want)
+		}
+	}
+}
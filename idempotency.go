@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyEntry tracks the page created for one Idempotency-Key. done is
+// closed once the upload holding the key has finished.
+type idempotencyEntry struct {
+	done      chan struct{}
+	pageID    string
+	expiresAt time.Time
+}
+
+// idempotencyStore maps client-supplied keys to the pages they created, so a
+// retried upload returns the original page instead of creating a new one.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+var idempotencyKeys = &idempotencyStore{entries: make(map[string]*idempotencyEntry)}
+
+// begin claims key for a new upload and returns an empty page ID, or returns
+// the page ID created by an earlier upload with the same key. Concurrent
+// uploads with the same key wait for the first one to finish.
+func (s *idempotencyStore) begin(key string) (*idempotencyEntry, string) {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		for k, entry := range s.entries {
+			if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		entry, found := s.entries[key]
+		if !found {
+			entry = &idempotencyEntry{done: make(chan struct{})}
+			s.entries[key] = entry
+			s.mu.Unlock()
+			return entry, ""
+		}
+		s.mu.Unlock()
+
+		<-entry.done
+		if entry.pageID != "" {
+			return nil, entry.pageID
+		}
+		// The earlier upload failed and released the key; try to claim it
+	}
+}
+
+// finish records the outcome of an upload started with begin. An empty
+// pageID means the upload failed, so the key can be reused.
+func (s *idempotencyStore) finish(key string, entry *idempotencyEntry, pageID string) {
+	s.mu.Lock()
+	if pageID == "" {
+		delete(s.entries, key)
+	} else {
+		entry.pageID = pageID
+		entry.expiresAt = time.Now().Add(getConfig().IdempotencyTTL)
+	}
+	s.mu.Unlock()
+	close(entry.done)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// PNG_ID_SCHEME values.
+const (
+	idSchemeRandom = "random"
+	idSchemeULID   = "ulid"
+	idSchemeDate   = "date"
+)
+
+// dateIDSuffixLength is the length of the random part of date-prefixed IDs
+// when PNG_ID_LENGTH is not set.
+const dateIDSuffixLength = 8
+
+// IDGenerator produces candidate page IDs. generatePageID takes care of
+// retrying on collisions, so implementations only need to be random enough.
+type IDGenerator interface {
+	Generate() (string, error)
+}
+
+// newIDGenerator returns the generator for PNG_ID_SCHEME.
+func newIDGenerator(cfg Config) (IDGenerator, error) {
+	switch cfg.IDScheme {
+	case idSchemeRandom:
+		return randomIDGenerator{length: cfg.IDLength}, nil
+	case idSchemeULID:
+		return ulidGenerator{}, nil
+	case idSchemeDate:
+		length := cfg.IDLength
+		if length == defaultIDLength {
+			length = dateIDSuffixLength
+		}
+		return dateIDGenerator{suffix: randomIDGenerator{length: length}}, nil
+	default:
+		return nil, fmt.Errorf("must be one of random, ulid, date, got %q", cfg.IDScheme)
+	}
+}
+
+// randomIDGenerator returns 16 hex characters, or length base62 characters
+// when a length is set.
+type randomIDGenerator struct {
+	length int
+}
+
+func (g randomIDGenerator) Generate() (string, error) {
+	if g.length == defaultIDLength {
+		randomBytes := make([]byte, 8)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return "", fmt.Errorf("failed to generate random ID: %w", err)
+		}
+		return hex.EncodeToString(randomBytes), nil
+	}
+
+	id := make([]byte, 0, g.length)
+	randomBytes := make([]byte, g.length*2)
+	for len(id) < g.length {
+		if _, err := rand.Read(randomBytes); err != nil {
+			return "", fmt.Errorf("failed to generate random ID: %w", err)
+		}
+		for _, b := range randomBytes {
+			// Reject values past the largest multiple of 62 to avoid modulo bias
+			if b >= 248 || len(id) == g.length {
+				continue
+			}
+			id = append(id, base62Alphabet[b%62])
+		}
+	}
+	return string(id), nil
+}
+
+// crockfordAlphabet is in ascending byte order, so encoded ULIDs sort like
+// the values they encode.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator returns ULIDs: a 48-bit millisecond timestamp followed by 80
+// random bits, as 26 Crockford base32 characters. They sort lexicographically
+// by creation time, to the millisecond.
+type ulidGenerator struct{}
+
+func (ulidGenerator) Generate() (string, error) {
+	var value [16]byte
+	binary.BigEndian.PutUint64(value[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(value[6:]); err != nil {
+		return "", fmt.Errorf("failed to generate random ID: %w", err)
+	}
+
+	// 128 bits are encoded as 26 characters of 5 bits, the first holding
+	// only the 3 leading bits
+	hi := binary.BigEndian.Uint64(value[:8])
+	lo := binary.BigEndian.Uint64(value[8:])
+	id := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		id[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id), nil
+}
+
+// dateIDGenerator prefixes a random suffix with the UTC creation date, as in
+// 2024-06-01-aZ3kP9xQ.
+type dateIDGenerator struct {
+	suffix IDGenerator
+}
+
+func (g dateIDGenerator) Generate() (string, error) {
+	suffix, err := g.suffix.Generate()
+	if err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("2006-01-02") + "-" + suffix, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// optimizeImage re-encodes a JPEG or PNG asset in place when that makes it
+// smaller, and optionally writes a lossless WebP variant next to it. Any
+// failure leaves the original file untouched.
+//
+// Decoding is where a hostile image costs memory, so images larger than
+// PNG_IMAGE_MAX_SIZE bytes or PNG_IMAGE_MAX_DIMENSION pixels on a side, as
+// read from their header, are skipped before being decoded. Encoding gets
+// PNG_IMAGE_TIMEOUT; past it the results are discarded and nothing is
+// written.
+func optimizeImage(path string) {
+	cfg := getConfig()
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Image optimization skipped for %s: %v", path, err)
+		return
+	}
+	if cfg.ImageMaxSize > 0 && info.Size() > cfg.ImageMaxSize {
+		log.Printf("Image optimization skipped for %s: %d bytes exceeds PNG_IMAGE_MAX_SIZE", path, info.Size())
+		return
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Image optimization skipped for %s: %v", path, err)
+		return
+	}
+	header, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		log.Printf("Image optimization skipped for %s: %v", path, err)
+		return
+	}
+	if cfg.ImageMaxDimension > 0 && (header.Width > cfg.ImageMaxDimension || header.Height > cfg.ImageMaxDimension) {
+		log.Printf("Image optimization skipped for %s: %dx%d exceeds PNG_IMAGE_MAX_DIMENSION", path, header.Width, header.Height)
+		return
+	}
+
+	ctx := context.Background()
+	if cfg.ImageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ImageTimeout)
+		defer cancel()
+	}
+	type result struct {
+		images encodedImages
+		err    error
+	}
+	// The image packages cannot be interrupted, so encoding runs on its own
+	// and is abandoned, rather than waited for, once the timeout passes
+	done := make(chan result, 1)
+	go func() {
+		images, err := encodeImage(original, cfg)
+		done <- result{images: images, err: err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		log.Printf("Image optimization skipped for %s: took longer than PNG_IMAGE_TIMEOUT (%s)", path, cfg.ImageTimeout)
+		return
+	}
+	if res.err != nil {
+		log.Printf("Image optimization skipped for %s: %v", path, res.err)
+		return
+	}
+
+	switch {
+	case res.images.optimizeErr != nil:
+		log.Printf("Image optimization failed for %s: %v", path, res.images.optimizeErr)
+	case res.images.optimized == nil:
+		log.Printf("Kept original %s: re-encoding did not reduce its size (%d bytes)", path, len(original))
+	default:
+		if err := writeFileAtomic(path, res.images.optimized, 0644); err != nil {
+			log.Printf("Image optimization failed for %s: %v", path, err)
+		} else {
+			log.Printf("Optimized %s: %d -> %d bytes", path, len(original), len(res.images.optimized))
+		}
+	}
+
+	if cfg.ImageWebP {
+		if res.images.webpErr != nil {
+			log.Printf("WebP conversion failed for %s: %v", path, res.images.webpErr)
+			return
+		}
+		webpPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".webp"
+		if err := writeFileAtomic(webpPath, res.images.webp, 0644); err != nil {
+			log.Printf("WebP conversion failed for %s: %v", path, err)
+			return
+		}
+		log.Printf("Generated %s: %d bytes", webpPath, len(res.images.webp))
+	}
+}
+
+// encodedImages holds what optimizeImage writes: the re-encoded image, nil
+// when it is not smaller than the original, and the WebP variant when
+// PNG_IMAGE_WEBP is set. Either can fail without the other.
+type encodedImages struct {
+	optimized   []byte
+	optimizeErr error
+	webp        []byte
+	webpErr     error
+}
+
+// encodeImage decodes original and encodes the variants optimizeImage
+// writes, without touching any file. It fails only when original cannot be
+// decoded.
+func encodeImage(original []byte, cfg *Config) (encodedImages, error) {
+	var out encodedImages
+	img, format, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return out, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: cfg.ImageQuality})
+	case "png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	default:
+		return out, fmt.Errorf("unsupported format %s", format)
+	}
+	if err != nil {
+		out.optimizeErr = err
+	} else if _, _, err := image.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		out.optimizeErr = fmt.Errorf("re-encoding produced an unreadable file, keeping original: %w", err)
+	} else if buf.Len() < len(original) {
+		out.optimized = buf.Bytes()
+	}
+
+	if cfg.ImageWebP {
+		var webp bytes.Buffer
+		if err := nativewebp.Encode(&webp, img, nil); err != nil {
+			out.webpErr = err
+		} else {
+			out.webp = webp.Bytes()
+		}
+	}
+	return out, nil
+}
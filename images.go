@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// lazyImageTransformer adds loading="lazy" and decoding="async" to markdown
+// images when PNG_LAZY_IMAGES is enabled. Images written as raw HTML are not
+// part of the AST and are left as the author wrote them.
+type lazyImageTransformer struct{}
+
+func (lazyImageTransformer) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	if !getConfig().LazyImages {
+		return
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := n.(*ast.Image)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if _, ok := img.AttributeString("loading"); !ok {
+			img.SetAttributeString("loading", []byte("lazy"))
+		}
+		if _, ok := img.AttributeString("decoding"); !ok {
+			img.SetAttributeString("decoding", []byte("async"))
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
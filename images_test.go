@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestLazyImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		lazy    bool
+		source  string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "markdown image gets the attributes",
+			lazy:   true,
+			source: "![cat](cat.png)",
+			want:   []string{`<img src="cat.png" alt="cat" loading="lazy" decoding="async">`},
+		},
+		{
+			name:   "every markdown image is covered",
+			lazy:   true,
+			source: "![a](a.png) and [![b](b.png)](https://example.com)",
+			want:   []string{`<img src="a.png" alt="a" loading="lazy" decoding="async">`, `<img src="b.png" alt="b" loading="lazy" decoding="async">`},
+		},
+		{
+			name:    "raw HTML block images are left alone",
+			lazy:    true,
+			source:  "<div><img src=\"raw.png\" loading=\"eager\"></div>",
+			want:    []string{`<img src="raw.png" loading="eager">`},
+			notWant: []string{`decoding="async"`},
+		},
+		{
+			name:    "raw inline images are left alone",
+			lazy:    true,
+			source:  "text <img src=\"raw.png\"> text",
+			want:    []string{`<img src="raw.png">`},
+			notWant: []string{`loading="lazy"`},
+		},
+		{
+			name:    "disabled by default",
+			source:  "![cat](cat.png)",
+			want:    []string{`<img src="cat.png" alt="cat">`},
+			notWant: []string{`loading=`, `decoding=`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, Config{LazyImages: tt.lazy})
+			var out bytes.Buffer
+			if err := buildMarkdown(markdownOptions{Unsafe: true}).Convert([]byte(tt.source), &out); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output %q does not contain %q", out.String(), want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("output %q contains %q", out.String(), notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestLazyImagesKeepExistingLoading(t *testing.T) {
+	setTestConfig(t, Config{LazyImages: true})
+	source := []byte("![cat](cat.png)")
+	doc := parser.NewParser(parser.WithBlockParsers(parser.DefaultBlockParsers()...),
+		parser.WithInlineParsers(parser.DefaultInlineParsers()...)).Parse(text.NewReader(source))
+	var img *ast.Image
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if i, ok := n.(*ast.Image); ok && entering {
+			img = i
+		}
+		return ast.WalkContinue, nil
+	})
+	img.SetAttributeString("loading", []byte("eager"))
+
+	lazyImageTransformer{}.Transform(doc.(*ast.Document), text.NewReader(source), parser.NewContext())
+	if loading, _ := img.AttributeString("loading"); string(loading.([]byte)) != "eager" {
+		t.Errorf("loading = %q, want the existing eager", loading)
+	}
+	if decoding, ok := img.AttributeString("decoding"); !ok || string(decoding.([]byte)) != "async" {
+		t.Errorf("decoding = %v, want async", decoding)
+	}
+}
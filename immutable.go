@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// immutableDirName is the top-level path of the content-addressed page URLs,
+// /p/<id>-<hash>/, whose content never changes.
+const immutableDirName = "p"
+
+const renderHashLength = 12
+
+// hashRenderedPage returns the hash of what a page serves: its index.html and
+// the HTML of its additional files, as written in folderPath.
+func hashRenderedPage(folderPath string, files []string) (string, error) {
+	hash := sha256.New()
+	names := []string{"index.html"}
+	for _, name := range files {
+		names = append(names, pageFileHTMLName(name))
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(folderPath, name))
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(name + "\x00"))
+		hash.Write(data)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:renderHashLength], nil
+}
+
+// immutablePath is the public path of a page's current content, or "" for
+// pages rendered before render hashes were stored.
+func immutablePath(pageID, renderHash string) string {
+	if renderHash == "" {
+		return ""
+	}
+	return sitePath("/" + immutableDirName + "/" + pageID + "-" + renderHash + "/")
+}
+
+// handleImmutablePage serves /p/<id>-<hash>/ and the additional files and
+// preview image below it with a long-lived immutable Cache-Control, for CDNs.
+// Once the page changes, the old hash redirects to the current one. Assets
+// are not versioned, so they redirect to their mutable URL.
+func handleImmutablePage(c *gin.Context) {
+	pageID, hash, ok := cutLast(c.Param("version"), "-")
+	if !ok || len(hash) != renderHashLength || !isValidPageID(pageID) {
+		renderNotFound(c)
+		return
+	}
+	name := strings.TrimPrefix(c.Param("file"), "/")
+	if strings.HasPrefix(name, assetsDirName+"/") {
+		c.Redirect(http.StatusFound, pagePath(pageID)+name)
+		return
+	}
+
+	// The page is locked so it cannot change between the hash check and the
+	// read, which would cache new content under the old URL
+	unlock := lockPageMeta(pageID)
+	meta, err := readPageMeta(pageID)
+	if err != nil || meta.RenderHash == "" {
+		unlock()
+		renderMissingPage(c, pageID)
+		return
+	}
+	if meta.RenderHash != hash {
+		unlock()
+		c.Redirect(http.StatusFound, immutablePath(pageID, meta.RenderHash)+name)
+		return
+	}
+	var htmlNames []string
+	for _, file := range meta.Files {
+		htmlNames = append(htmlNames, pageFileHTMLName(file))
+	}
+	switch {
+	case name == "":
+		name = "index.html"
+	case name == "index.html" || name == ogImageFileName || slices.Contains(htmlNames, name):
+	default:
+		unlock()
+		renderNotFound(c)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join("public", pageID, name))
+	unlock()
+	if err != nil {
+		renderNotFound(c)
+		return
+	}
+
+	if policy := pageCSP(meta); policy != "" && name != ogImageFileName {
+		c.Header("Content-Security-Policy", policy)
+	}
+	c.Header("Cache-Control", cacheControlImmutable)
+	http.ServeContent(c.Writer, c.Request, name, meta.UpdatedAt, bytes.NewReader(data))
+}
+
+// cutLast is strings.Cut around the last occurrence of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Formats accepted by GET /api/pages/export.
+const (
+	indexFormatCSV  = "csv"
+	indexFormatJSON = "json"
+)
+
+// indexColumns are the columns of the page index export, in their default
+// order.
+var indexColumns = []string{"id", "title", "type", "tags", "createdAt", "updatedAt", "size", "views"}
+
+// indexValue returns one column of a page, as written in the JSON export.
+func indexValue(column, pageID string, meta PageMeta) any {
+	switch column {
+	case "id":
+		return pageID
+	case "title":
+		return meta.Title
+	case "type":
+		return meta.Type
+	case "tags":
+		return nonNilTags(meta.Tags)
+	case "createdAt":
+		return meta.CreatedAt.UTC().Format(time.RFC3339)
+	case "updatedAt":
+		return meta.UpdatedAt.UTC().Format(time.RFC3339)
+	case "size":
+		size, err := folderSize(filepath.Join("public", pageID))
+		if err != nil {
+			log.Printf("Error computing size of %s: %v", pageID, err)
+		}
+		return size
+	case "views":
+		return pageViews.get(pageID)
+	}
+	return nil
+}
+
+// nonNilTags never returns nil, so pages without tags export [] rather than
+// null.
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// csvCell formats a value for the CSV export. Tags are joined with commas,
+// and text that a spreadsheet would run as a formula is prefixed with a
+// quote.
+func csvCell(value any) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	}
+	return ""
+}
+
+// parseIndexColumns reads the comma-separated columns query parameter, which
+// defaults to every column.
+func parseIndexColumns(query string) ([]string, bool) {
+	if strings.TrimSpace(query) == "" {
+		return indexColumns, true
+	}
+	var columns []string
+	for _, column := range strings.Split(query, ",") {
+		column = strings.TrimSpace(column)
+		if !slices.Contains(indexColumns, column) || slices.Contains(columns, column) {
+			return nil, false
+		}
+		columns = append(columns, column)
+	}
+	return columns, true
+}
+
+// handleExportIndex downloads the metadata of every page as CSV or JSON, for
+// reporting. Rows are written as the public directory is read rather than
+// collected first, so large sites are streamed. Unlike GET /api/pages, drafts
+// and private pages are included.
+func handleExportIndex(c *gin.Context) {
+	format := c.DefaultQuery("format", indexFormatCSV)
+	if format != indexFormatCSV && format != indexFormatJSON {
+		respondError(c, http.StatusBadRequest, codeInvalidQuery, "format must be csv or json")
+		return
+	}
+	columns, ok := parseIndexColumns(c.Query("columns"))
+	if !ok {
+		respondError(c, http.StatusBadRequest, codeInvalidQuery, "columns must be distinct names among "+strings.Join(indexColumns, ", "))
+		return
+	}
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		log.Printf("Error reading public directory: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list pages")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="pages.`+format+`"`)
+	if format == indexFormatCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	var writeRow func(pageID string, meta PageMeta) error
+	finish := func() error { return nil }
+	if format == indexFormatCSV {
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.Write(columns); err != nil {
+			return
+		}
+		writeRow = func(pageID string, meta PageMeta) error {
+			row := make([]string, len(columns))
+			for i, column := range columns {
+				row[i] = csvCell(indexValue(column, pageID, meta))
+			}
+			return writer.Write(row)
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		// Objects are written by hand to keep the columns in the requested order
+		first := true
+		c.Writer.WriteString("[")
+		writeRow = func(pageID string, meta PageMeta) error {
+			var row strings.Builder
+			if !first {
+				row.WriteString(",")
+			}
+			first = false
+			row.WriteString("\n{")
+			for i, column := range columns {
+				value, err := json.Marshal(indexValue(column, pageID, meta))
+				if err != nil {
+					return err
+				}
+				if i > 0 {
+					row.WriteString(",")
+				}
+				row.WriteString(strconv.Quote(column) + ":")
+				row.Write(value)
+			}
+			row.WriteString("}")
+			_, err := c.Writer.WriteString(row.String())
+			return err
+		}
+		finish = func() error {
+			_, err := c.Writer.WriteString("\n]\n")
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if !isPageDir(entry) {
+			continue
+		}
+		meta, err := readPageMeta(entry.Name())
+		if err != nil {
+			log.Printf("Error reading metadata for %s: %v", entry.Name(), err)
+			continue
+		}
+		if err := writeRow(entry.Name(), meta); err != nil {
+			log.Printf("Error writing page index export: %v", err)
+			return
+		}
+	}
+	if err := finish(); err != nil {
+		log.Printf("Error writing page index export: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseAllowlist parses PNG_ADMIN_IP_ALLOWLIST entries, accepting CIDR ranges
+// as well as single addresses.
+func parseAllowlist(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q is neither an IP address nor a CIDR range", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR range", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// adminIPAllowed rejects requests to the panel and the API from clients
+// outside PNG_ADMIN_IP_ALLOWLIST, before any authentication. The client IP
+// comes from ClientIP(), so X-Forwarded-For only counts when sent by one of
+// PNG_TRUSTED_PROXIES.
+func adminIPAllowed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowlist := getConfig().adminAllowlist
+		if len(allowlist) == 0 {
+			c.Next()
+			return
+		}
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err == nil {
+			addr = addr.Unmap()
+			for _, prefix := range allowlist {
+				if prefix.Contains(addr) {
+					c.Next()
+					return
+				}
+			}
+		}
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Access from this address is not allowed")
+	}
+}
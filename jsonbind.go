@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// jsonTooDeepError is returned by bindJSON for bodies nested deeper than
+// PNG_MAX_JSON_DEPTH.
+type jsonTooDeepError struct{ limit int }
+
+func (e jsonTooDeepError) Error() string {
+	return fmt.Sprintf("Request body is nested too deeply: at most %d levels are allowed", e.limit)
+}
+
+// bindJSON is ShouldBindJSON with the PNG_STRICT_JSON and PNG_MAX_JSON_DEPTH
+// checks applied. In strict mode fields the target does not declare are
+// rejected instead of silently ignored.
+func bindJSON(c *gin.Context, obj any) error {
+	cfg := getConfig()
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	if cfg.MaxJSONDepth > 0 && jsonDepth(body) > cfg.MaxJSONDepth {
+		return jsonTooDeepError{limit: cfg.MaxJSONDepth}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if cfg.StrictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// jsonDepth returns the deepest object or array nesting in a JSON document,
+// ignoring brackets inside strings. It does not validate the document.
+func jsonDepth(data []byte) int {
+	depth, deepest := 0, 0
+	inString, escaped := false, false
+	for _, b := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			depth++
+			deepest = max(deepest, depth)
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return deepest
+}
+
+// unknownJSONField extracts the field name from the error returned by a
+// decoder with DisallowUnknownFields, which has no dedicated type.
+func unknownJSONField(err error) (string, bool) {
+	field, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	return strings.Trim(field, `"`), ok
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	stdhtml "html"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// isLanguageTag reports whether tag is a BCP 47 language tag, with the same
+// check the lang field of uploads gets.
+func isLanguageTag(tag string) bool {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	return ok && v.Var(tag, "bcp47_language_tag") == nil
+}
+
+// htmlStartTag opens a rendered markdown or text page with the upload's
+// language and text direction, else PNG_DEFAULT_LANG and PNG_DEFAULT_DIR.
+func htmlStartTag(req UploadRequest) string {
+	cfg := getConfig()
+	tag := fmt.Sprintf(`<html lang="%s"`, stdhtml.EscapeString(cmp.Or(req.Lang, cfg.DefaultLang)))
+	if dir := cmp.Or(req.Dir, cfg.DefaultDir); dir != "" {
+		tag += fmt.Sprintf(` dir="%s"`, dir)
+	}
+	return tag + ">"
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// anyLinkScheme in PNG_LINK_SCHEMES turns the allowlist off.
+const anyLinkScheme = "*"
+
+var linkSchemePattern = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// linkScheme returns the lowercased scheme of a link destination, or "" for
+// relative links. Whitespace and control characters are dropped first, as
+// browsers ignore them and "java\tscript:" would otherwise slip through.
+func linkScheme(destination string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, destination)
+	scheme, _, found := strings.Cut(cleaned, ":")
+	scheme = strings.ToLower(scheme)
+	if !found || !linkSchemePattern.MatchString(scheme) {
+		return ""
+	}
+	return scheme
+}
+
+func linkSchemeAllowed(destination string) bool {
+	schemes := getConfig().LinkSchemes
+	if slices.Contains(schemes, anyLinkScheme) {
+		return true
+	}
+	scheme := linkScheme(destination)
+	return scheme == "" || slices.Contains(schemes, scheme)
+}
+
+// linkSchemeTransformer enforces PNG_LINK_SCHEMES on markdown links, images
+// and autolinks. A link with a disallowed scheme is replaced by its text and an
+// image by its alt text. Raw HTML is not part of the AST and is left alone.
+type linkSchemeTransformer struct{}
+
+func (linkSchemeTransformer) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+	var rejected []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Link:
+			if !linkSchemeAllowed(string(node.Destination)) {
+				rejected = append(rejected, node)
+			}
+		case *ast.Image:
+			if !linkSchemeAllowed(string(node.Destination)) {
+				rejected = append(rejected, node)
+			}
+		case *ast.AutoLink:
+			url := string(node.URL(source))
+			if node.AutoLinkType == ast.AutoLinkEmail {
+				// The renderer adds the scheme to email autolinks
+				url = "mailto:" + url
+			}
+			if !linkSchemeAllowed(url) {
+				rejected = append(rejected, node)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// The tree is only modified once the walk is over
+	for _, node := range rejected {
+		parent := node.Parent()
+		if autoLink, ok := node.(*ast.AutoLink); ok {
+			parent.ReplaceChild(parent, node, ast.NewString(autoLink.Label(source)))
+			continue
+		}
+		for child := node.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			parent.InsertBefore(parent, node, child)
+			child = next
+		}
+		parent.RemoveChild(parent, node)
+	}
+}
@@ -2,24 +2,38 @@ package main
 
 import (
 	"bytes"
-	"crypto/rand"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	stdhtml "html"
+	"html/template"
 	"log"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
-	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
 	"github.com/spf13/viper"
-	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
+	gmmeta "github.com/yuin/goldmark-meta"
+	"golang.org/x/image/font/opentype"
 )
 
 // --- Structs ---
@@ -27,127 +41,652 @@ import (
 type Config struct {
 	Username string `mapstructure:"PNG_USERNAME"`
 	Password string `mapstructure:"PNG_PASSWORD"`
+
+	MinPasswordLength int  `mapstructure:"PNG_MIN_PASSWORD_LENGTH"`
+	StrictPassword    bool `mapstructure:"PNG_STRICT_PASSWORD"`
+
+	BasicAuth bool `mapstructure:"PNG_BASIC_AUTH"`
+
+	LogoutRedirect string `mapstructure:"PNG_LOGOUT_REDIRECT"`
+	LogoutGET      bool   `mapstructure:"PNG_LOGOUT_GET"`
+
+	SessionTTL  time.Duration `mapstructure:"PNG_SESSION_TTL"`
+	RememberTTL time.Duration `mapstructure:"PNG_REMEMBER_TTL"`
+	IdleTimeout time.Duration `mapstructure:"PNG_IDLE_TIMEOUT"`
+
+	ACMEDomains  []string `mapstructure:"PNG_ACME_DOMAINS"`
+	ACMEEmail    string   `mapstructure:"PNG_ACME_EMAIL"`
+	ACMECacheDir string   `mapstructure:"PNG_ACME_CACHE_DIR"`
+
+	CookieName     string `mapstructure:"PNG_COOKIE_NAME"`
+	CookieSecure   bool   `mapstructure:"PNG_COOKIE_SECURE"`
+	CookieSameSite string `mapstructure:"PNG_COOKIE_SAMESITE"`
+	CookieDomain   string `mapstructure:"PNG_COOKIE_DOMAIN"`
+
+	CookieHashKey  string   `mapstructure:"PNG_COOKIE_HASH_KEY"`
+	CookieBlockKey string   `mapstructure:"PNG_COOKIE_BLOCK_KEY"`
+	CookieKeys     []string `mapstructure:"PNG_COOKIE_KEYS"`
+
+	ReadingWPM int `mapstructure:"PNG_READING_WPM"`
+
+	OGImage      bool   `mapstructure:"PNG_OG_IMAGE"`
+	OGBackground string `mapstructure:"PNG_OG_BACKGROUND"`
+	OGAccent     string `mapstructure:"PNG_OG_ACCENT"`
+	OGFont       string `mapstructure:"PNG_OG_FONT"`
+
+	NotFoundPage    string `mapstructure:"PNG_404_PAGE"`
+	ServerErrorPage string `mapstructure:"PNG_500_PAGE"`
+
+	AssetCacheMaxAge time.Duration `mapstructure:"PNG_ASSET_CACHE_MAX_AGE"`
+	AssetCSP         string        `mapstructure:"PNG_ASSET_CSP"`
+
+	LoginTemplate string `mapstructure:"PNG_LOGIN_TEMPLATE"`
+	LogoURL       string `mapstructure:"PNG_LOGO_URL"`
+	BrandColor    string `mapstructure:"PNG_BRAND_COLOR"`
+
+	MaxPages      int   `mapstructure:"PNG_MAX_PAGES"`
+	MaxPagesKeep  int   `mapstructure:"PNG_MAX_PAGES_KEEP"`
+	MaxVersions   int   `mapstructure:"PNG_MAX_VERSIONS"`
+	MaxUploadSize int64 `mapstructure:"PNG_MAX_UPLOAD_SIZE"`
+
+	AllowSetup bool   `mapstructure:"PNG_ALLOW_SETUP"`
+	SetupFile  string `mapstructure:"PNG_SETUP_FILE"`
+
+	CreatePublicDir bool `mapstructure:"PNG_CREATE_PUBLIC_DIR"`
+	AutoRepair      bool `mapstructure:"PNG_AUTO_REPAIR"`
+	CompressSources bool `mapstructure:"PNG_COMPRESS_SOURCES"`
+
+	StrictJSON   bool `mapstructure:"PNG_STRICT_JSON"`
+	MaxJSONDepth int  `mapstructure:"PNG_MAX_JSON_DEPTH"`
+
+	AllowBinaryHTML bool `mapstructure:"PNG_ALLOW_BINARY_HTML"`
+
+	BaseURL    string `mapstructure:"PNG_BASE_URL"`
+	PathPrefix string `mapstructure:"PNG_PATH_PREFIX"`
+
+	TrailingSlash string `mapstructure:"PNG_TRAILING_SLASH"`
+
+	PublicRead bool `mapstructure:"PNG_PUBLIC_READ"`
+
+	MaxAssetSize     int64 `mapstructure:"PNG_MAX_ASSET_SIZE"`
+	UploadBufferSize int   `mapstructure:"PNG_UPLOAD_BUFFER_SIZE"`
+	OptimizeImages   bool  `mapstructure:"PNG_OPTIMIZE_IMAGES"`
+	ImageQuality     int   `mapstructure:"PNG_IMAGE_QUALITY"`
+	ImageWebP        bool  `mapstructure:"PNG_IMAGE_WEBP"`
+	// ImageMaxSize, ImageMaxDimension and ImageTimeout bound the work spent
+	// optimizing one image; larger or slower images are stored as uploaded.
+	ImageMaxSize      int64         `mapstructure:"PNG_IMAGE_MAX_SIZE"`
+	ImageMaxDimension int           `mapstructure:"PNG_IMAGE_MAX_DIMENSION"`
+	ImageTimeout      time.Duration `mapstructure:"PNG_IMAGE_TIMEOUT"`
+
+	ReadOnly bool `mapstructure:"PNG_READONLY"`
+
+	RequireConfirm bool `mapstructure:"PNG_REQUIRE_CONFIRM"`
+
+	RequestTimeout     time.Duration `mapstructure:"PNG_REQUEST_TIMEOUT"`
+	ServerReadTimeout  time.Duration `mapstructure:"PNG_SERVER_READ_TIMEOUT"`
+	ServerWriteTimeout time.Duration `mapstructure:"PNG_SERVER_WRITE_TIMEOUT"`
+	ServerIdleTimeout  time.Duration `mapstructure:"PNG_SERVER_IDLE_TIMEOUT"`
+
+	TrustedProxies []string `mapstructure:"PNG_TRUSTED_PROXIES"`
+
+	ForceHTTPS        bool          `mapstructure:"PNG_FORCE_HTTPS"`
+	ForceHTTPSExclude []string      `mapstructure:"PNG_FORCE_HTTPS_EXCLUDE"`
+	HSTSMaxAge        time.Duration `mapstructure:"PNG_HSTS_MAX_AGE"`
+
+	AdminIPAllowlist []string `mapstructure:"PNG_ADMIN_IP_ALLOWLIST"`
+
+	RateLimit            float64  `mapstructure:"PNG_RATE_LIMIT"`
+	RateLimitBurst       int      `mapstructure:"PNG_RATE_LIMIT_BURST"`
+	RateLimitExemptPaths []string `mapstructure:"PNG_RATE_LIMIT_EXEMPT_PATHS"`
+	RateLimitExemptIPs   []string `mapstructure:"PNG_RATE_LIMIT_EXEMPT_IPS"`
+
+	CORSOrigins []string `mapstructure:"PNG_CORS_ORIGINS"`
+
+	PageCSP      string `mapstructure:"PNG_PAGE_CSP"`
+	HTMLPageCSP  string `mapstructure:"PNG_HTML_PAGE_CSP"`
+	DashboardCSP string `mapstructure:"PNG_DASHBOARD_CSP"`
+
+	RenderTimeout   time.Duration `mapstructure:"PNG_RENDER_TIMEOUT"`
+	MaxRenderedSize int           `mapstructure:"PNG_MAX_RENDERED_SIZE"`
+
+	FetchTimeout time.Duration `mapstructure:"PNG_FETCH_TIMEOUT"`
+
+	PDFRenderer string        `mapstructure:"PNG_PDF_RENDERER"`
+	PDFCommand  string        `mapstructure:"PNG_PDF_COMMAND"`
+	PDFTimeout  time.Duration `mapstructure:"PNG_PDF_TIMEOUT"`
+
+	GitImport         bool          `mapstructure:"PNG_GIT_IMPORT"`
+	GitCommand        string        `mapstructure:"PNG_GIT_COMMAND"`
+	GitTimeout        time.Duration `mapstructure:"PNG_GIT_TIMEOUT"`
+	GitImportMaxFiles int           `mapstructure:"PNG_GIT_IMPORT_MAX_FILES"`
+
+	MaxConcurrentUploads int           `mapstructure:"PNG_MAX_CONCURRENT_UPLOADS"`
+	UploadQueueTimeout   time.Duration `mapstructure:"PNG_UPLOAD_QUEUE_TIMEOUT"`
+
+	APIDocsPublic bool `mapstructure:"PNG_API_DOCS_PUBLIC"`
+
+	IdempotencyTTL time.Duration `mapstructure:"PNG_IDEMPOTENCY_TTL"`
+
+	DebugTimings  bool `mapstructure:"PNG_DEBUG_TIMINGS"`
+	SlowRequestMS int  `mapstructure:"PNG_SLOW_REQUEST_MS"`
+
+	RequestIDHeader string `mapstructure:"PNG_REQUEST_ID_HEADER"`
+	TraceParent     bool   `mapstructure:"PNG_TRACEPARENT"`
+
+	Dedupe bool `mapstructure:"PNG_DEDUPE"`
+
+	AuditLog        string `mapstructure:"PNG_AUDIT_LOG"`
+	AuditLogMaxSize int64  `mapstructure:"PNG_AUDIT_LOG_MAX_SIZE"`
+
+	IDLength       int    `mapstructure:"PNG_ID_LENGTH"`
+	MaxSlugLength  int    `mapstructure:"PNG_MAX_SLUG_LENGTH"`
+	SlugCheckLimit int    `mapstructure:"PNG_SLUG_CHECK_LIMIT"`
+	IDScheme       string `mapstructure:"PNG_ID_SCHEME"`
+
+	IgnoredDirs []string `mapstructure:"PNG_IGNORED_DIRS"`
+
+	Minify bool `mapstructure:"PNG_MINIFY"`
+
+	MaxTags      int `mapstructure:"PNG_MAX_TAGS"`
+	MaxTagLength int `mapstructure:"PNG_MAX_TAG_LENGTH"`
+
+	Timezone string `mapstructure:"PNG_TIMEZONE"`
+
+	DefaultTheme string `mapstructure:"PNG_DEFAULT_THEME"`
+	DefaultLang  string `mapstructure:"PNG_DEFAULT_LANG"`
+	DefaultDir   string `mapstructure:"PNG_DEFAULT_DIR"`
+	DefaultType  string `mapstructure:"PNG_DEFAULT_TYPE"`
+	// AllowedTypes are the upload types accepted. There is a single user, so
+	// it applies to whoever may publish: the logged-in user, or anyone when
+	// authentication is disabled.
+	AllowedTypes []string `mapstructure:"PNG_ALLOWED_TYPES"`
+
+	ViewCounts         bool          `mapstructure:"PNG_VIEW_COUNTS"`
+	ViewsFile          string        `mapstructure:"PNG_VIEWS_FILE"`
+	ViewsFlushInterval time.Duration `mapstructure:"PNG_VIEWS_FLUSH_INTERVAL"`
+
+	DeletedPagesFile string `mapstructure:"PNG_DELETED_PAGES_FILE"`
+	RedirectsFile    string `mapstructure:"PNG_REDIRECTS_FILE"`
+
+	LazyImages            bool   `mapstructure:"PNG_LAZY_IMAGES"`
+	HeadingIDPrefix       string `mapstructure:"PNG_HEADING_ID_PREFIX"`
+	HardWraps             bool   `mapstructure:"PNG_HARD_WRAPS"`
+	NumberHeadings        bool   `mapstructure:"PNG_NUMBER_HEADINGS"`
+	TOC                   bool   `mapstructure:"PNG_TOC"`
+	TOCMinLevel           int    `mapstructure:"PNG_TOC_MIN_LEVEL"`
+	TOCMaxLevel           int    `mapstructure:"PNG_TOC_MAX_LEVEL"`
+	MarkdownUnsafe        bool   `mapstructure:"PNG_MARKDOWN_UNSAFE"`
+	MarkdownUnsafeAllowed bool   `mapstructure:"PNG_MARKDOWN_UNSAFE_ALLOWED"`
+	MarkdownEmoji         bool   `mapstructure:"PNG_MARKDOWN_EMOJI"`
+	MarkdownTables        bool   `mapstructure:"PNG_MARKDOWN_TABLES"`
+	MarkdownStrikethrough bool   `mapstructure:"PNG_MARKDOWN_STRIKETHROUGH"`
+	MarkdownLinkify       bool   `mapstructure:"PNG_MARKDOWN_LINKIFY"`
+	MarkdownTaskLists     bool   `mapstructure:"PNG_MARKDOWN_TASK_LISTS"`
+	MarkdownAttributes    bool   `mapstructure:"PNG_MARKDOWN_ATTRIBUTES"`
+	Highlight             bool   `mapstructure:"PNG_HIGHLIGHT"`
+	HighlightStyle        string `mapstructure:"PNG_HIGHLIGHT_STYLE"`
+	HighlightDetect       bool   `mapstructure:"PNG_HIGHLIGHT_DETECT"`
+	// HighlightDetectThreshold is the score, from 0 to 1, an untagged block's
+	// guessed language needs before it is highlighted.
+	HighlightDetectThreshold float64  `mapstructure:"PNG_HIGHLIGHT_DETECT_THRESHOLD"`
+	InteractiveTasks         bool     `mapstructure:"PNG_INTERACTIVE_TASKS"`
+	LinkSchemes              []string `mapstructure:"PNG_LINK_SCHEMES"`
+	HeadingAnchors           bool     `mapstructure:"PNG_HEADING_ANCHORS"`
+
+	CustomHead     string `mapstructure:"PNG_CUSTOM_HEAD"`
+	CustomHeadFile string `mapstructure:"PNG_CUSTOM_HEAD_FILE"`
+
+	PageFooter      string `mapstructure:"PNG_PAGE_FOOTER"`
+	SiteTitle       string `mapstructure:"PNG_SITE_TITLE"`
+	ArticleTag      string `mapstructure:"PNG_ARTICLE_TAG"`
+	ArticleClass    string `mapstructure:"PNG_ARTICLE_CLASS"`
+	PageAttribution bool   `mapstructure:"PNG_PAGE_ATTRIBUTION"`
+
+	BacklinksFooter bool `mapstructure:"PNG_BACKLINKS_FOOTER"`
+
+	RootMode string `mapstructure:"PNG_ROOT_MODE"`
+	RootFile string `mapstructure:"PNG_ROOT_FILE"`
+
+	RobotsTxt     string `mapstructure:"PNG_ROBOTS_TXT"`
+	RobotsTxtFile string `mapstructure:"PNG_ROBOTS_TXT_FILE"`
+	SitemapURL    string `mapstructure:"PNG_SITEMAP_URL"`
+
+	PageCacheEntries int   `mapstructure:"PNG_PAGE_CACHE_ENTRIES"`
+	PageCacheBytes   int64 `mapstructure:"PNG_PAGE_CACHE_BYTES"`
+
+	// Derived from PNG_ADMIN_IP_ALLOWLIST, PNG_RATE_LIMIT_EXEMPT_IPS,
+	// PNG_CORS_ORIGINS, PNG_ID_SCHEME, PNG_PDF_RENDERER and PNG_TIMEZONE by
+	// readConfig
+	adminAllowlist  []netip.Prefix
+	rateLimitExempt []netip.Prefix
+	corsOrigins     []string
+	idGenerator     IDGenerator
+	pdfRenderer     PDFRenderer
+	location        *time.Location
+
+	// Loaded from the files and snippets referenced above by loadConfig
+	customHead      *template.Template
+	pageFooter      *template.Template
+	notFoundPage    []byte
+	serverErrorPage []byte
+	rootPage        []byte
+	robotsTxt       []byte
+	ogFont          *opentype.Font
 }
 
 type UploadRequest struct {
-	Content  string `json:"content"   binding:"required"`
-	Type     string `json:"type"      binding:"required"`
-	ThemeCSS string `json:"themeCSS"`
+	Content string `json:"content"   binding:"required_without=Files"`
+	// Type defaults to PNG_DEFAULT_TYPE when empty.
+	Type string   `json:"type"      binding:"omitempty,oneof=markdown html text"`
+	Tags []string `json:"tags"`
+	// ThemeCSS is embedded in markdown and text pages; an empty string means
+	// no styling. Without it, Theme selects a built-in theme, and without
+	// either PNG_DEFAULT_THEME applies.
+	ThemeCSS *string `json:"themeCSS"`
+	Theme    string  `json:"theme"     binding:"omitempty,oneof=github blueprint win98"`
+	// Lang and Dir set the <html> attributes of markdown and text pages,
+	// defaulting to PNG_DEFAULT_LANG and PNG_DEFAULT_DIR.
+	Lang string `json:"lang" binding:"omitempty,bcp47_language_tag"`
+	Dir  string `json:"dir"  binding:"omitempty,oneof=ltr rtl auto"`
+	// Title, Description, Author and Draft override the markdown front
+	// matter.
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Author      string `json:"author"`
+	Draft       *bool  `json:"draft"`
+	// OGType and TwitterCard pick the link preview of markdown and text
+	// pages, defaulting to an article with a large image card when
+	// PNG_OG_IMAGE gives it an image.
+	OGType      string `json:"ogType"      binding:"omitempty,oneof=article website"`
+	TwitterCard string `json:"twitterCard" binding:"omitempty,oneof=summary summary_large_image"`
+	// Visibility overrides Draft: unlisted pages are served but not listed
+	// publicly.
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public unlisted draft"`
+	// ForceNew publishes a new page even if PNG_DEDUPE finds a duplicate.
+	ForceNew bool `json:"forceNew"`
+	// HardWraps overrides PNG_HARD_WRAPS for this page.
+	HardWraps *bool `json:"hardWraps"`
+	// NumberHeadings overrides PNG_NUMBER_HEADINGS for this page.
+	NumberHeadings *bool `json:"numberHeadings"`
+	// TOC, TOCMinLevel and TOCMaxLevel override PNG_TOC, PNG_TOC_MIN_LEVEL
+	// and PNG_TOC_MAX_LEVEL for this page.
+	TOC         *bool `json:"toc"`
+	TOCMinLevel *int  `json:"tocMinLevel" binding:"omitempty,min=1,max=6"`
+	TOCMaxLevel *int  `json:"tocMaxLevel" binding:"omitempty,min=1,max=6"`
+	// AllowRawHTML overrides PNG_MARKDOWN_UNSAFE for this page, within the
+	// limit set by PNG_MARKDOWN_UNSAFE_ALLOWED.
+	AllowRawHTML *bool `json:"allowRawHTML"`
+	// HeadHTML and FooterHTML are raw HTML added to the <head> and after the
+	// content of this markdown or text page only, where raw HTML is enabled.
+	HeadHTML   string `json:"headHTML"`
+	FooterHTML string `json:"footerHTML"`
+	// Wrap is "fragment" to store markdown and text pages as their content
+	// element only, for embedding, rather than a full document.
+	Wrap string `json:"wrap" binding:"omitempty,oneof=full fragment"`
+	// Slug publishes the page under this ID instead of a generated one. An
+	// existing page with that ID is only replaced when Overwrite is set.
+	Slug      string `json:"slug"`
+	Overwrite bool   `json:"overwrite"`
+	// Files are additional documents of the same type, keyed by file name,
+	// each rendered to its own HTML file in the page folder. An index file
+	// such as index.md stands in for Content.
+	Files map[string]string `json:"files"`
 }
 
 type Page struct {
-	ID        string    `json:"id"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID          string    `json:"id"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	Type        string    `json:"type,omitempty"`
+	Draft       bool      `json:"draft,omitempty"`
+	Visibility  string    `json:"visibility"`
+	Pinned      bool      `json:"pinned,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Tags        []string  `json:"tags"`
+	// ReadingMinutes is only set for markdown pages.
+	ReadingMinutes int `json:"readingMinutes,omitempty"`
+	// Files lists the additional files of a multi-file page.
+	Files []string `json:"files,omitempty"`
+	// Wrap is "fragment" for pages stored without the document around them.
+	Wrap string `json:"wrap,omitempty"`
+	// Views is omitted when PNG_VIEW_COUNTS is off or nobody viewed the page.
+	Views int64 `json:"views,omitempty"`
+	// ImmutableURL serves the current content with a long-lived cache; it
+	// changes whenever the page does.
+	ImmutableURL string `json:"immutableUrl,omitempty"`
+	// SizeBytes is the total size of the page folder, assets included.
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+	// CreatedAgo and UpdatedAgo are only set with ?timeFormat=relative.
+	CreatedAgo string `json:"createdAgo,omitempty"`
+	UpdatedAgo string `json:"updatedAgo,omitempty"`
 }
 
+// errInvalidContent marks page write failures caused by the submitted
+// content rather than by the server.
+var errInvalidContent = errors.New("invalid content")
+
 // --- Global Variables ---
 
 var (
-	appConfig     Config
-	md            goldmark.Markdown
-	cookieHandler *securecookie.SecureCookie
+	cookieCodecs []securecookie.Codec
+
+	// pageCreateMu serializes the checks made before creating a page, the
+	// creation itself and the pruning after it, so concurrent uploads cannot
+	// exceed PNG_MAX_PAGES, publish the same content twice with PNG_DEDUPE or
+	// prune too much with PNG_MAX_PAGES_KEEP.
+	pageCreateMu sync.Mutex
 )
 
 // --- Initialization ---
 
-func init() {
-	// Initialize Goldmark Markdown converter
-	md = goldmark.New(
-		goldmark.WithExtensions(extension.GFM),
-		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
-		goldmark.WithRendererOptions(html.WithHardWraps(), html.WithUnsafe()),
-	)
-
-	// Initialize secure cookie handler
-	hashKey := securecookie.GenerateRandomKey(64)
-	blockKey := securecookie.GenerateRandomKey(32)
-	cookieHandler = securecookie.New(hashKey, blockKey)
-}
-
 func main() {
-	// Load configuration
+	info := buildInfo()
+	log.Printf("press-n-go %s (commit %s, built %s, %s)", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+
+	// Load configuration, along with the files it references
 	LoadConfig()
+	cfg := getConfig()
 
-	// Ensure 'public' directory exists
+	// Initialize secure cookie codecs
+	if err := setupCookieCodecs(); err != nil {
+		log.Fatalf("Invalid cookie keys: %v", err)
+	}
+
+	// Ensure 'public' directory exists, unless it must be provisioned beforehand
 	if _, err := os.Stat("public"); os.IsNotExist(err) {
+		if !cfg.CreatePublicDir {
+			wd, _ := os.Getwd()
+			log.Fatalf("The public directory does not exist in %s and PNG_CREATE_PUBLIC_DIR is false: create it or check the working directory and volume mounts", wd)
+		}
 		os.Mkdir("public", 0755)
 	}
 
+	setReadOnly(cfg.ReadOnly)
+	warnWeakPassword()
+	warnOrphanPages()
+	if err := pageLinks.load(); err != nil {
+		log.Printf("Error loading page links: %v", err)
+	}
+	startViewCounting()
+	loadDeletedPages()
+	loadPageRedirects()
+
 	// Setup Gin router
-	router := gin.Default()
-	router.LoadHTMLGlob("templates/*.html")
+	router := gin.New()
+	router.Use(requestTracing(), gin.LoggerWithFormatter(logFormatter), logSlowRequests(), recoverPanics(), rateLimit(), forceHTTPS(), requestTimeout())
+	if err := htmlTemplates.load(cfg.LoginTemplate); err != nil {
+		log.Fatalf("Unable to parse templates: %v", err)
+	}
+	router.HTMLRender = htmlTemplates
+
+	// Only honor X-Forwarded-For from the configured proxies, so ClientIP()
+	// cannot be spoofed by direct clients.
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid PNG_TRUSTED_PROXIES: %v", err)
+	}
 
 	// serve assets folder on /assets
-	router.StaticFS("/assets", http.Dir("assets"))
+	router.Group("/assets", staticAssetCacheControl()).StaticFS("/", http.Dir(staticAssetsDir))
 
-	// Use the static middleware to serve generated pages from the root.
-	router.Use(static.Serve("/", static.LocalFile("./public", false)))
+	// Serve generated pages from the root.
+	router.Use(pageSecurityHeaders(), countViews(), cachedPages(), servePages())
 
-	// Login/Logout routes are public
-	router.GET("/login", showLoginPage)
-	router.POST("/login", handleLogin)
-	router.GET("/logout", handleLogout) // New logout route
+	// Login/Logout routes are public, and so is the first-run setup
+	router.GET("/robots.txt", handleRobotsTxt)
+	router.GET("/"+immutableDirName+"/:version/*file", handleImmutablePage)
+	router.HEAD("/"+immutableDirName+"/:version/*file", handleImmutablePage)
+	router.GET("/setup", adminIPAllowed(), dashboardSecurityHeaders(), showSetupPage)
+	router.POST("/setup", adminIPAllowed(), dashboardSecurityHeaders(), handleSetup)
+	router.GET("/login", adminIPAllowed(), dashboardSecurityHeaders(), showLoginPage)
+	router.POST("/login", adminIPAllowed(), dashboardSecurityHeaders(), handleLogin)
+	router.POST("/logout", adminIPAllowed(), handleLogout)
+	if cfg.LogoutGET {
+		// Kept for old bookmarks and links; a GET can be triggered by prefetching or another site
+		router.GET("/logout", adminIPAllowed(), handleLogout)
+	}
 
 	// Publisher panel is now at the root URL with custom auth
 	publishGroup := router.Group("/")
-	publishGroup.Use(authRequired())
+	publishGroup.Use(publicRoot(), adminIPAllowed(), dashboardSecurityHeaders(), authRequired())
 	{
 		publishGroup.GET("/", func(c *gin.Context) {
 			c.HTML(http.StatusOK, "index.html", nil)
 		})
 	}
 
-	// API routes with custom auth
-	api := router.Group("/api")
-	api.Use(authRequired())
+	// API routes with custom auth. Read-only endpoints can be made public
+	// with PNG_PUBLIC_READ, mutating ones always require authentication.
+	api := router.Group("/api", apiCacheControl(), corsHeaders(), adminIPAllowed())
+	api.OPTIONS("/*path", handlePreflight)
+	readAPI := api.Group("")
+	if !cfg.PublicRead {
+		readAPI.Use(authRequired())
+	}
+	{
+		readAPI.GET("/pages", handleListPages)
+		readAPI.GET("/pages/:id", handleGetPage)
+		readAPI.GET("/pages/orphans", authRequired(), handleListOrphans)
+		readAPI.GET("/pages/export", authRequired(), handleExportIndex)
+		readAPI.GET("/redirects", authRequired(), handleListRedirects)
+		readAPI.GET("/stats", authRequired(), handleStats)
+		readAPI.GET("/pages/:id/source", handleDownloadSource)
+		readAPI.HEAD("/pages/:id/source", handleDownloadSource)
+		readAPI.GET("/pages/:id/raw", handleRawPage)
+		readAPI.GET("/pages/:id/export", handleExportPage)
+		readAPI.GET("/pages/:id/assets", handleListAssets)
+		readAPI.GET("/pages/:id/backlinks", handleListBacklinks)
+		readAPI.GET("/pages/:id/versions", authRequired(), handleListVersions)
+		readAPI.GET("/tags", handleListTags)
+		readAPI.GET("/slugs/available", handleSlugAvailable)
+		readAPI.GET("/version", handleVersion)
+	}
+	writeAPI := api.Group("")
+	writeAPI.Use(authRequired(), readOnlyGuard())
+	{
+		writeAPI.POST("/upload", requireConfirm(), limitUploads(), handleUpload)
+		writeAPI.POST("/upload-from-url", requireConfirm(), limitUploads(), handleUploadFromURL)
+		writeAPI.POST("/import/git", requireConfirm(), limitUploads(), handleGitImport)
+		writeAPI.PUT("/pages/:id", limitUploads(), handleUpdatePage)
+		writeAPI.DELETE("/pages/:id", handleDeletePage)
+		writeAPI.POST("/pages/:id/move", handleMovePage)
+		writeAPI.DELETE("/redirects/:id", handleDeleteRedirect)
+		writeAPI.POST("/pages/:id/assets", handleUploadAsset)
+		writeAPI.DELETE("/pages/:id/assets/:name", handleDeleteAsset)
+		writeAPI.POST("/pages/:id/repair", limitUploads(), handleRepairPage)
+		writeAPI.POST("/pages/:id/restore/:version", limitUploads(), handleRestoreVersion)
+		writeAPI.POST("/pages/:id/pin", handlePinPage(true))
+		writeAPI.POST("/pages/:id/unpin", handlePinPage(false))
+		writeAPI.POST("/tags/rename", handleRenameTag)
+		writeAPI.POST("/tags/delete", handleDeleteTag)
+	}
+	docsAPI := api.Group("")
+	if !cfg.APIDocsPublic {
+		docsAPI.Use(authRequired())
+	}
+	{
+		docsAPI.GET("/openapi.json", handleOpenAPISpec)
+		docsAPI.GET("/docs", showAPIDocs)
+	}
+	adminAPI := api.Group("/admin")
+	adminAPI.Use(authRequired())
 	{
-		api.POST("/upload", handleUpload)
-		api.GET("/pages", handleListPages)
-		api.DELETE("/pages/:id", handleDeletePage)
-		api.GET("/pages/:id/source", handleDownloadSource)
+		adminAPI.GET("/readonly", handleGetReadOnly)
+		adminAPI.POST("/readonly", handleSetReadOnly)
+		adminAPI.POST("/reload", handleReloadConfig)
+		adminAPI.GET("/cache", handleCacheStats)
+		adminAPI.GET("/rebuild", handleGetRebuild)
+		adminAPI.POST("/rebuild", readOnlyGuard(), handleStartRebuild)
 	}
+	api.POST("/validate", authRequired(), limitUploads(), handleValidate)
+	api.POST("/preview/themes", authRequired(), limitUploads(), handleThemePreview)
+	api.GET("/audit", authRequired(), handleListAudit)
+	api.GET("/debug", authRequired(), handleDebug)
+	api.GET("/events", authRequired(), handleEvents)
 
 	// Add a handler for 404 Not Found errors
-	router.NoRoute(func(c *gin.Context) {
-		c.HTML(http.StatusNotFound, "404.html", nil)
-	})
+	router.NoRoute(renderNotFound)
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	handler := withPathPrefix(cfg.PathPrefix, router)
+
+	// Serve until SIGINT or SIGTERM, letting requests in flight finish, then
+	// save what is kept in memory
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var err error
+	if acmeEnabled() {
+		// Automatic certificates when ACME domains are set
+		log.Printf("Server starting on https://%s (ACME enabled)", cfg.ACMEDomains[0])
+		err = runACME(ctx, handler)
+	} else {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		log.Printf("Server starting on http://localhost:%s", port)
+		log.Printf("Publishing interface available at http://localhost:%s%s/", port, cfg.PathPrefix)
+		server := newHTTPServer(":"+port, handler)
+		err = serveUntilDone(ctx, map[*http.Server]func() error{server: server.ListenAndServe})
 	}
-	log.Printf("Server starting on http://localhost:%s", port)
-	log.Printf("Publishing interface available at http://localhost:%s/", port)
-	if err := router.Run(":" + port); err != nil {
+	stopViewCounting()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 // --- Custom Middleware ---
 
-func isAuthenticated(c *gin.Context) bool {
-	cookie, err := c.Cookie("session")
+// credentialsMatch compares the given credentials with the configured ones in
+// constant time.
+func credentialsMatch(username, password string) bool {
+	cfg := getConfig()
+	usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Username))
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password))
+	return usernameMatch&passwordMatch == 1
+}
+
+// sessionActivityInterval is how often the last activity of a session is
+// written back to its cookie, so not every request sets a new one.
+const sessionActivityInterval = time.Minute
+
+var (
+	errNoSession   = errors.New("no valid session")
+	errSessionIdle = errors.New("session idle for longer than PNG_IDLE_TIMEOUT")
+)
+
+// readSession decodes the session cookie, rejecting expired sessions and,
+// with PNG_IDLE_TIMEOUT, those without activity for that long.
+func readSession(c *gin.Context) (map[string]string, error) {
+	cfg := getConfig()
+	cookie, err := c.Cookie(cfg.CookieName)
 	if err != nil {
-		return false
+		return nil, errNoSession
 	}
 
 	cookieValue := make(map[string]string)
-	if err = cookieHandler.Decode("session", cookie, &cookieValue); err != nil {
-		return false
+	if err = securecookie.DecodeMulti(cfg.CookieName, cookie, &cookieValue, cookieCodecs...); err != nil {
+		return nil, errNoSession
+	}
+
+	// The expiry is signed with the rest of the value, so it cannot be
+	// extended; cookies issued without one are no longer accepted
+	now := time.Now().Unix()
+	expires, err := strconv.ParseInt(cookieValue["expires"], 10, 64)
+	if err != nil || now >= expires || cookieValue["authenticated"] != "true" {
+		return nil, errNoSession
+	}
+	if cfg.IdleTimeout > 0 {
+		lastActivity, err := strconv.ParseInt(cookieValue["lastActivity"], 10, 64)
+		if err != nil || now-lastActivity >= int64(cfg.IdleTimeout.Seconds()) {
+			return nil, errSessionIdle
+		}
 	}
+	return cookieValue, nil
+}
 
-	return cookieValue["authenticated"] == "true"
+func isAuthenticated(c *gin.Context) bool {
+	_, err := readSession(c)
+	return err == nil
+}
+
+// touchSession records the activity of a session, at most once per
+// sessionActivityInterval. The event stream stays open without the user doing
+// anything, so it does not count.
+func touchSession(c *gin.Context, session map[string]string) {
+	if getConfig().IdleTimeout <= 0 || c.FullPath() == eventsPath {
+		return
+	}
+	now := time.Now()
+	lastActivity, _ := strconv.ParseInt(session["lastActivity"], 10, 64)
+	if now.Unix()-lastActivity < int64(sessionActivityInterval.Seconds()) {
+		return
+	}
+	expires, _ := strconv.ParseInt(session["expires"], 10, 64)
+	session["lastActivity"] = strconv.FormatInt(now.Unix(), 10)
+	encoded, err := securecookie.EncodeMulti(getConfig().CookieName, session, cookieCodecs...)
+	if err != nil {
+		log.Printf("Error refreshing session: %v", err)
+		return
+	}
+	setSessionCookie(c, encoded, int(expires-now.Unix()))
 }
 
 // --- Middleware ---
+// authDisabled reports whether no credentials are configured, in which case
+// the panel is open to everyone.
+func authDisabled() bool {
+	cfg := getConfig()
+	return cfg.Username == "" || cfg.Password == ""
+}
+
+// isLoggedIn reports whether the request carries a valid session or, when
+// enabled, valid Basic credentials.
+func isLoggedIn(c *gin.Context) bool {
+	if setupPending() {
+		return false
+	}
+	if authDisabled() || isAuthenticated(c) {
+		return true
+	}
+	username, password, ok := c.Request.BasicAuth()
+	return ok && getConfig().BasicAuth && credentialsMatch(username, password)
+}
+
 func authRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if appConfig.Username == "" || appConfig.Password == "" || isAuthenticated(c) {
+		if setupPending() {
+			redirectToSetup(c)
+			return
+		}
+		if authDisabled() {
+			c.Next()
+			return
+		}
+		session, err := readSession(c)
+		if err == nil {
+			touchSession(c, session)
 			c.Next()
 			return
 		}
-		c.Redirect(http.StatusFound, "/login")
+		// Scripts may send credentials with each request instead of logging in
+		if username, password, ok := c.Request.BasicAuth(); ok && getConfig().BasicAuth {
+			if credentialsMatch(username, password) {
+				c.Next()
+				return
+			}
+			c.Header("WWW-Authenticate", `Basic realm="press-n-go"`)
+			abortWithError(c, http.StatusUnauthorized, codeUnauthorized, "Invalid username or password")
+			return
+		}
+		if errors.Is(err, errSessionIdle) {
+			setSessionCookie(c, "", -1)
+			c.Redirect(http.StatusFound, sitePath("/login?idle=1"))
+			c.Abort()
+			return
+		}
+		c.Redirect(http.StatusFound, sitePath("/login"))
 		c.Abort()
 	}
 }
@@ -155,167 +694,1465 @@ func authRequired() gin.HandlerFunc {
 // --- Handlers ---
 
 func showLoginPage(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", nil)
+	if setupPending() {
+		redirectToSetup(c)
+		return
+	}
+	data := loginPageData()
+	if c.Query("loggedOut") != "" {
+		data["Message"] = "You have been logged out"
+	} else if c.Query("idle") != "" {
+		data["Message"] = "You have been logged out after a period of inactivity"
+	}
+	c.HTML(http.StatusOK, "login.html", data)
+}
+
+// loginPageData holds the branding of the login page: SiteTitle from
+// PNG_SITE_TITLE, LogoURL from PNG_LOGO_URL and BrandColor, a #rrggbb color
+// from PNG_BRAND_COLOR. Each is empty when unset.
+func loginPageData() gin.H {
+	cfg := getConfig()
+	brandColor := ""
+	if rgba, err := parseHexColor(cfg.BrandColor); err == nil {
+		brandColor = fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B)
+	}
+	return gin.H{"SiteTitle": cfg.SiteTitle, "LogoURL": cfg.LogoURL, "BrandColor": brandColor}
 }
 
-func createSession(c *gin.Context) error {
-	value := map[string]string{"authenticated": "true"}
-	encoded, err := cookieHandler.Encode("session", value)
+// createSession issues a session lasting PNG_SESSION_TTL, or PNG_REMEMBER_TTL
+// when the user asked to be remembered.
+func createSession(c *gin.Context, remember bool) error {
+	cfg := getConfig()
+	ttl := cfg.SessionTTL
+	if remember {
+		ttl = cfg.RememberTTL
+	}
+	now := time.Now()
+	value := map[string]string{
+		"authenticated": "true",
+		"expires":       strconv.FormatInt(now.Add(ttl).Unix(), 10),
+		"lastActivity":  strconv.FormatInt(now.Unix(), 10),
+	}
+	encoded, err := securecookie.EncodeMulti(cfg.CookieName, value, cookieCodecs...)
 	if err != nil {
 		return err
 	}
-	c.SetCookie("session", encoded, 3600*24, "/", "", false, true)
+	setSessionCookie(c, encoded, int(ttl.Seconds()))
 	return nil
 }
 
 func handleLogin(c *gin.Context) {
 	username, password := c.PostForm("username"), c.PostForm("password")
-	if username == appConfig.Username && password == appConfig.Password {
-		if err := createSession(c); err != nil {
-			c.HTML(http.StatusInternalServerError, "login.html", gin.H{"Error": "Failed to create session"})
+	if credentialsMatch(username, password) {
+		if err := createSession(c, c.PostForm("remember") == "on"); err != nil {
+			data := loginPageData()
+			data["Error"] = "Failed to create session"
+			c.HTML(http.StatusInternalServerError, "login.html", data)
 			return
 		}
-		c.Redirect(http.StatusFound, "/")
+		c.Redirect(http.StatusFound, sitePath("/"))
 	} else {
-		c.HTML(http.StatusUnauthorized, "login.html", gin.H{"Error": "Invalid username or password"})
+		data := loginPageData()
+		data["Error"] = "Invalid username or password"
+		c.HTML(http.StatusUnauthorized, "login.html", data)
 	}
 }
 
 func handleLogout(c *gin.Context) {
 	// Set the cookie with a max age of -1 to delete it
-	c.SetCookie("session", "", -1, "/", "", false, true)
-	c.Redirect(http.StatusFound, "/login")
+	setSessionCookie(c, "", -1)
+	target := getConfig().LogoutRedirect
+	if target == "" {
+		target = sitePath("/login?loggedOut=1")
+	}
+	// 303 makes the browser follow up a POST with a GET
+	c.Redirect(http.StatusSeeOther, target)
 }
 
+const (
+	base62Alphabet  = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	maxIDAttempts   = 10
+	minIDLength     = 4
+	maxIDLength     = 64
+	defaultIDLength = 0
+)
+
+// generatePageID returns an unused page ID from the PNG_ID_SCHEME generator.
+// Existing folders are checked on disk, which also catches IDs differing only
+// by case on case-insensitive filesystems.
 func generatePageID() (string, error) {
-	randomBytes := make([]byte, 8)
-	if _, err := rand.Read(randomBytes); err != nil {
-		return "", fmt.Errorf("failed to generate random ID: %w", err)
+	generator := getConfig().idGenerator
+	for range maxIDAttempts {
+		id, err := generator.Generate()
+		if err != nil {
+			return "", err
+		}
+		if isWindowsReservedName(id) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join("public", id)); os.IsNotExist(err) {
+			return id, nil
+		}
 	}
-	return hex.EncodeToString(randomBytes), nil
+	return "", fmt.Errorf("failed to generate a unique ID after %d attempts", maxIDAttempts)
 }
 
 func handleUpload(c *gin.Context) {
+	start := time.Now()
 	var req UploadRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindUploadRequest(c, getConfig(), &req) {
 		return
 	}
+	publishUpload(c, start, req)
+}
 
-	pageID, err := generatePageID()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// validateUpload checks a bound upload before it is rendered, for new pages
+// and edits alike, reporting the error itself when it returns false. Tags are
+// normalized and the files of multi-file pages bound into req.
+func validateUpload(c *gin.Context, req *UploadRequest) bool {
+	if err := validateUploadRequest(req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidTag, err.Error())
+		return false
+	}
+	if err := checkTOCLevels(*req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return false
+	}
+	if !bindPageFiles(c, req) {
+		return false
+	}
+	if err := checkTypeAllowed(*req); err != nil {
+		respondError(c, http.StatusForbidden, codeForbidden, err.Error())
+		return false
+	}
+	if err := checkRawHTMLAllowed(*req); err != nil {
+		respondError(c, http.StatusForbidden, codeForbidden, err.Error())
+		return false
+	}
+	if !checkPageHTML(c, *req) {
+		return false
+	}
+	if req.ThemeCSS != nil {
+		if err := validateThemeCSS(*req.ThemeCSS); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidTheme, err.Error())
+			return false
+		}
+	}
+	if err := validateContent(*req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidContent, err.Error())
+		return false
 	}
+	return true
+}
 
-	if err := createPageFile(pageID, req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// publishUpload validates a bound upload and publishes it, as a new page or
+// over the page of its slug, answering the request. start is when the
+// request began, for the timings.
+func publishUpload(c *gin.Context, start time.Time, req UploadRequest) {
+	cfg := getConfig()
+	if !validateUpload(c, &req) {
 		return
 	}
+	if req.Slug != "" {
+		slug, err := normalizeSlug(req.Slug)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidID, err.Error())
+			return
+		}
+		req.Slug = slug
+	}
 
-	c.JSON(http.StatusOK, gin.H{"url": fmt.Sprintf("/%s/", pageID)})
-}
+	// Retries carrying the same Idempotency-Key get the original page back
+	var pageID string
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			respondError(c, http.StatusBadRequest, codeInvalidKey, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+			return
+		}
+		entry, existingID := idempotencyKeys.begin(key)
+		if existingID != "" {
+			c.Header("Idempotent-Replayed", "true")
+			respondJSON(c, http.StatusOK, pageURLs(c, existingID))
+			return
+		}
+		defer func() {
+			idempotencyKeys.finish(key, entry, pageID)
+		}()
+	}
 
-func handleListPages(c *gin.Context) {
-	var discoveredPages []Page
-	entries, err := os.ReadDir("public")
-	if err != nil {
-		log.Printf("Error reading public directory: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list pages"})
-		return
+	if cfg.MaxPages > 0 || cfg.Dedupe || cfg.MaxPagesKeep > 0 || req.Slug != "" {
+		pageCreateMu.Lock()
+		defer pageCreateMu.Unlock()
 	}
-	for _, entry := range entries {
-		if entry.IsDir() && entry.Name() != "index.html" {
-			info, err := entry.Info()
-			if err != nil {
-				log.Printf("Error getting info for %s: %v", entry.Name(), err)
-				continue
+
+	if req.Slug != "" {
+		if _, err := os.Stat(filepath.Join("public", req.Slug)); err == nil {
+			if !req.Overwrite {
+				respondError(c, http.StatusConflict, codePageExists, "A page with this slug already exists: pass \"overwrite\": true to replace it")
+				return
 			}
-			discoveredPages = append(discoveredPages, Page{
-				ID:        entry.Name(),
-				CreatedAt: info.ModTime(),
-			})
+			if !editPage(c, req.Slug, req) {
+				return
+			}
+			pageID = req.Slug
+			recordAudit(c, auditActionEdit, pageID)
+			pageEvents.publish(eventPageUpdated, pageID)
+			respondJSON(c, http.StatusOK, pageURLs(c, pageID))
+			return
+		}
+	}
+
+	// A chosen slug is what the client asked for, so it is never deduplicated
+	if cfg.Dedupe && !req.ForceNew && req.Slug == "" {
+		existingID, err := findPageByHash(contentHash(req))
+		if err != nil {
+			log.Printf("Error looking up duplicate pages: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "Could not check for duplicates")
+			return
+		}
+		if existingID != "" {
+			pageID = existingID
+			response := pageURLs(c, existingID)
+			response["duplicate"] = true
+			respondJSON(c, http.StatusOK, response)
+			return
+		}
+	}
+
+	if cfg.MaxPages > 0 {
+		count, err := countPages()
+		if err != nil {
+			log.Printf("Error counting pages: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "Could not count pages")
+			return
 		}
+		if count >= cfg.MaxPages {
+			respondError(c, http.StatusForbidden, codePageLimit, fmt.Sprintf("Page limit reached: this instance allows at most %d pages", cfg.MaxPages))
+			return
+		}
+	}
+
+	newID := req.Slug
+	if newID == "" {
+		var err error
+		if newID, err = generatePageID(); err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	var sw *stopwatch
+	if cfg.DebugTimings || c.Query("debug") == "true" {
+		sw = newStopwatch()
+		ctx = withStopwatch(ctx, sw)
 	}
-	c.JSON(http.StatusOK, discoveredPages)
+	if err := createPageFile(ctx, newID, req); err != nil {
+		writePageError(c, err)
+		return
+	}
+	pageID = newID
+	recordAudit(c, auditActionUpload, pageID)
+	pageEvents.publish(eventPageCreated, pageID)
+	if cfg.MaxPagesKeep > 0 {
+		prunePages(c, cfg.MaxPagesKeep, pageID)
+	}
+
+	response := pageURLs(c, pageID)
+	if sw != nil {
+		response["timings"] = sw.timings(start)
+	}
+	respondJSON(c, http.StatusOK, response)
 }
 
-func handleDeletePage(c *gin.Context) {
+func handleUpdatePage(c *gin.Context) {
 	pageID := c.Param("id")
-	if pageID == "" || strings.Contains(pageID, ".") || strings.Contains(pageID, "/") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
 		return
 	}
-	folderPath := filepath.Join("public", pageID)
-	if _, err := os.Stat(folderPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+	var req UploadRequest
+	if !bindUploadRequest(c, getConfig(), &req) || !validateUpload(c, &req) {
 		return
 	}
-	if err := os.RemoveAll(folderPath); err != nil {
-		log.Printf("Error deleting folder %s: %v", folderPath, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete page"})
+	if _, err := os.Stat(filepath.Join("public", pageID)); os.IsNotExist(err) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+
+	if !editPage(c, pageID, req) {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Page deleted successfully"})
+	recordAudit(c, auditActionEdit, pageID)
+	pageEvents.publish(eventPageUpdated, pageID)
+
+	respondJSON(c, http.StatusOK, pageURLs(c, pageID))
 }
 
-func handleDownloadSource(c *gin.Context) {
-	pageID := c.Param("id")
-	if pageID == "" || strings.Contains(pageID, ".") || strings.Contains(pageID, "/") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
+func handleListPages(c *gin.Context) {
+	sortBy := c.DefaultQuery("sort", "created")
+	if sortBy != "created" && sortBy != "updated" {
+		respondError(c, http.StatusBadRequest, codeInvalidQuery, "sort must be one of created, updated")
 		return
 	}
-	sourcePath := filepath.Join("public", pageID, "source.txt")
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Source file not found"})
+	tagFilter := normalizeTag(c.Query("tag"))
+	timeFormat := c.DefaultQuery("timeFormat", "absolute")
+	if timeFormat != "absolute" && timeFormat != "relative" {
+		respondError(c, http.StatusBadRequest, codeInvalidQuery, "timeFormat must be one of absolute, relative")
+		return
+	}
+	createdAfter, err := timeQuery(c, "createdAfter")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+	createdBefore, err := timeQuery(c, "createdBefore")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidQuery, err.Error())
 		return
 	}
-	c.FileAttachment(sourcePath, fmt.Sprintf("%s_source.txt", pageID))
-}
 
-// --- Helper Functions ---
+	pages, err := listPages()
+	if err != nil {
+		log.Printf("Error reading public directory: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list pages")
+		return
+	}
+	var discoveredPages []Page
+	now := time.Now()
+	// With PNG_PUBLIC_READ, anonymous readers only see public pages
+	listAll := isLoggedIn(c)
+	for _, page := range pages {
+		if tagFilter != "" && !slices.Contains(page.Tags, tagFilter) {
+			continue
+		}
+		if (!createdAfter.IsZero() && !page.CreatedAt.After(createdAfter)) || (!createdBefore.IsZero() && !page.CreatedAt.Before(createdBefore)) {
+			continue
+		}
+		if !listAll && page.Visibility != visibilityPublic {
+			continue
+		}
+		if page.SizeBytes, err = folderSize(filepath.Join("public", page.ID)); err != nil {
+			log.Printf("Error computing size of %s: %v", page.ID, err)
+		}
+		if timeFormat == "relative" {
+			page.CreatedAgo = relativeTime(page.CreatedAt, now)
+			page.UpdatedAgo = relativeTime(page.UpdatedAt, now)
+		}
+		discoveredPages = append(discoveredPages, page)
+	}
 
-func LoadConfig() {
-	viper.SetDefault("PNG_USERNAME", "")
-	viper.SetDefault("PNG_PASSWORD", "")
-	viper.AutomaticEnv()
-	if err := viper.Unmarshal(&appConfig); err != nil {
-		log.Fatalf("Unable to decode config into struct, %v", err)
+	// Newest first
+	sort.Slice(discoveredPages, func(i, j int) bool {
+		if sortBy == "updated" {
+			return discoveredPages[i].UpdatedAt.After(discoveredPages[j].UpdatedAt)
+		}
+		return discoveredPages[i].CreatedAt.After(discoveredPages[j].CreatedAt)
+	})
+
+	// Dashboards poll this endpoint, so unchanged lists are answered with 304
+	body, err := json.Marshal(discoveredPages)
+	if err != nil {
+		log.Printf("Error encoding page list: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list pages")
+		return
 	}
+	jsonWithETag(c, body)
 }
 
-func createPageFile(pageID string, req UploadRequest) error {
-	folderPath := filepath.Join("public", pageID)
-	if err := os.MkdirAll(folderPath, 0755); err != nil {
-		return fmt.Errorf("failed to create content directory: %w", err)
+// timeQuery reads an optional RFC 3339 query parameter, zero when absent.
+func timeQuery(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
 	}
-	rawFilePath := filepath.Join(folderPath, "source.txt")
-	if err := os.WriteFile(rawFilePath, []byte(req.Content), 0644); err != nil {
-		return fmt.Errorf("failed to write raw source file: %w", err)
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time such as 2024-06-01T00:00:00Z, not %q", name, value)
 	}
-	var finalContent string
-	if req.Type == "markdown" {
-		var buf bytes.Buffer
-		if err := md.Convert([]byte(req.Content), &buf); err != nil {
-			return fmt.Errorf("failed to convert markdown: %w", err)
-		}
-		htmlContent := buf.String()
-		finalContent = fmt.Sprintf(`<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Published Content</title>
-    <style>%s</style>
-</head>
-<body><article class="markdown-body">%s</article></body>
-</html>`, req.ThemeCSS, htmlContent)
-	} else {
-		finalContent = req.Content
+	return t, nil
+}
+
+func handleGetPage(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	folderPath := filepath.Join("public", pageID)
+	if info, err := os.Stat(folderPath); err != nil || !info.IsDir() {
+		if isDeletedPage(pageID) {
+			respondError(c, http.StatusGone, codePageGone, "The page was deleted")
+			return
+		}
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+	if isUnrenderedPage(pageID) && !autoRepairPage(c.Request.Context(), pageID) {
+		respondUnrendered(c, pageID)
+		return
+	}
+	meta, err := readPageMeta(pageID)
+	if err != nil {
+		log.Printf("Error reading metadata for %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not read page")
+		return
+	}
+	page := newPage(pageID, meta)
+	if page.SizeBytes, err = folderSize(folderPath); err != nil {
+		log.Printf("Error computing size of %s: %v", pageID, err)
+	}
+	respondJSON(c, http.StatusOK, page)
+}
+
+func handleDeletePage(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	folderPath := filepath.Join("public", pageID)
+	if _, err := os.Stat(folderPath); os.IsNotExist(err) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+	redirect := c.Query("redirect")
+	if redirect != "" {
+		if getConfig().RedirectsFile == "" {
+			respondError(c, http.StatusBadRequest, codeRedirectsDisabled, "Redirects are not enabled")
+			return
+		}
+		if err := checkRedirectTarget(pageID, redirect); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidQuery, err.Error())
+			return
+		}
+	}
+	if c.Query("force") != "true" {
+		if meta, err := readPageMeta(pageID); err == nil && meta.Pinned {
+			respondError(c, http.StatusConflict, codePagePinned, "The page is pinned: unpin it or delete it with ?force=true")
+			return
+		}
+	}
+	if err := deletePage(c, pageID, auditActionDelete); err != nil {
+		log.Printf("Error deleting folder %s: %v", folderPath, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to delete page")
+		return
+	}
+	if redirect != "" {
+		recordPageRedirect(pageID, redirect)
+	}
+	respondJSON(c, http.StatusOK, gin.H{"message": "Page deleted successfully"})
+}
+
+// deletePage removes a page's folder and everything kept about it, then
+// records the deletion, with action in the audit log, and announces it. The
+// page is forgotten even when its folder could only be partly removed, but
+// the deletion is then reported as failed rather than recorded.
+func deletePage(c *gin.Context, pageID, action string) error {
+	err := os.RemoveAll(filepath.Join("public", pageID))
+	pageCache.remove(pageID)
+	pageViews.remove(pageID)
+	removePageLinks(pageID)
+	if err != nil {
+		return err
+	}
+	recordDeletedPage(pageID)
+	recordAudit(c, action, pageID)
+	pageEvents.publish(eventPageDeleted, pageID)
+	return nil
+}
+
+func handleDownloadSource(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	source, modTime, err := readPageSource(pageID)
+	if os.IsNotExist(err) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Source file not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading source of %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not read source")
+		return
+	}
+
+	// ?inline=true lets editors fetch the source instead of downloading it
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	if c.Query("inline") == "true" {
+		c.Header("Content-Disposition", "inline")
+	} else {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_source.txt"`, pageID))
+	}
+	// ServeContent answers HEAD, Range and If-Modified-Since requests, so
+	// large sources can be fetched conditionally and resumed
+	c.Header("Cache-Control", cacheControlRevalidate)
+	http.ServeContent(c.Writer, c.Request, sourceFileName, modTime, bytes.NewReader(source))
+}
+
+// --- Helper Functions ---
+
+func newPage(pageID string, meta PageMeta) Page {
+	return Page{
+		ID:          pageID,
+		Title:       meta.Title,
+		Description: meta.Description,
+		Author:      meta.Author,
+		Type:        meta.Type,
+		Draft:       meta.Draft,
+		Visibility:  pageVisibility(meta),
+		Pinned:      meta.Pinned,
+		CreatedAt:   meta.CreatedAt,
+		UpdatedAt:   meta.UpdatedAt,
+		Tags:        meta.Tags,
+
+		ReadingMinutes: meta.ReadingMinutes,
+		Files:          meta.Files,
+		Wrap:           meta.Wrap,
+		Views:          pageViews.get(pageID),
+		ImmutableURL:   immutablePath(pageID, meta.RenderHash),
+	}
+}
+
+// folderSize sums the size of every file below path.
+func folderSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// listPages reads every page folder in public along with its metadata.
+func listPages() ([]Page, error) {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		return nil, err
+	}
+	var pages []Page
+	for _, entry := range entries {
+		if isPageDir(entry) {
+			meta, err := readPageMeta(entry.Name())
+			if err != nil {
+				log.Printf("Error reading metadata for %s: %v", entry.Name(), err)
+				continue
+			}
+			pages = append(pages, newPage(entry.Name(), meta))
+		}
+	}
+	return pages, nil
+}
+
+var (
+	htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+	h1Pattern      = regexp.MustCompile(`(?s)<h1[^>]*>(.*?)</h1>`)
+)
+
+const defaultPageTitle = "Published Content"
+
+// extractTitle returns the text of the first <h1> in the rendered HTML.
+func extractTitle(renderedHTML string) string {
+	match := h1Pattern.FindStringSubmatch(headingNumberPattern.ReplaceAllString(stripHeadingAnchors(renderedHTML), ""))
+	if match == nil {
+		return defaultPageTitle
+	}
+	title := strings.TrimSpace(stdhtml.UnescapeString(htmlTagPattern.ReplaceAllString(match[1], "")))
+	if title == "" {
+		return defaultPageTitle
+	}
+	return title
+}
+
+// readingMinutes estimates how long the rendered HTML takes to read,
+// rounding up to at least one minute.
+func readingMinutes(renderedHTML string) int {
+	cfg := getConfig()
+	words := len(strings.Fields(htmlTagPattern.ReplaceAllString(stripHeadingAnchors(renderedHTML), " ")))
+	minutes := (words + cfg.ReadingWPM - 1) / cfg.ReadingWPM
+	return max(minutes, 1)
+}
+
+// applyFrontMatter fills the page metadata from the front matter, letting
+// fields set explicitly in the request take precedence.
+func applyFrontMatter(meta *PageMeta, req UploadRequest, fm frontMatter) error {
+	meta.Title = cmp.Or(strings.TrimSpace(req.Title), fm.Title)
+	meta.Description = cmp.Or(strings.TrimSpace(req.Description), fm.Description)
+	meta.Author = cmp.Or(strings.TrimSpace(req.Author), fm.Author)
+	meta.Draft = fm.Draft
+	if req.Draft != nil {
+		meta.Draft = *req.Draft
+	}
+	applyVisibility(meta, req.Visibility)
+	meta.Tags = req.Tags
+	if len(req.Tags) == 0 {
+		tags, err := normalizeTags(fm.Tags)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidContent, err)
+		}
+		meta.Tags = tags
+	}
+	return nil
+}
+
+func descriptionTags(description string) string {
+	if description == "" {
+		return ""
+	}
+	escaped := stdhtml.EscapeString(description)
+	return fmt.Sprintf(`<meta name="description" content="%s">
+    <meta property="og:description" content="%s">`, escaped, escaped)
+}
+
+// absolutePageURL returns the public URL of a page based on PNG_BASE_URL, or
+// an empty string when no base URL is configured.
+func absolutePageURL(pageID string) string {
+	cfg := getConfig()
+	if cfg.BaseURL == "" {
+		return ""
+	}
+	return cfg.BaseURL + "/" + pageID + "/"
+}
+
+// trustedProxies returns the proxies allowed to set forwarding headers.
+// "none" disables proxy trust entirely.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range getConfig().TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if strings.EqualFold(proxy, "none") {
+			return nil
+		}
+		if proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// contentHash identifies uploads that would produce the same page.
+func contentHash(req UploadRequest) string {
+	content := strings.TrimSpace(strings.ReplaceAll(req.Content, "\r\n", "\n"))
+	// Raw HTML pages are not themed, whatever the request says
+	themeCSS := ""
+	if req.Type != "html" {
+		themeCSS = pageThemeCSS(req)
+	}
+	hash := sha256.New()
+	hash.Write([]byte(req.Type + "\x00" + themeCSS + "\x00" + content))
+	for _, name := range pageFileNames(req.Files) {
+		hash.Write([]byte("\x00" + name + "\x00" + strings.ReplaceAll(req.Files[name], "\r\n", "\n")))
+	}
+	if req.Type != "html" && req.HeadHTML+req.FooterHTML != "" {
+		hash.Write([]byte("\x00" + req.HeadHTML + "\x00" + req.FooterHTML))
+	}
+	if req.Type != "html" && req.Wrap == wrapFragment {
+		hash.Write([]byte("\x00" + wrapFragment))
+	}
+	if req.Type != "html" && req.Author+req.OGType+req.TwitterCard != "" {
+		hash.Write([]byte("\x00" + req.Author + "\x00" + req.OGType + "\x00" + req.TwitterCard))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// findPageByHash returns the ID of a page with the given content hash, or an
+// empty string when there is none.
+func findPageByHash(hash string) (string, error) {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !isPageDir(entry) {
+			continue
+		}
+		meta, err := readPageMeta(entry.Name())
+		if err != nil {
+			continue
+		}
+		if meta.ContentHash == hash {
+			return entry.Name(), nil
+		}
+	}
+	return "", nil
+}
+
+// countPages returns the number of page folders in public.
+func countPages() (int, error) {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if isPageDir(entry) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// validateContent rejects binary content: invalid UTF-8 or NUL bytes, which
+// would produce a broken page and an unreadable source.txt. Raw HTML is let
+// through when PNG_ALLOW_BINARY_HTML is set.
+func validateContent(req UploadRequest) error {
+	if req.Type == "html" && getConfig().AllowBinaryHTML {
+		return nil
+	}
+	if !utf8.ValidString(req.Content) || strings.ContainsRune(req.Content, 0) {
+		return errors.New("content must be UTF-8 text, binary data is not accepted")
+	}
+	for name, content := range req.Files {
+		if !utf8.ValidString(content) || strings.ContainsRune(content, 0) {
+			return fmt.Errorf("%s must be UTF-8 text, binary data is not accepted", name)
+		}
+	}
+	return nil
+}
+
+// checkTypeAllowed rejects uploads whose type PNG_ALLOWED_TYPES leaves out,
+// such as raw HTML on an instance open to anyone.
+func checkTypeAllowed(req UploadRequest) error {
+	if !slices.Contains(getConfig().AllowedTypes, req.Type) {
+		return fmt.Errorf("%s pages are not permitted on this server", req.Type)
+	}
+	return nil
+}
+
+// validateUploadRequest checks and normalizes user-supplied upload fields.
+func validateUploadRequest(req *UploadRequest) error {
+	if req.Type == "" {
+		req.Type = getConfig().DefaultType
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return err
+	}
+	req.Tags = tags
+	return nil
+}
+
+// isValidPageID reports whether pageID can name a page folder. Dotfolders,
+// the reserved top-level paths and PNG_IGNORED_DIRS never do, so auxiliary
+// directories in public are neither listed nor served as pages.
+func isValidPageID(pageID string) bool {
+	if pageID == "" || strings.Contains(pageID, ".") || strings.Contains(pageID, "/") || reservedSlugs[pageID] {
+		return false
+	}
+	return !slices.Contains(getConfig().IgnoredDirs, pageID)
+}
+
+// isPageDir reports whether an entry of the public directory is a page folder.
+func isPageDir(entry os.DirEntry) bool {
+	return entry.IsDir() && isValidPageID(entry.Name())
+}
+
+// LoadConfig reads the startup configuration, exiting on invalid values.
+func LoadConfig() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	currentConfig.Store(cfg)
+}
+
+// readConfig reads the configuration from the environment, on top of the
+// optional PNG_CONFIG_FILE, and validates it.
+func readConfig() (Config, error) {
+	viper.SetDefault("PNG_USERNAME", "")
+	viper.SetDefault("PNG_PASSWORD", "")
+	viper.SetDefault("PNG_MIN_PASSWORD_LENGTH", 12)
+	viper.SetDefault("PNG_STRICT_PASSWORD", false)
+	viper.SetDefault("PNG_BASIC_AUTH", true)
+	viper.SetDefault("PNG_ALLOW_SETUP", false)
+	viper.SetDefault("PNG_SETUP_FILE", defaultSetupFile)
+	viper.SetDefault("PNG_LOGOUT_REDIRECT", "")
+	viper.SetDefault("PNG_LOGOUT_GET", false)
+	viper.SetDefault("PNG_SESSION_TTL", 24*time.Hour)
+	viper.SetDefault("PNG_REMEMBER_TTL", 30*24*time.Hour)
+	viper.SetDefault("PNG_IDLE_TIMEOUT", 0)
+	viper.SetDefault("PNG_ACME_DOMAINS", []string{})
+	viper.SetDefault("PNG_ACME_EMAIL", "")
+	viper.SetDefault("PNG_ACME_CACHE_DIR", "certs")
+	viper.SetDefault("PNG_COOKIE_SECURE", false)
+	viper.SetDefault("PNG_COOKIE_NAME", "session")
+	viper.SetDefault("PNG_COOKIE_SAMESITE", "lax")
+	viper.SetDefault("PNG_COOKIE_DOMAIN", "")
+	viper.SetDefault("PNG_COOKIE_HASH_KEY", "")
+	viper.SetDefault("PNG_COOKIE_BLOCK_KEY", "")
+	viper.SetDefault("PNG_COOKIE_KEYS", []string{})
+	viper.SetDefault("PNG_READING_WPM", 200)
+	viper.SetDefault("PNG_OG_IMAGE", true)
+	viper.SetDefault("PNG_OG_BACKGROUND", "#0a2f5e")
+	viper.SetDefault("PNG_OG_ACCENT", "#facc15")
+	viper.SetDefault("PNG_OG_FONT", "")
+	viper.SetDefault("PNG_404_PAGE", "")
+	viper.SetDefault("PNG_ASSET_CACHE_MAX_AGE", time.Hour)
+	viper.SetDefault("PNG_ASSET_CSP", defaultAssetCSP)
+	viper.SetDefault("PNG_LOGIN_TEMPLATE", "")
+	viper.SetDefault("PNG_LOGO_URL", "")
+	viper.SetDefault("PNG_BRAND_COLOR", "")
+	viper.SetDefault("PNG_500_PAGE", "")
+	viper.SetDefault("PNG_MAX_PAGES", 0)
+	viper.SetDefault("PNG_MAX_PAGES_KEEP", 0)
+	viper.SetDefault("PNG_MAX_VERSIONS", 10)
+	viper.SetDefault("PNG_MAX_UPLOAD_SIZE", 10<<20)
+	viper.SetDefault("PNG_CREATE_PUBLIC_DIR", true)
+	viper.SetDefault("PNG_AUTO_REPAIR", false)
+	viper.SetDefault("PNG_COMPRESS_SOURCES", false)
+	viper.SetDefault("PNG_STRICT_JSON", false)
+	viper.SetDefault("PNG_MAX_JSON_DEPTH", 32)
+	viper.SetDefault("PNG_ALLOW_BINARY_HTML", false)
+	viper.SetDefault("PNG_BASE_URL", "")
+	viper.SetDefault("PNG_PATH_PREFIX", "")
+	viper.SetDefault("PNG_TRAILING_SLASH", trailingSlashRedirect)
+	viper.SetDefault("PNG_PUBLIC_READ", false)
+	viper.SetDefault("PNG_MAX_ASSET_SIZE", 10<<20)
+	viper.SetDefault("PNG_UPLOAD_BUFFER_SIZE", 32<<10)
+	viper.SetDefault("PNG_OPTIMIZE_IMAGES", false)
+	viper.SetDefault("PNG_IMAGE_QUALITY", 80)
+	viper.SetDefault("PNG_IMAGE_WEBP", false)
+	viper.SetDefault("PNG_IMAGE_MAX_SIZE", 10<<20)
+	viper.SetDefault("PNG_IMAGE_MAX_DIMENSION", 8000)
+	viper.SetDefault("PNG_IMAGE_TIMEOUT", 10*time.Second)
+	viper.SetDefault("PNG_READONLY", false)
+	viper.SetDefault("PNG_REQUIRE_CONFIRM", false)
+	viper.SetDefault("PNG_REQUEST_TIMEOUT", 30*time.Second)
+	viper.SetDefault("PNG_SERVER_READ_TIMEOUT", 60*time.Second)
+	viper.SetDefault("PNG_SERVER_WRITE_TIMEOUT", 60*time.Second)
+	viper.SetDefault("PNG_SERVER_IDLE_TIMEOUT", 120*time.Second)
+	viper.SetDefault("PNG_ADMIN_IP_ALLOWLIST", []string{})
+	viper.SetDefault("PNG_RATE_LIMIT", 0)
+	viper.SetDefault("PNG_RATE_LIMIT_BURST", 20)
+	viper.SetDefault("PNG_RATE_LIMIT_EXEMPT_PATHS", []string{"/api/version"})
+	viper.SetDefault("PNG_RATE_LIMIT_EXEMPT_IPS", []string{})
+	viper.SetDefault("PNG_CORS_ORIGINS", []string{})
+	viper.SetDefault("PNG_PAGE_CSP", defaultPageCSP)
+	viper.SetDefault("PNG_HTML_PAGE_CSP", "")
+	viper.SetDefault("PNG_DASHBOARD_CSP", defaultDashboardCSP)
+	viper.SetDefault("PNG_TRUSTED_PROXIES", []string{"127.0.0.1", "::1"})
+	viper.SetDefault("PNG_FORCE_HTTPS", false)
+	viper.SetDefault("PNG_FORCE_HTTPS_EXCLUDE", []string{"/api/version"})
+	viper.SetDefault("PNG_HSTS_MAX_AGE", 365*24*time.Hour)
+	viper.SetDefault("PNG_RENDER_TIMEOUT", 10*time.Second)
+	viper.SetDefault("PNG_FETCH_TIMEOUT", 15*time.Second)
+	viper.SetDefault("PNG_PDF_RENDERER", "")
+	viper.SetDefault("PNG_PDF_COMMAND", "")
+	viper.SetDefault("PNG_PDF_TIMEOUT", 30*time.Second)
+	viper.SetDefault("PNG_GIT_IMPORT", false)
+	viper.SetDefault("PNG_GIT_COMMAND", "git")
+	viper.SetDefault("PNG_GIT_TIMEOUT", 2*time.Minute)
+	viper.SetDefault("PNG_GIT_IMPORT_MAX_FILES", 500)
+	viper.SetDefault("PNG_MAX_RENDERED_SIZE", 10<<20)
+	viper.SetDefault("PNG_MAX_CONCURRENT_UPLOADS", 0)
+	viper.SetDefault("PNG_UPLOAD_QUEUE_TIMEOUT", 5*time.Second)
+	viper.SetDefault("PNG_API_DOCS_PUBLIC", false)
+	viper.SetDefault("PNG_IDEMPOTENCY_TTL", 24*time.Hour)
+	viper.SetDefault("PNG_DEDUPE", false)
+	viper.SetDefault("PNG_DEBUG_TIMINGS", false)
+	viper.SetDefault("PNG_SLOW_REQUEST_MS", 0)
+	viper.SetDefault("PNG_REQUEST_ID_HEADER", "X-Request-ID")
+	viper.SetDefault("PNG_TRACEPARENT", false)
+	viper.SetDefault("PNG_AUDIT_LOG", "")
+	viper.SetDefault("PNG_AUDIT_LOG_MAX_SIZE", 10<<20)
+	viper.SetDefault("PNG_ID_LENGTH", defaultIDLength)
+	viper.SetDefault("PNG_MAX_SLUG_LENGTH", 64)
+	viper.SetDefault("PNG_IGNORED_DIRS", []string{})
+	viper.SetDefault("PNG_MAX_TAGS", 20)
+	viper.SetDefault("PNG_MAX_TAG_LENGTH", 32)
+	viper.SetDefault("PNG_SLUG_CHECK_LIMIT", 30)
+	viper.SetDefault("PNG_ID_SCHEME", idSchemeRandom)
+	viper.SetDefault("PNG_TIMEZONE", "UTC")
+	viper.SetDefault("PNG_DEFAULT_THEME", "github")
+	viper.SetDefault("PNG_DEFAULT_LANG", "en")
+	viper.SetDefault("PNG_DEFAULT_DIR", "")
+	viper.SetDefault("PNG_DEFAULT_TYPE", "markdown")
+	viper.SetDefault("PNG_ALLOWED_TYPES", []string{"markdown", "html", "text"})
+	viper.SetDefault("PNG_VIEW_COUNTS", true)
+	viper.SetDefault("PNG_VIEWS_FILE", filepath.Join("public", ".views.json"))
+	viper.SetDefault("PNG_VIEWS_FLUSH_INTERVAL", 30*time.Second)
+	viper.SetDefault("PNG_DELETED_PAGES_FILE", filepath.Join("public", ".deleted.json"))
+	viper.SetDefault("PNG_REDIRECTS_FILE", filepath.Join("public", ".redirects.json"))
+	viper.SetDefault("PNG_LAZY_IMAGES", false)
+	viper.SetDefault("PNG_HEADING_ID_PREFIX", "")
+	viper.SetDefault("PNG_HARD_WRAPS", true)
+	viper.SetDefault("PNG_NUMBER_HEADINGS", false)
+	viper.SetDefault("PNG_TOC", false)
+	viper.SetDefault("PNG_TOC_MIN_LEVEL", 2)
+	viper.SetDefault("PNG_TOC_MAX_LEVEL", 3)
+	viper.SetDefault("PNG_MINIFY", false)
+	viper.SetDefault("PNG_MARKDOWN_UNSAFE", true)
+	viper.SetDefault("PNG_MARKDOWN_UNSAFE_ALLOWED", true)
+	viper.SetDefault("PNG_MARKDOWN_EMOJI", true)
+	viper.SetDefault("PNG_MARKDOWN_TABLES", true)
+	viper.SetDefault("PNG_MARKDOWN_STRIKETHROUGH", true)
+	viper.SetDefault("PNG_MARKDOWN_LINKIFY", true)
+	viper.SetDefault("PNG_MARKDOWN_TASK_LISTS", true)
+	viper.SetDefault("PNG_MARKDOWN_ATTRIBUTES", false)
+	viper.SetDefault("PNG_HIGHLIGHT", false)
+	viper.SetDefault("PNG_HIGHLIGHT_STYLE", "github")
+	viper.SetDefault("PNG_HIGHLIGHT_DETECT", false)
+	viper.SetDefault("PNG_HIGHLIGHT_DETECT_THRESHOLD", 0.5)
+	viper.SetDefault("PNG_INTERACTIVE_TASKS", false)
+	viper.SetDefault("PNG_LINK_SCHEMES", []string{"http", "https", "mailto"})
+	viper.SetDefault("PNG_HEADING_ANCHORS", false)
+	viper.SetDefault("PNG_CUSTOM_HEAD", "")
+	viper.SetDefault("PNG_CUSTOM_HEAD_FILE", "")
+	viper.SetDefault("PNG_PAGE_FOOTER", "")
+	viper.SetDefault("PNG_SITE_TITLE", "")
+	viper.SetDefault("PNG_ARTICLE_TAG", "article")
+	viper.SetDefault("PNG_ARTICLE_CLASS", "markdown-body")
+	viper.SetDefault("PNG_PAGE_ATTRIBUTION", false)
+	viper.SetDefault("PNG_BACKLINKS_FOOTER", false)
+	viper.SetDefault("PNG_ROOT_MODE", rootModeDashboard)
+	viper.SetDefault("PNG_ROOT_FILE", "")
+	viper.SetDefault("PNG_ROBOTS_TXT", "")
+	viper.SetDefault("PNG_ROBOTS_TXT_FILE", "")
+	viper.SetDefault("PNG_SITEMAP_URL", "")
+	viper.SetDefault("PNG_PAGE_CACHE_ENTRIES", 0)
+	viper.SetDefault("PNG_PAGE_CACHE_BYTES", 32<<20)
+	viper.AutomaticEnv()
+	if configFile := os.Getenv("PNG_CONFIG_FILE"); configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return Config{}, fmt.Errorf("Unable to read PNG_CONFIG_FILE: %w", err)
+		}
+	}
+	if err := checkSetupFile(viper.GetString("PNG_SETUP_FILE")); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_SETUP_FILE: %w", err)
+	}
+	if err := mergeSetupFile(viper.GetString("PNG_SETUP_FILE")); err != nil {
+		return Config{}, fmt.Errorf("Unable to read PNG_SETUP_FILE: %w", err)
+	}
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return Config{}, fmt.Errorf("Unable to decode config into struct, %w", err)
+	}
+	if cfg.StrictPassword {
+		if reason := passwordWeakness(cfg); reason != "" {
+			return Config{}, fmt.Errorf("Invalid PNG_PASSWORD: %s (PNG_STRICT_PASSWORD is enabled)", reason)
+		}
+	}
+	if cfg.SessionTTL < time.Minute || cfg.RememberTTL < time.Minute {
+		return Config{}, errors.New("Invalid PNG_SESSION_TTL or PNG_REMEMBER_TTL: sessions must last at least a minute")
+	}
+	if cfg.IdleTimeout != 0 && cfg.IdleTimeout < 2*sessionActivityInterval {
+		return Config{}, fmt.Errorf("Invalid PNG_IDLE_TIMEOUT: must be 0 (no idle limit) or at least %s", 2*sessionActivityInterval)
+	}
+	allowlist, err := parseAllowlist(cfg.AdminIPAllowlist)
+	if err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_ADMIN_IP_ALLOWLIST: %w", err)
+	}
+	cfg.adminAllowlist = allowlist
+	if cfg.RateLimit < 0 {
+		return Config{}, errors.New("Invalid PNG_RATE_LIMIT: must be 0 (no limit) or a positive number of requests per second")
+	}
+	if cfg.RateLimitBurst < 1 {
+		return Config{}, errors.New("Invalid PNG_RATE_LIMIT_BURST: must be at least 1")
+	}
+	if cfg.rateLimitExempt, err = parseAllowlist(cfg.RateLimitExemptIPs); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_RATE_LIMIT_EXEMPT_IPS: %w", err)
+	}
+	var exemptPaths []string
+	for _, path := range cfg.RateLimitExemptPaths {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			return Config{}, fmt.Errorf("Invalid PNG_RATE_LIMIT_EXEMPT_PATHS: %q must be a path starting with /", path)
+		}
+		exemptPaths = append(exemptPaths, path)
+	}
+	cfg.RateLimitExemptPaths = exemptPaths
+	if cfg.corsOrigins, err = parseCORSOrigins(cfg.CORSOrigins); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_CORS_ORIGINS: %w", err)
+	}
+	if !cookieNamePattern.MatchString(cfg.CookieName) {
+		return Config{}, fmt.Errorf("Invalid PNG_COOKIE_NAME: %q is not a legal cookie name", cfg.CookieName)
+	}
+	if _, err := parseSameSite(cfg.CookieSameSite); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_COOKIE_SAMESITE: %w", err)
+	}
+	if cfg.ReadingWPM <= 0 {
+		return Config{}, errors.New("Invalid PNG_READING_WPM: must be a positive number of words per minute")
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	cfg.PathPrefix = strings.TrimRight(cfg.PathPrefix, "/")
+	if cfg.PathPrefix != "" && (!strings.HasPrefix(cfg.PathPrefix, "/") || strings.ContainsAny(cfg.PathPrefix, "?#% ")) {
+		return Config{}, fmt.Errorf("Invalid PNG_PATH_PREFIX: expected a path such as /blog, got %q", cfg.PathPrefix)
+	}
+	if cfg.BaseURL != "" {
+		if u, err := url.Parse(cfg.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("Invalid PNG_BASE_URL: expected an absolute http(s) URL, got %q", cfg.BaseURL)
+		}
+	}
+	if cfg.LogoURL != "" {
+		if u, err := url.Parse(cfg.LogoURL); err != nil || (u.Scheme != "http" && u.Scheme != "https" && !strings.HasPrefix(cfg.LogoURL, "/")) || u.User != nil {
+			return Config{}, fmt.Errorf("Invalid PNG_LOGO_URL: expected an http(s) URL or an absolute path, got %q", cfg.LogoURL)
+		}
+	}
+	if cfg.BrandColor != "" {
+		if _, err := parseHexColor(cfg.BrandColor); err != nil {
+			return Config{}, fmt.Errorf("Invalid PNG_BRAND_COLOR: %w", err)
+		}
+	}
+	if cfg.SitemapURL != "" {
+		if u, err := url.Parse(cfg.SitemapURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("Invalid PNG_SITEMAP_URL: expected an absolute http(s) URL, got %q", cfg.SitemapURL)
+		}
+	}
+	switch cfg.TrailingSlash {
+	case trailingSlashRedirect, trailingSlashServe, trailingSlashStrict:
+	default:
+		return Config{}, fmt.Errorf("Invalid PNG_TRAILING_SLASH: must be one of redirect, serve, strict, got %q", cfg.TrailingSlash)
+	}
+	if cfg.IDLength != defaultIDLength && (cfg.IDLength < minIDLength || cfg.IDLength > maxIDLength) {
+		return Config{}, fmt.Errorf("Invalid PNG_ID_LENGTH: must be between %d and %d, or 0 for the default IDs", minIDLength, maxIDLength)
+	}
+	if cfg.MaxSlugLength < 1 || cfg.MaxSlugLength > maxFolderNameLength {
+		return Config{}, fmt.Errorf("Invalid PNG_MAX_SLUG_LENGTH: must be between 1 and %d", maxFolderNameLength)
+	}
+	var ignoredDirs []string
+	for _, name := range cfg.IgnoredDirs {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if strings.ContainsAny(name, `/\`) {
+			return Config{}, fmt.Errorf("Invalid PNG_IGNORED_DIRS: %q must be a directory name, not a path", name)
+		}
+		ignoredDirs = append(ignoredDirs, name)
+	}
+	cfg.IgnoredDirs = ignoredDirs
+	if cfg.MaxTags < 0 {
+		return Config{}, errors.New("Invalid PNG_MAX_TAGS: must be 0 (unlimited) or more")
+	}
+	if cfg.MaxTagLength < 1 || cfg.MaxTagLength > maxTagLength {
+		return Config{}, fmt.Errorf("Invalid PNG_MAX_TAG_LENGTH: must be between 1 and %d", maxTagLength)
+	}
+	if cfg.TOCMinLevel < 1 || cfg.TOCMaxLevel > 6 || cfg.TOCMinLevel > cfg.TOCMaxLevel {
+		return Config{}, errors.New("Invalid PNG_TOC_MIN_LEVEL or PNG_TOC_MAX_LEVEL: levels must go from 1 to 6, minimum first")
+	}
+	if !isHighlightStyle(cfg.HighlightStyle) {
+		return Config{}, fmt.Errorf("Invalid PNG_HIGHLIGHT_STYLE: unknown style %q", cfg.HighlightStyle)
+	}
+	if cfg.HighlightDetectThreshold <= 0 || cfg.HighlightDetectThreshold > 1 {
+		return Config{}, errors.New("Invalid PNG_HIGHLIGHT_DETECT_THRESHOLD: must be more than 0 and at most 1")
+	}
+	if cfg.SlugCheckLimit < 0 {
+		return Config{}, errors.New("Invalid PNG_SLUG_CHECK_LIMIT: must be 0 (unlimited) or more")
+	}
+	if cfg.idGenerator, err = newIDGenerator(cfg); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_ID_SCHEME: %w", err)
+	}
+	if cfg.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_TIMEZONE: %w", err)
+	}
+	if _, ok := builtinThemes[cfg.DefaultTheme]; !ok && cfg.DefaultTheme != themeNone {
+		return Config{}, fmt.Errorf("Invalid PNG_DEFAULT_THEME: must be none or one of github, blueprint, win98, got %q", cfg.DefaultTheme)
+	}
+	if !isLanguageTag(cfg.DefaultLang) {
+		return Config{}, fmt.Errorf("Invalid PNG_DEFAULT_LANG: expected a language tag such as en or pt-BR, got %q", cfg.DefaultLang)
+	}
+	if !slices.Contains([]string{"", "ltr", "rtl", "auto"}, cfg.DefaultDir) {
+		return Config{}, fmt.Errorf("Invalid PNG_DEFAULT_DIR: must be empty or one of ltr, rtl, auto, got %q", cfg.DefaultDir)
+	}
+	if !slices.Contains([]string{"markdown", "html", "text"}, cfg.DefaultType) {
+		return Config{}, fmt.Errorf("Invalid PNG_DEFAULT_TYPE: must be one of markdown, html, text, got %q", cfg.DefaultType)
+	}
+	for i, pageType := range cfg.AllowedTypes {
+		cfg.AllowedTypes[i] = strings.TrimSpace(pageType)
+		if !slices.Contains([]string{"markdown", "html", "text"}, cfg.AllowedTypes[i]) {
+			return Config{}, fmt.Errorf("Invalid PNG_ALLOWED_TYPES: %q is not one of markdown, html, text", pageType)
+		}
+	}
+	if !slices.Contains(cfg.AllowedTypes, cfg.DefaultType) {
+		return Config{}, fmt.Errorf("Invalid PNG_ALLOWED_TYPES: must include PNG_DEFAULT_TYPE %q", cfg.DefaultType)
+	}
+	if cfg.AssetCacheMaxAge < 0 {
+		return Config{}, errors.New("Invalid PNG_ASSET_CACHE_MAX_AGE: must be 0 or more")
+	}
+	if cfg.ViewsFlushInterval <= 0 {
+		return Config{}, errors.New("Invalid PNG_VIEWS_FLUSH_INTERVAL: must be a positive duration")
+	}
+	if !headingPrefixPattern.MatchString(strings.ReplaceAll(cfg.HeadingIDPrefix, pageIDPlaceholder, "")) {
+		return Config{}, errors.New("Invalid PNG_HEADING_ID_PREFIX: only letters, digits, '-', '_' and {id} are allowed")
+	}
+	for i, scheme := range cfg.LinkSchemes {
+		cfg.LinkSchemes[i] = strings.ToLower(strings.TrimSpace(scheme))
+		if cfg.LinkSchemes[i] != anyLinkScheme && !linkSchemePattern.MatchString(cfg.LinkSchemes[i]) {
+			return Config{}, fmt.Errorf("Invalid PNG_LINK_SCHEMES: %q is not a URL scheme", scheme)
+		}
+	}
+	switch cfg.ArticleTag {
+	case "article", "main", "section", "div":
+	default:
+		return Config{}, fmt.Errorf("Invalid PNG_ARTICLE_TAG: must be one of article, main, section, div, got %q", cfg.ArticleTag)
+	}
+	cfg.ArticleClass = strings.TrimSpace(cfg.ArticleClass)
+	switch cfg.RootMode {
+	case rootModeDashboard, rootModePageList:
+	case rootModeCustomFile:
+		if cfg.RootFile == "" {
+			return Config{}, errors.New("Invalid PNG_ROOT_FILE: required when PNG_ROOT_MODE is custom-file")
+		}
+	default:
+		return Config{}, fmt.Errorf("Invalid PNG_ROOT_MODE: must be one of dashboard, pagelist, custom-file, got %q", cfg.RootMode)
+	}
+	if cfg.MaxVersions < 0 {
+		return Config{}, errors.New("Invalid PNG_MAX_VERSIONS: must be 0 (no history) or more")
+	}
+	if cfg.MaxPagesKeep < 0 {
+		return Config{}, errors.New("Invalid PNG_MAX_PAGES_KEEP: must be 0 (keep everything) or more")
+	}
+	if cfg.MaxConcurrentUploads < 0 {
+		return Config{}, errors.New("Invalid PNG_MAX_CONCURRENT_UPLOADS: must be 0 (unlimited) or more")
+	}
+	if cfg.MaxUploadSize <= 0 {
+		return Config{}, errors.New("Invalid PNG_MAX_UPLOAD_SIZE: must be a positive number of bytes")
+	}
+	var exclude []string
+	for _, path := range cfg.ForceHTTPSExclude {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			return Config{}, fmt.Errorf("Invalid PNG_FORCE_HTTPS_EXCLUDE: %q must be a path starting with /", path)
+		}
+		exclude = append(exclude, path)
+	}
+	cfg.ForceHTTPSExclude = exclude
+	if cfg.HSTSMaxAge < 0 {
+		return Config{}, errors.New("Invalid PNG_HSTS_MAX_AGE: must be 0 (no header) or a positive duration such as 8760h")
+	}
+	if cfg.FetchTimeout <= 0 {
+		return Config{}, errors.New("Invalid PNG_FETCH_TIMEOUT: must be a positive duration such as 15s")
+	}
+	if cfg.pdfRenderer, err = newPDFRenderer(cfg); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_PDF_RENDERER: %w", err)
+	}
+	if cfg.PDFTimeout <= 0 {
+		return Config{}, errors.New("Invalid PNG_PDF_TIMEOUT: must be a positive duration such as 30s")
+	}
+	if cfg.GitCommand == "" {
+		return Config{}, errors.New("Invalid PNG_GIT_COMMAND: must not be empty")
+	}
+	if cfg.GitTimeout <= 0 {
+		return Config{}, errors.New("Invalid PNG_GIT_TIMEOUT: must be a positive duration such as 2m")
+	}
+	if cfg.GitImportMaxFiles < 0 {
+		return Config{}, errors.New("Invalid PNG_GIT_IMPORT_MAX_FILES: must be 0 (unlimited) or more")
+	}
+	if cfg.UploadBufferSize < 512 || cfg.UploadBufferSize > 16<<20 {
+		return Config{}, errors.New("Invalid PNG_UPLOAD_BUFFER_SIZE: must be between 512 bytes and 16 MiB")
+	}
+	if cfg.MaxJSONDepth < 0 {
+		return Config{}, errors.New("Invalid PNG_MAX_JSON_DEPTH: must be 0 (unlimited) or more")
+	}
+	if cfg.SlowRequestMS < 0 {
+		return Config{}, errors.New("Invalid PNG_SLOW_REQUEST_MS: must be 0 (disabled) or more")
+	}
+	if cfg.RequestIDHeader != "" && !headerNamePattern.MatchString(cfg.RequestIDHeader) {
+		return Config{}, fmt.Errorf("Invalid PNG_REQUEST_ID_HEADER: %q is not a header name", cfg.RequestIDHeader)
+	}
+	if cfg.ImageQuality < 1 || cfg.ImageQuality > 100 {
+		return Config{}, errors.New("Invalid PNG_IMAGE_QUALITY: must be between 1 and 100")
+	}
+	if cfg.ImageMaxSize < 0 {
+		return Config{}, errors.New("Invalid PNG_IMAGE_MAX_SIZE: must be 0 or more")
+	}
+	if cfg.ImageMaxDimension < 0 {
+		return Config{}, errors.New("Invalid PNG_IMAGE_MAX_DIMENSION: must be 0 or more")
+	}
+	if cfg.ImageTimeout < 0 {
+		return Config{}, errors.New("Invalid PNG_IMAGE_TIMEOUT: must be 0 or more")
+	}
+	if _, err := parseHexColor(cfg.OGBackground); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_OG_BACKGROUND: %w", err)
+	}
+	if _, err := parseHexColor(cfg.OGAccent); err != nil {
+		return Config{}, fmt.Errorf("Invalid PNG_OG_ACCENT: %w", err)
+	}
+	return cfg, nil
+}
+
+// createPageFile renders and stores a new page. If anything fails, including
+// the request being cancelled, the partially written folder is removed.
+func createPageFile(ctx context.Context, pageID string, req UploadRequest) error {
+	now := time.Now().UTC()
+	err := writePageFiles(ctx, pageID, req, PageMeta{CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		os.RemoveAll(filepath.Join("public", pageID))
+		return err
+	}
+	forgetDeletedPage(pageID)
+	forgetPageRedirect(pageID)
+	return nil
+}
+
+// updatePageFile re-renders an existing page, keeping its creation time. The
+// page's metadata stays locked until the new files are written, so changes
+// made meanwhile, such as pinning, are not overwritten.
+func updatePageFile(ctx context.Context, pageID string, req UploadRequest) error {
+	unlock := lockPageMeta(pageID)
+	defer unlock()
+	meta, err := readPageMeta(pageID)
+	if err != nil {
+		return fmt.Errorf("failed to read page metadata: %w", err)
+	}
+	meta.UpdatedAt = time.Now().UTC()
+	return writePageFiles(ctx, pageID, req, meta)
+}
+
+// renderedPage holds everything produced from an upload before any of it is
+// written to disk.
+type renderedPage struct {
+	html    string
+	ogImage []byte
+	// files maps the HTML file names of the additional files to their content.
+	files map[string]string
+	// scriptHashes allow the inline scripts of the trusted snippets.
+	scriptHashes []string
+}
+
+// renderPage builds a page's HTML, that of its additional files and its
+// preview image in memory, filling in the metadata derived from its content.
+func renderPage(ctx context.Context, pageID string, req UploadRequest, meta *PageMeta) (renderedPage, error) {
+	page, err := renderDocument(ctx, pageID, "", req, meta)
+	if err != nil {
+		return renderedPage{}, err
+	}
+	names := pageFileNames(req.Files)
+	if len(names) > 0 {
+		page.files = make(map[string]string, len(names))
+	}
+	for _, name := range names {
+		// Additional files take their title from their own content
+		fileReq := req
+		fileReq.Content, fileReq.Title, fileReq.Description, fileReq.Author = req.Files[name], "", "", ""
+		fileMeta := PageMeta{CreatedAt: meta.CreatedAt, UpdatedAt: meta.UpdatedAt}
+		file, err := renderDocument(ctx, pageID, pageFileHTMLName(name), fileReq, &fileMeta)
+		if err != nil {
+			return renderedPage{}, fmt.Errorf("%s: %w", name, err)
+		}
+		page.files[pageFileHTMLName(name)] = file.html
+		for _, hash := range file.scriptHashes {
+			if !slices.Contains(page.scriptHashes, hash) {
+				page.scriptHashes = append(page.scriptHashes, hash)
+			}
+		}
+	}
+	meta.Type = req.Type
+	meta.ContentHash = contentHash(req)
+	meta.Files = names
+	meta.Lang, meta.Dir = req.Lang, req.Dir
+	meta.Theme, meta.ThemeCSS = req.Theme, req.ThemeCSS
+	meta.HardWraps, meta.AllowRawHTML = req.HardWraps, req.AllowRawHTML
+	meta.NumberHeadings = req.NumberHeadings
+	meta.TOC, meta.TOCMinLevel, meta.TOCMaxLevel = req.TOC, req.TOCMinLevel, req.TOCMaxLevel
+	meta.HeadHTML, meta.FooterHTML = req.HeadHTML, req.FooterHTML
+	meta.OGType, meta.TwitterCard = req.OGType, req.TwitterCard
+	meta.Wrap = ""
+	if req.Type != "html" && req.Wrap == wrapFragment {
+		meta.Wrap = wrapFragment
+	}
+	renderedHTML := page.html
+	for _, html := range page.files {
+		renderedHTML += html
+	}
+	meta.Links = extractPageLinks(pageID, renderedHTML)
+	meta.ScriptHashes = page.scriptHashes
+	return page, nil
+}
+
+// renderDocument renders req.Content, the page's index.html when fileName is
+// empty and one of its additional files otherwise. Only the index gets a
+// preview image of its own.
+func renderDocument(ctx context.Context, pageID, fileName string, req UploadRequest, meta *PageMeta) (renderedPage, error) {
+	var page renderedPage
+	if req.Type == "markdown" || req.Type == "text" {
+		var htmlContent string
+		if req.Type == "markdown" {
+			parserContext := newMarkdownContext(pageID)
+			parserContext.Set(pageFilesContextKey, req.Files)
+			converter := markdownConverter(markdownOptionsFor(req))
+			rendered, err := renderMarkdown(ctx, converter, []byte(req.Content), parserContext)
+			if err != nil {
+				return renderedPage{}, err
+			}
+			htmlContent = rendered
+			lap(ctx, "render")
+			fm, err := parseFrontMatter(gmmeta.Get(parserContext))
+			if err != nil {
+				return renderedPage{}, err
+			}
+			if err := applyFrontMatter(meta, req, fm); err != nil {
+				return renderedPage{}, err
+			}
+			if meta.Title == "" {
+				meta.Title = extractTitle(htmlContent)
+			}
+			meta.ReadingMinutes = readingMinutes(htmlContent)
+		} else {
+			// Plain text is shown exactly as sent, so nothing in it is interpreted
+			htmlContent = `<pre class="plain-text">` + stdhtml.EscapeString(req.Content) + `</pre>`
+			if err := applyFrontMatter(meta, req, frontMatter{}); err != nil {
+				return renderedPage{}, err
+			}
+			if meta.Title == "" {
+				meta.Title = defaultPageTitle
+			}
+			meta.ReadingMinutes = 0
+		}
+
+		// Each file keeps its own task list state in the visitor's browser
+		taskListKey := pageID
+		backlinks := backlinksSection(pageID)
+		if fileName != "" {
+			taskListKey += "/" + fileName
+			backlinks = ""
+		}
+
+		canonicalURL := ""
+		if pageURL := absolutePageURL(pageID); pageURL != "" {
+			canonicalURL = pageURL + fileName
+		}
+
+		ogImageURL := ""
+		// Fragments have no head to reference a preview image from
+		fragment := req.Wrap == wrapFragment
+		if getConfig().OGImage && !fragment {
+			if fileName == "" {
+				ogImage, err := generateOGImage(meta.Title)
+				if err != nil {
+					return renderedPage{}, fmt.Errorf("failed to generate og image: %w", err)
+				}
+				page.ogImage = ogImage
+				lap(ctx, "ogImage")
+			}
+			ogImageURL = pagePath(pageID) + ogImageFileName
+			if pageURL := absolutePageURL(pageID); pageURL != "" {
+				ogImageURL = pageURL + ogImageFileName
+			}
+		}
+
+		snippet := snippetData{ID: pageID, Title: meta.Title, URL: pagePath(pageID) + fileName, Published: meta.CreatedAt, Updated: meta.UpdatedAt}
+		var buf bytes.Buffer
+		articleStartTag, articleEndTag := articleTags()
+		layout := "page"
+		if fragment {
+			layout = "article"
+		}
+		customHead, pageHead := customHeadTag(snippet), pageHeadTag(req)
+		pageFooter, footer := pageFooterHTMLTag(req), pageFooterTag(snippet)
+		page.scriptHashes = inlineScriptHashes(customHead, pageHead, pageFooter, footer)
+		err := pageTemplate.ExecuteTemplate(&buf, layout, pageLayoutData{
+			StartTag:           template.HTML(htmlStartTag(req)),
+			Title:              meta.Title,
+			CanonicalURL:       canonicalURL,
+			DescriptionTags:    template.HTML(descriptionTags(meta.Description)),
+			OGImageURL:         ogImageURL,
+			SocialTags:         template.HTML(socialTags(req, meta, canonicalURL, ogImageURL != "")),
+			ThemeCSS:           template.CSS(pageThemeCSS(req)),
+			HeadingAnchorStyle: template.HTML(headingAnchorStyle()),
+			CustomHead:         template.HTML(customHead),
+			PageHead:           template.HTML(pageHead),
+			ArticleStartTag:    articleStartTag,
+			ArticleEndTag:      articleEndTag,
+			ReadingMinutes:     meta.ReadingMinutes,
+			Content:            template.HTML(htmlContent),
+			Backlinks:          template.HTML(backlinks),
+			PageFooter:         template.HTML(pageFooter),
+			Footer:             template.HTML(footer),
+			TaskListScript:     template.HTML(taskListScript(taskListKey, htmlContent)),
+		})
+		if err != nil {
+			return renderedPage{}, fmt.Errorf("failed to render page: %w", err)
+		}
+		page.html = buf.String()
+		if getConfig().Minify {
+			page.html = minifyHTML(page.html)
+		}
+	} else {
+		// Word counts are unreliable for raw HTML, so no estimate is given
+		meta.ReadingMinutes = 0
+		if err := applyFrontMatter(meta, req, frontMatter{}); err != nil {
+			return renderedPage{}, err
+		}
+		page.html = req.Content
+	}
+	return page, nil
+}
+
+// writePageFiles renders the page first and only touches the page folder once
+// rendering has succeeded, so invalid content never leaves files behind.
+func writePageFiles(ctx context.Context, pageID string, req UploadRequest, meta PageMeta) error {
+	previousFiles := meta.Files
+	page, err := renderPage(ctx, pageID, req, &meta)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	folderPath := filepath.Join("public", pageID)
+	if err := os.MkdirAll(folderPath, 0755); err != nil {
+		return fmt.Errorf("failed to create content directory: %w", err)
+	}
+	if err := writePageSource(folderPath, []byte(req.Content)); err != nil {
+		return fmt.Errorf("failed to write raw source file: %w", err)
+	}
+	if page.ogImage != nil {
+		if err := os.WriteFile(filepath.Join(folderPath, ogImageFileName), page.ogImage, 0644); err != nil {
+			return fmt.Errorf("failed to write og image: %w", err)
+		}
+	}
+	if err := writeAdditionalFiles(folderPath, req.Files, page.files, previousFiles); err != nil {
+		return err
 	}
 	filePath := filepath.Join(folderPath, "index.html")
-	if err := os.WriteFile(filePath, []byte(finalContent), 0644); err != nil {
+	if err := os.WriteFile(filePath, []byte(page.html), 0644); err != nil {
 		return fmt.Errorf("failed to write rendered html file: %w", err)
 	}
+	if meta.RenderHash, err = hashRenderedPage(folderPath, meta.Files); err != nil {
+		return fmt.Errorf("failed to hash rendered files: %w", err)
+	}
+	if err := writePageMeta(pageID, meta); err != nil {
+		return fmt.Errorf("failed to write page metadata: %w", err)
+	}
+	updatePageLinks(pageID, meta.Links)
+	lap(ctx, "write")
 	return nil
 }
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+// setTestConfig makes cfg the configuration for the rest of the test.
+func setTestConfig(t *testing.T, cfg Config) {
+	t.Helper()
+	previous := currentConfig.Load()
+	currentConfig.Store(&cfg)
+	t.Cleanup(func() { currentConfig.Store(previous) })
+}
+
+// defaultTestConfig returns the configuration with every setting at its
+// default, for tests rendering whole pages.
+func defaultTestConfig(t *testing.T) Config {
+	t.Helper()
+	t.Setenv("PNG_USERNAME", "admin")
+	t.Setenv("PNG_PASSWORD", "Xy9!long-passw0rd")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *cfg
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	emoji "github.com/yuin/goldmark-emoji"
+	gmmeta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// markdownOptions are the settings a markdown converter is built from. It is
+// comparable, so converters can be cached per option set.
+type markdownOptions struct {
+	HardWraps     bool
+	Unsafe        bool
+	Emoji         bool
+	Tables        bool
+	Strikethrough bool
+	Linkify       bool
+	TaskLists     bool
+	// Attributes enables {.class #id} attribute lists on blocks.
+	Attributes bool
+	// NumberHeadings prepends section numbers to headings.
+	NumberHeadings bool
+	// TOC adds a table of contents of the headings from TOCMinLevel to
+	// TOCMaxLevel.
+	TOC         bool
+	TOCMinLevel int
+	TOCMaxLevel int
+	// Highlight colors fenced code with HighlightStyle, guessing the
+	// language of untagged blocks if HighlightDetect.
+	Highlight          bool
+	HighlightStyle     string
+	HighlightDetect    bool
+	HighlightThreshold float32
+}
+
+// markdownConverters caches one converter per markdownOptions, as building
+// a goldmark instance is far more expensive than looking one up.
+var markdownConverters sync.Map
+
+// markdownOptionsFor derives the options for an upload from the current
+// configuration and the upload's own overrides.
+func markdownOptionsFor(req UploadRequest) markdownOptions {
+	cfg := getConfig()
+	opts := markdownOptions{
+		HardWraps:      cfg.HardWraps,
+		Unsafe:         cfg.MarkdownUnsafe && cfg.MarkdownUnsafeAllowed,
+		Emoji:          cfg.MarkdownEmoji,
+		Tables:         cfg.MarkdownTables,
+		Strikethrough:  cfg.MarkdownStrikethrough,
+		Linkify:        cfg.MarkdownLinkify,
+		TaskLists:      cfg.MarkdownTaskLists,
+		Attributes:     cfg.MarkdownAttributes,
+		NumberHeadings: cfg.NumberHeadings,
+		TOC:            cfg.TOC,
+		TOCMinLevel:    cfg.TOCMinLevel,
+		TOCMaxLevel:    cfg.TOCMaxLevel,
+	}
+	if cfg.Highlight {
+		opts.Highlight = true
+		opts.HighlightStyle = cfg.HighlightStyle
+		opts.HighlightDetect = cfg.HighlightDetect
+		opts.HighlightThreshold = float32(cfg.HighlightDetectThreshold)
+	}
+	if req.HardWraps != nil {
+		opts.HardWraps = *req.HardWraps
+	}
+	if req.NumberHeadings != nil {
+		opts.NumberHeadings = *req.NumberHeadings
+	}
+	if req.TOC != nil {
+		opts.TOC = *req.TOC
+	}
+	if req.TOCMinLevel != nil {
+		opts.TOCMinLevel = *req.TOCMinLevel
+	}
+	if req.TOCMaxLevel != nil {
+		opts.TOCMaxLevel = *req.TOCMaxLevel
+	}
+	if !opts.TOC {
+		// Levels without a table would only multiply the cached converters
+		opts.TOCMinLevel, opts.TOCMaxLevel = 0, 0
+	}
+	if req.AllowRawHTML != nil {
+		opts.Unsafe = *req.AllowRawHTML && cfg.MarkdownUnsafeAllowed
+	}
+	return opts
+}
+
+// checkRawHTMLAllowed rejects uploads asking for raw HTML in markdown when
+// PNG_MARKDOWN_UNSAFE_ALLOWED forbids it, rather than quietly dropping it.
+func checkRawHTMLAllowed(req UploadRequest) error {
+	if req.AllowRawHTML != nil && *req.AllowRawHTML && !getConfig().MarkdownUnsafeAllowed {
+		return errors.New("allowRawHTML is not permitted on this server")
+	}
+	return nil
+}
+
+// markdownConverter returns the cached converter for opts, building it on
+// first use.
+func markdownConverter(opts markdownOptions) goldmark.Markdown {
+	if converter, ok := markdownConverters.Load(opts); ok {
+		return converter.(goldmark.Markdown)
+	}
+	converter, _ := markdownConverters.LoadOrStore(opts, buildMarkdown(opts))
+	return converter.(goldmark.Markdown)
+}
+
+func buildMarkdown(opts markdownOptions) goldmark.Markdown {
+	var rendererOptions []renderer.Option
+	if opts.HardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+	if opts.Unsafe {
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+	// The GFM sub-extensions are composed one by one so each can be toggled
+	extensions := []goldmark.Extender{gmmeta.Meta}
+	if opts.Tables {
+		extensions = append(extensions, extension.Table)
+	}
+	if opts.Strikethrough {
+		extensions = append(extensions, extension.Strikethrough)
+	}
+	if opts.Linkify {
+		extensions = append(extensions, extension.Linkify)
+	}
+	if opts.TaskLists {
+		extensions = append(extensions, extension.TaskList)
+	}
+	if opts.Emoji {
+		// Shortcodes become Unicode emoji; code spans and blocks keep them literal
+		extensions = append(extensions, emoji.New(emoji.WithRenderingMethod(emoji.Unicode)))
+	}
+	transformers := []util.PrioritizedValue{
+		util.Prioritized(lazyImageTransformer{}, 500),
+		util.Prioritized(prefixedLinkTransformer{}, 500),
+		util.Prioritized(linkSchemeTransformer{}, 500),
+		util.Prioritized(headingAnchorTransformer{}, 500),
+		util.Prioritized(pageFileLinkTransformer{}, 500),
+	}
+	if opts.NumberHeadings {
+		transformers = append(transformers, util.Prioritized(headingNumberTransformer{}, 500))
+	}
+	if opts.TOC {
+		transformers = append(transformers, util.Prioritized(tocTransformer{MinLevel: opts.TOCMinLevel, MaxLevel: opts.TOCMaxLevel}, 500))
+	}
+	if opts.Highlight {
+		highlighter := codeHighlighter{
+			Style:     opts.HighlightStyle,
+			Detect:    opts.HighlightDetect,
+			Threshold: opts.HighlightThreshold,
+		}
+		rendererOptions = append(rendererOptions, renderer.WithNodeRenderers(util.Prioritized(highlighter, 200)))
+	}
+	parserOptions := []parser.Option{parser.WithAutoHeadingID()}
+	if opts.Attributes {
+		// Attributes are set before the other transformers, which may rely
+		// on the classes and IDs authors gave
+		parserOptions = append(parserOptions, parser.WithAttribute())
+		transformers = append(transformers, util.Prioritized(blockAttributeTransformer{Unsafe: opts.Unsafe}, 600))
+	}
+	parserOptions = append(parserOptions, parser.WithASTTransformers(transformers...))
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const metaFileName = "meta.json"
+
+// PageMeta is the metadata stored alongside a page in meta.json.
+type PageMeta struct {
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Type        string    `json:"type"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	Draft       bool      `json:"draft,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	// Pinned pages are never removed by PNG_MAX_PAGES_KEEP.
+	Pinned bool `json:"pinned,omitempty"`
+	// Unlisted pages are served but left out of public listings.
+	Unlisted bool `json:"unlisted,omitempty"`
+
+	ReadingMinutes int `json:"readingMinutes,omitempty"`
+	// ContentHash identifies duplicate uploads for PNG_DEDUPE.
+	ContentHash string `json:"contentHash,omitempty"`
+	// RenderHash identifies the rendered output, for the immutable URL.
+	RenderHash string `json:"renderHash,omitempty"`
+	// ScriptHashes allow the inline scripts of the custom head and footers
+	// the page was rendered with in its Content-Security-Policy.
+	ScriptHashes []string `json:"scriptHashes,omitempty"`
+	// Files lists the additional files of a multi-file page, whose sources
+	// are kept in the files folder.
+	Files []string `json:"files,omitempty"`
+	// Links lists the other pages this one links to, for backlinks.
+	Links []string `json:"links,omitempty"`
+	// Lang and Dir are the ones sent with the upload, empty for the defaults.
+	Lang string `json:"lang,omitempty"`
+	Dir  string `json:"dir,omitempty"`
+	// The styling and rendering choices of the upload, so re-rendering the
+	// page from its source gives the same result.
+	Theme          string  `json:"theme,omitempty"`
+	ThemeCSS       *string `json:"themeCSS,omitempty"`
+	HardWraps      *bool   `json:"hardWraps,omitempty"`
+	NumberHeadings *bool   `json:"numberHeadings,omitempty"`
+	TOC            *bool   `json:"toc,omitempty"`
+	TOCMinLevel    *int    `json:"tocMinLevel,omitempty"`
+	TOCMaxLevel    *int    `json:"tocMaxLevel,omitempty"`
+	AllowRawHTML   *bool   `json:"allowRawHTML,omitempty"`
+	HeadHTML       string  `json:"headHTML,omitempty"`
+	FooterHTML     string  `json:"footerHTML,omitempty"`
+	Wrap           string  `json:"wrap,omitempty"`
+	OGType         string  `json:"ogType,omitempty"`
+	TwitterCard    string  `json:"twitterCard,omitempty"`
+	// ImportSource and ImportPath are the repository, with its branch, and
+	// the file a page was imported from by POST /api/import/git.
+	ImportSource string `json:"importSource,omitempty"`
+	ImportPath   string `json:"importPath,omitempty"`
+}
+
+// readPageMeta loads a page's meta.json. Pages published before metadata
+// existed fall back to the folder's modification time.
+func readPageMeta(pageID string) (PageMeta, error) {
+	folderPath := filepath.Join("public", pageID)
+	data, err := os.ReadFile(filepath.Join(folderPath, metaFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		info, statErr := os.Stat(folderPath)
+		if statErr != nil {
+			return PageMeta{}, statErr
+		}
+		modTime := info.ModTime().UTC()
+		return PageMeta{CreatedAt: modTime, UpdatedAt: modTime}, nil
+	}
+	if err != nil {
+		return PageMeta{}, err
+	}
+
+	var meta PageMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return PageMeta{}, err
+	}
+	return meta, nil
+}
+
+// writePageMeta stores a page's meta.json atomically, so readers never see a
+// partially written file. Callers changing existing metadata must hold the
+// page's lock from lockPageMeta, or use updatePageMeta.
+func writePageMeta(pageID string, meta PageMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join("public", pageID, metaFileName), data, 0644)
+}
+
+// pageMetaLocks holds one mutex per page ID, serializing the
+// read-modify-write cycles on its meta.json.
+var pageMetaLocks sync.Map
+
+// lockPageMeta locks a page's metadata and returns the function unlocking it.
+func lockPageMeta(pageID string) func() {
+	value, _ := pageMetaLocks.LoadOrStore(pageID, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// updatePageMeta reads a page's metadata, applies update and writes the
+// result, all under the page's lock, so concurrent updates are not lost.
+// Nothing is written when update returns an error.
+func updatePageMeta(pageID string, update func(meta *PageMeta) error) (PageMeta, error) {
+	unlock := lockPageMeta(pageID)
+	defer unlock()
+	meta, err := readPageMeta(pageID)
+	if err != nil {
+		return PageMeta{}, err
+	}
+	if err := update(&meta); err != nil {
+		return PageMeta{}, err
+	}
+	if err := writePageMeta(pageID, meta); err != nil {
+		return PageMeta{}, err
+	}
+	return meta, nil
+}
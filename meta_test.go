@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestPage creates public/pageID with the given metadata in a temporary
+// working directory.
+func newTestPage(t *testing.T, pageID string, meta PageMeta) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join("public", pageID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePageMeta(pageID, meta); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentMetaUpdates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	newTestPage(t, "page", PageMeta{Type: "markdown", Title: "Page"})
+	views := &viewCounter{counts: map[string]int64{}}
+	viewsPath := filepath.Join("public", ".views.json")
+
+	const tags = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*tags)
+	for i := range tags {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := updatePageMeta("page", func(meta *PageMeta) error {
+				meta.Tags = append(meta.Tags, fmt.Sprintf("tag-%02d", i))
+				return nil
+			})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := updatePageMeta("page", func(meta *PageMeta) error {
+				meta.Pinned = true
+				return nil
+			})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			views.increment("page")
+			errs <- views.flush(viewsPath)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join("public", "page", metaFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta PageMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("meta.json is not valid JSON: %v\n%s", err, data)
+	}
+	if !meta.Pinned || meta.Title != "Page" {
+		t.Errorf("meta = %+v, want the page pinned with its title kept", meta)
+	}
+	if len(meta.Tags) != tags {
+		t.Fatalf("got %d tags, want %d: %v", len(meta.Tags), tags, meta.Tags)
+	}
+	for i := range tags {
+		if !slices.Contains(meta.Tags, fmt.Sprintf("tag-%02d", i)) {
+			t.Errorf("tag-%02d was lost", i)
+		}
+	}
+	if got := views.get("page"); got != tags {
+		t.Errorf("views = %d, want %d", got, tags)
+	}
+	if entries, _ := filepath.Glob(filepath.Join("public", "page", ".tmp-*")); len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestUpdatePageMeta(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	errRefused := errors.New("refused")
+	tests := []struct {
+		name    string
+		update  func(meta *PageMeta) error
+		wantErr error
+		want    PageMeta
+	}{
+		{
+			name:   "change is written",
+			update: func(meta *PageMeta) error { meta.Pinned = true; return nil },
+			want:   PageMeta{CreatedAt: created, Type: "markdown", Pinned: true},
+		},
+		{
+			name:    "nothing is written when update fails",
+			update:  func(meta *PageMeta) error { meta.Pinned = true; return errRefused },
+			wantErr: errRefused,
+			want:    PageMeta{CreatedAt: created, Type: "markdown"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			newTestPage(t, "page", PageMeta{CreatedAt: created, Type: "markdown"})
+			if _, err := updatePageMeta("page", tt.update); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("updatePageMeta error = %v, want %v", err, tt.wantErr)
+			}
+			got, err := readPageMeta("page")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.CreatedAt.Equal(tt.want.CreatedAt) || got.Type != tt.want.Type || got.Pinned != tt.want.Pinned {
+				t.Errorf("stored meta = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatePageMetaMissingPage(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if _, err := updatePageMeta("missing", func(*PageMeta) error { return nil }); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("error = %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/html"
+)
+
+// keptComments are the markers the server finds rendered pages by later, so
+// they survive minifying.
+var keptComments = []string{articleStart, articleEnd, backlinksStart, backlinksEnd}
+
+// htmlMinifier removes comments and collapses whitespace, leaving pre and
+// textarea content exactly as rendered. Only HTML is minified: inline styles
+// and scripts are copied as they are, the latter having to match the hashes
+// in the page CSP. Document and end tags are kept so the page still reads
+// as written to anything parsing it later.
+var htmlMinifier = func() *minify.M {
+	m := minify.New()
+	m.Add("text/html", &html.Minifier{
+		KeepDocumentTags: true,
+		KeepEndTags:      true,
+		KeepQuotes:       true,
+	})
+	return m
+}()
+
+// minifyHTML implements PNG_MINIFY. The parts between keptComments are
+// minified separately so the markers stay in place. Should the document not
+// minify, it is returned unchanged.
+func minifyHTML(document string) string {
+	var out strings.Builder
+	out.Grow(len(document))
+	rest := document
+	for rest != "" {
+		end, marker := len(rest), ""
+		for _, comment := range keptComments {
+			if i := strings.Index(rest, comment); i >= 0 && i < end {
+				end, marker = i, comment
+			}
+		}
+		minified, err := htmlMinifier.String("text/html", rest[:end])
+		if err != nil {
+			return document
+		}
+		out.WriteString(minified)
+		out.WriteString(marker)
+		rest = rest[end+len(marker):]
+	}
+	return out.String()
+}
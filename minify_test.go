@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "whitespace between blocks collapses",
+			input: "<div>\n\n  <p>one   two\n three</p>\n</div>",
+			want:  "<div><p>one two\nthree</p></div>",
+		},
+		{
+			name:  "comments are removed",
+			input: "<p>a<!-- note -->b</p>",
+			want:  "<p>ab</p>",
+		},
+		{
+			name:  "markers are kept",
+			input: articleStart + "<article>\n  <p>x</p>\n</article>" + articleEnd + "\n" + backlinksStart + "<ul>\n<li>y</li>\n</ul>" + backlinksEnd,
+			want:  articleStart + "<article><p>x</p></article>" + articleEnd + backlinksStart + "<ul><li>y</li></ul>" + backlinksEnd,
+		},
+		{
+			name:  "pre content is untouched",
+			input: "<pre><code>func main() {\n\n    fmt.Println(\"a  b\")  \n}\n</code></pre>",
+			want:  "<pre><code>func main() {\n\n    fmt.Println(\"a  b\")  \n}\n</code></pre>",
+		},
+		{
+			name:  "highlighted pre with spans is untouched",
+			input: "<pre style=\"color:#1f2328\"><code><span style=\"display:flex\"><span>  x   =  1\n</span></span></code></pre>",
+			want:  "<pre style=\"color:#1f2328\"><code><span style=\"display:flex\"><span>  x   =  1\n</span></span></code></pre>",
+		},
+		{
+			name:  "textarea content is untouched",
+			input: "<textarea name=\"t\">  line one\n\n  line two  </textarea>",
+			want:  "<textarea name=\"t\">  line one\n\n  line two  </textarea>",
+		},
+		{
+			name:  "inline script is untouched",
+			input: "<script data-page-id=\"p\">" + taskListJS + "</script>",
+			want:  "<script data-page-id=\"p\">" + taskListJS + "</script>",
+		},
+		{
+			name:  "inline style is untouched",
+			input: "<style>\n  .a  >  b { color : red ; }\n</style>",
+			want:  "<style>\n  .a  >  b { color : red ; }\n</style>",
+		},
+		{
+			name:  "attribute values keep their quotes and spaces",
+			input: `<a href="/x?a=1&amp;b=2" title="two  words" class="a b">l</a>`,
+			want:  `<a href="/x?a=1&amp;b=2" title="two  words" class="a b">l</a>`,
+		},
+		{
+			name:  "attribute values with quotes stay quoted",
+			input: `<img alt="say &quot;hi&quot; &amp; it's" src="a.png">`,
+			want:  `<img alt='say "hi" & it&#39;s' src="a.png">`,
+		},
+		{
+			name:  "text cannot turn into markup",
+			input: "<p>&lt;b&gt; &amp;lt; &amp; &nbsp;x</p>",
+			want:  "<p>&lt;b> &amp;lt; & &nbsp;x</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minifyHTML(tt.input); got != tt.want {
+				t.Errorf("minifyHTML(%q)\n got %q\nwant %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinifyHTMLKeepsScriptHash(t *testing.T) {
+	setTestConfig(t, Config{InteractiveTasks: true})
+	page := "<html><head></head><body>\n<article>\n<ul><li><input type=\"checkbox\"> a</li></ul>\n</article>\n" +
+		taskListScript("p", `type="checkbox"`) + "\n</body></html>"
+	if !strings.Contains(minifyHTML(page), taskListJS) {
+		t.Fatal("minifying changed the task list script, which would no longer match its CSP hash")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MovePageRequest is the body of POST /api/pages/:id/move. Redirect defaults
+// to true, leaving the old URL redirecting to the new one.
+type MovePageRequest struct {
+	NewID    string `json:"newId"    binding:"required"`
+	Redirect *bool  `json:"redirect"`
+}
+
+// handleMovePage gives a page a new ID, renaming its folder with its
+// assets, versions and metadata, and re-renders it so its own URLs match.
+// The old URL redirects to the new one unless the request or
+// PNG_REDIRECTS_FILE turns that off. Other pages linking to the old URL are
+// not rewritten; the redirect keeps their links working.
+func handleMovePage(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	var req MovePageRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	newID, err := normalizeSlug(req.NewID)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
+	}
+	if newID == pageID {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "newId is already the page's ID")
+		return
+	}
+
+	// Slugs are claimed under pageCreateMu, so no upload can take newID
+	// between the check and the rename
+	pageCreateMu.Lock()
+	defer pageCreateMu.Unlock()
+	folderPath := filepath.Join("public", pageID)
+	if _, err := os.Stat(folderPath); os.IsNotExist(err) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+	newPath := filepath.Join("public", newID)
+	if _, err := os.Lstat(newPath); err == nil {
+		respondError(c, http.StatusConflict, codePageExists, "A page with this ID already exists")
+		return
+	}
+
+	unlock := lockPageMeta(pageID)
+	err = os.Rename(folderPath, newPath)
+	unlock()
+	if err != nil {
+		log.Printf("Error moving %s to %s: %v", folderPath, newPath, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to move page")
+		return
+	}
+	// Canonical URLs, heading IDs and immutable URLs embed the page ID
+	err = repairPage(c.Request.Context(), newID, "")
+	if err != nil && !errors.Is(err, errNoSource) && !errors.Is(err, errNoType) {
+		if rollbackErr := os.Rename(newPath, folderPath); rollbackErr != nil {
+			log.Printf("Error moving %s back to %s: %v", newPath, folderPath, rollbackErr)
+		}
+		writePageError(c, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Moved page %s without re-rendering it: %v", newID, err)
+	}
+
+	pageCache.remove(pageID)
+	pageViews.move(pageID, newID)
+	removePageLinks(pageID)
+	forgetDeletedPage(newID)
+	forgetPageRedirect(newID)
+	if req.Redirect == nil || *req.Redirect {
+		recordPageRedirect(pageID, pageRedirectPath(newID))
+	}
+	recordMoveAudit(c, pageID, newID)
+	pageEvents.publish(eventPageDeleted, pageID)
+	pageEvents.publish(eventPageCreated, newID)
+	respondJSON(c, http.StatusOK, pageURLs(c, newID))
+}
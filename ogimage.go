@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	ogImageFileName = "og.png"
+	ogImageWidth    = 1200
+	ogImageHeight   = 630
+	ogImagePadding  = 80
+	ogFontSize      = 64
+	ogMaxLines      = 5
+)
+
+// readOGFont parses the card font configured in cfg, defaulting to Go Regular.
+func readOGFont(cfg Config) (*opentype.Font, error) {
+	data := goregular.TTF
+	if cfg.OGFont != "" {
+		fontData, err := os.ReadFile(cfg.OGFont)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+		data = fontData
+	}
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	return parsed, nil
+}
+
+// parseHexColor parses #rgb or #rrggbb colors.
+func parseHexColor(value string) (color.RGBA, error) {
+	hexValue := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(hexValue) == 3 {
+		hexValue = strings.Repeat(hexValue[0:1], 2) + strings.Repeat(hexValue[1:2], 2) + strings.Repeat(hexValue[2:3], 2)
+	}
+	if len(hexValue) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", value)
+	}
+	rgb, err := strconv.ParseUint(hexValue, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", value)
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, nil
+}
+
+// generateOGImage renders a social sharing card with the page title.
+func generateOGImage(title string) ([]byte, error) {
+	cfg := getConfig()
+	background, err := parseHexColor(cfg.OGBackground)
+	if err != nil {
+		return nil, err
+	}
+	accent, err := parseHexColor(cfg.OGAccent)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(cfg.ogFont, &opentype.FaceOptions{Size: ogFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %w", err)
+	}
+	defer face.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, ogImageWidth, ogImageHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+	accentBar := image.Rect(0, ogImageHeight-24, ogImageWidth, ogImageHeight)
+	draw.Draw(img, accentBar, &image.Uniform{C: accent}, image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	lineHeight := face.Metrics().Height
+	y := fixed.I(ogImagePadding) + face.Metrics().Ascent
+	for _, line := range wrapText(drawer, title, fixed.I(ogImageWidth-2*ogImagePadding)) {
+		drawer.Dot = fixed.Point26_6{X: fixed.I(ogImagePadding), Y: y}
+		drawer.DrawString(line)
+		y += lineHeight
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// wrapText splits text into lines that fit within maxWidth, truncating with
+// an ellipsis after ogMaxLines.
+func wrapText(drawer *font.Drawer, text string, maxWidth fixed.Int26_6) []string {
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if current != "" && drawer.MeasureString(candidate) > maxWidth {
+			lines = append(lines, current)
+			current = word
+		} else {
+			current = candidate
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	if len(lines) > ogMaxLines {
+		lines = lines[:ogMaxLines]
+		lines[ogMaxLines-1] += "…"
+	}
+	return lines
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrphanPage is a page folder without an index.html, typically left behind by
+// an interrupted write or a manual edit. It is listed but cannot be viewed.
+type OrphanPage struct {
+	ID string `json:"id"`
+	// Repairable is true when source.txt is still there to re-render from.
+	Repairable bool `json:"repairable"`
+}
+
+func findOrphanPages() ([]OrphanPage, error) {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		return nil, err
+	}
+	orphans := []OrphanPage{}
+	for _, entry := range entries {
+		if !isPageDir(entry) {
+			continue
+		}
+		folderPath := filepath.Join("public", entry.Name())
+		if _, err := os.Stat(filepath.Join(folderPath, "index.html")); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		orphans = append(orphans, OrphanPage{ID: entry.Name(), Repairable: hasPageSource(folderPath)})
+	}
+	return orphans, nil
+}
+
+// warnOrphanPages logs the orphaned page folders found at startup.
+func warnOrphanPages() {
+	orphans, err := findOrphanPages()
+	if err != nil {
+		log.Printf("Error scanning for orphaned pages: %v", err)
+		return
+	}
+	for _, orphan := range orphans {
+		if orphan.Repairable {
+			log.Printf("WARNING: page %s has no index.html; repair it with POST /api/pages/%s/repair", orphan.ID, orphan.ID)
+		} else {
+			log.Printf("WARNING: page %s has no index.html and no source.txt; it can only be deleted", orphan.ID)
+		}
+	}
+}
+
+func handleListOrphans(c *gin.Context) {
+	orphans, err := findOrphanPages()
+	if err != nil {
+		log.Printf("Error scanning for orphaned pages: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list pages")
+		return
+	}
+	respondJSON(c, http.StatusOK, orphans)
+}
+
+var (
+	errNoSource = errors.New("source file not found")
+	errNoType   = errors.New("type is required: the page has no metadata to take it from")
+)
+
+// repairPage re-renders a page from its preserved source.txt with the current
+// settings, keeping the choices stored in meta.json such as its theme. Pages
+// published before those were stored get PNG_DEFAULT_THEME. The type comes
+// from meta.json unless pageType overrides it.
+func repairPage(ctx context.Context, pageID, pageType string) error {
+	source, _, err := readPageSource(pageID)
+	if errors.Is(err, os.ErrNotExist) {
+		return errNoSource
+	}
+	if err != nil {
+		return fmt.Errorf("could not read source: %w", err)
+	}
+	meta, err := readPageMeta(pageID)
+	if err != nil {
+		return fmt.Errorf("could not read metadata: %w", err)
+	}
+	if pageType == "" {
+		pageType = meta.Type
+	}
+	if pageType == "" {
+		return errNoType
+	}
+
+	files, err := readPageFiles(filepath.Join("public", pageID), meta.Files)
+	if err != nil {
+		return fmt.Errorf("could not read file sources: %w", err)
+	}
+
+	req := storedRequest(source, pageType, meta, files)
+	err = updatePageFile(ctx, pageID, req)
+	pageCache.remove(pageID)
+	return err
+}
+
+// storedRequest rebuilds the upload a page was rendered from out of its
+// source, additional files and the choices stored in its metadata.
+func storedRequest(source []byte, pageType string, meta PageMeta, files map[string]string) UploadRequest {
+	return UploadRequest{
+		Content:        string(source),
+		Type:           pageType,
+		Tags:           meta.Tags,
+		Draft:          &meta.Draft,
+		Visibility:     pageVisibility(meta),
+		Files:          files,
+		Lang:           meta.Lang,
+		Dir:            meta.Dir,
+		Theme:          meta.Theme,
+		ThemeCSS:       meta.ThemeCSS,
+		HardWraps:      meta.HardWraps,
+		NumberHeadings: meta.NumberHeadings,
+		TOC:            meta.TOC,
+		TOCMinLevel:    meta.TOCMinLevel,
+		TOCMaxLevel:    meta.TOCMaxLevel,
+		AllowRawHTML:   meta.AllowRawHTML,
+		HeadHTML:       meta.HeadHTML,
+		FooterHTML:     meta.FooterHTML,
+		Wrap:           meta.Wrap,
+		Author:         meta.Author,
+		OGType:         meta.OGType,
+		TwitterCard:    meta.TwitterCard,
+	}
+}
+
+// handleRepairPage re-renders a page from its source, taking the type from
+// the request body for pages that have no meta.json.
+func handleRepairPage(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+
+	var body struct {
+		Type string `json:"type" binding:"omitempty,oneof=markdown html text"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := bindJSON(c, &body); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	err := repairPage(c.Request.Context(), pageID, body.Type)
+	switch {
+	case errors.Is(err, errNoSource):
+		respondError(c, http.StatusNotFound, codeNotFound, "Source file not found")
+		return
+	case errors.Is(err, errNoType):
+		respondError(c, http.StatusBadRequest, codeInvalidType, err.Error())
+		return
+	case err != nil:
+		writePageError(c, err)
+		return
+	}
+	recordAudit(c, auditActionEdit, pageID)
+	pageEvents.publish(eventPageUpdated, pageID)
+	respondJSON(c, http.StatusOK, pageURLs(c, pageID))
+}
+
+// isUnrenderedPage reports whether a page folder exists without an
+// index.html, as left behind by an interrupted upload.
+func isUnrenderedPage(pageID string) bool {
+	info, err := os.Stat(filepath.Join("public", pageID))
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	_, err = os.Stat(filepath.Join("public", pageID, "index.html"))
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// autoRepairPage re-renders an unrendered page from its source when
+// PNG_AUTO_REPAIR is set and the server is not read-only, reporting whether
+// the page now has an index.html.
+func autoRepairPage(ctx context.Context, pageID string) bool {
+	if !getConfig().AutoRepair || readOnly.Load() {
+		return false
+	}
+	if err := repairPage(ctx, pageID, ""); err != nil {
+		log.Printf("Error auto-repairing page %s: %v", pageID, err)
+		return false
+	}
+	log.Printf("Auto-repaired page %s from its source", pageID)
+	pageEvents.publish(eventPageUpdated, pageID)
+	return true
+}
+
+// respondUnrendered answers a request for a page that has no rendered output
+// with a 503 explaining the page is broken rather than a 404.
+func respondUnrendered(c *gin.Context, pageID string) {
+	if wantsJSON(c) {
+		abortWithError(c, http.StatusServiceUnavailable, codePageUnrendered, "The page exists but has no rendered output: repair it with POST /api/pages/"+pageID+"/repair")
+		return
+	}
+	c.HTML(http.StatusServiceUnavailable, "503.html", nil)
+	c.Abort()
+}
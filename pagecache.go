@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cachedPage is a rendered index.html kept in memory.
+type cachedPage struct {
+	id      string
+	body    []byte
+	modTime time.Time
+}
+
+// pageLRU is a least-recently-used cache of rendered pages, bounded by
+// PNG_PAGE_CACHE_ENTRIES and PNG_PAGE_CACHE_BYTES.
+type pageLRU struct {
+	mu     sync.Mutex
+	order  *list.List
+	items  map[string]*list.Element
+	size   int64
+	hits   int64
+	misses int64
+}
+
+var pageCache = &pageLRU{order: list.New(), items: make(map[string]*list.Element)}
+
+func (l *pageLRU) get(id string) (*cachedPage, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[id]
+	if !ok {
+		l.misses++
+		return nil, false
+	}
+	l.hits++
+	l.order.MoveToFront(elem)
+	return elem.Value.(*cachedPage), true
+}
+
+// put stores a page, evicting the least recently used ones to stay within
+// the limits. Pages larger than the whole byte budget are not cached.
+func (l *pageLRU) put(page *cachedPage) {
+	cfg := getConfig()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if int64(len(page.body)) > cfg.PageCacheBytes {
+		return
+	}
+	if elem, ok := l.items[page.id]; ok {
+		l.removeElement(elem)
+	}
+	l.items[page.id] = l.order.PushFront(page)
+	l.size += int64(len(page.body))
+	for l.order.Len() > cfg.PageCacheEntries || l.size > cfg.PageCacheBytes {
+		l.removeElement(l.order.Back())
+	}
+}
+
+// remove drops a page after it was edited or deleted.
+func (l *pageLRU) remove(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.items[id]; ok {
+		l.removeElement(elem)
+	}
+}
+
+func (l *pageLRU) removeElement(elem *list.Element) {
+	page := l.order.Remove(elem).(*cachedPage)
+	delete(l.items, page.id)
+	l.size -= int64(len(page.body))
+}
+
+func (l *pageLRU) stats() gin.H {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return gin.H{
+		"enabled": getConfig().PageCacheEntries > 0,
+		"entries": l.order.Len(),
+		"bytes":   l.size,
+		"hits":    l.hits,
+		"misses":  l.misses,
+	}
+}
+
+// cachedPages answers requests for a page's index.html from memory when
+// PNG_PAGE_CACHE_ENTRIES is set, loading it from disk on a miss. Other
+// files, and pages that do not exist, are left to servePages.
+func cachedPages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if getConfig().PageCacheEntries <= 0 || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+		pageID, ok := strings.CutSuffix(strings.TrimPrefix(c.Request.URL.Path, "/"), "/")
+		if !ok || !isValidPageID(pageID) {
+			c.Next()
+			return
+		}
+
+		page, hit := pageCache.get(pageID)
+		if !hit {
+			filePath := filepath.Join("public", pageID, "index.html")
+			info, err := os.Stat(filePath)
+			if err != nil || info.IsDir() {
+				c.Next()
+				return
+			}
+			body, err := os.ReadFile(filePath)
+			if err != nil {
+				c.Next()
+				return
+			}
+			page = &cachedPage{id: pageID, body: body, modTime: info.ModTime()}
+			pageCache.put(page)
+		}
+
+		if hit {
+			c.Header("X-Cache", "HIT")
+		} else {
+			c.Header("X-Cache", "MISS")
+		}
+		http.ServeContent(c.Writer, c.Request, "index.html", page.modTime, bytes.NewReader(page.body))
+		c.Abort()
+	}
+}
+
+func handleCacheStats(c *gin.Context) {
+	respondJSON(c, http.StatusOK, pageCache.stats())
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// pageFilesDirName holds the sources of a page's additional files. Like
+// source.txt it is never served.
+const pageFilesDirName = "files"
+
+const indexFileStem = "index"
+
+var pageFileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}\.[A-Za-z0-9]{1,16}$`)
+
+// pageFilesContextKey carries an upload's additional files to
+// pageFileLinkTransformer.
+var pageFilesContextKey = parser.NewContextKey()
+
+var errPageFilesTooLarge = errors.New("page files too large")
+
+// pageFileHTMLName is the name a file is rendered to: chapter2.md becomes
+// chapter2.html.
+func pageFileHTMLName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".html"
+}
+
+// pageFileNames returns the names of the additional files in a stable order.
+func pageFileNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// normalizePageFiles validates the additional files of an upload. Names must
+// be plain file names, so nothing is written outside the page folder, and
+// must not render to the same HTML file. An index file is moved to Content,
+// and the total size of all files is bounded by PNG_MAX_UPLOAD_SIZE.
+func normalizePageFiles(req *UploadRequest) error {
+	if len(req.Files) == 0 {
+		req.Files = nil
+		if req.Content == "" {
+			return errors.New("content is required")
+		}
+		return nil
+	}
+	files := make(map[string]string, len(req.Files))
+	htmlNames := map[string]string{}
+	total := int64(len(req.Content))
+	for name, content := range req.Files {
+		if !pageFileNamePattern.MatchString(name) || filepath.Base(name) != name {
+			return fmt.Errorf("invalid file name %q: use letters, digits, '-' and '_' followed by an extension", name)
+		}
+		htmlName := pageFileHTMLName(name)
+		if other, ok := htmlNames[htmlName]; ok {
+			return fmt.Errorf("files %q and %q would both be rendered to %s", other, name, htmlName)
+		}
+		htmlNames[htmlName] = name
+		total += int64(len(content))
+		if strings.TrimSuffix(name, filepath.Ext(name)) == indexFileStem {
+			if req.Content != "" {
+				return fmt.Errorf("%s conflicts with content: send the index either way, not both", name)
+			}
+			req.Content = content
+			continue
+		}
+		files[name] = content
+	}
+	if req.Content == "" {
+		return errors.New("content or an index file such as index.md is required")
+	}
+	if maxSize := getConfig().MaxUploadSize; total > maxSize {
+		return fmt.Errorf("%w: the files total %d bytes, more than the maximum of %d", errPageFilesTooLarge, total, maxSize)
+	}
+	req.Files = files
+	if len(files) == 0 {
+		req.Files = nil
+	}
+	return nil
+}
+
+// bindPageFiles runs normalizePageFiles, answering the request itself when
+// the files are rejected.
+func bindPageFiles(c *gin.Context, req *UploadRequest) bool {
+	err := normalizePageFiles(req)
+	switch {
+	case errors.Is(err, errPageFilesTooLarge):
+		respondError(c, http.StatusRequestEntityTooLarge, codeTooLarge, err.Error())
+		return false
+	case err != nil:
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// readPageFiles loads the sources of a page's additional files, as listed in
+// its metadata, from folderPath: the page folder or one of its versions.
+func readPageFiles(folderPath string, names []string) (map[string]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	files := make(map[string]string, len(names))
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(folderPath, pageFilesDirName, name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = string(content)
+	}
+	return files, nil
+}
+
+// writeAdditionalFiles stores the sources and rendered HTML of a page's
+// additional files, removing those a previous version had and this one drops.
+func writeAdditionalFiles(folderPath string, sources, rendered map[string]string, previous []string) error {
+	for _, name := range previous {
+		if _, ok := sources[name]; !ok {
+			os.Remove(filepath.Join(folderPath, pageFileHTMLName(name)))
+		}
+	}
+	sourcesPath := filepath.Join(folderPath, pageFilesDirName)
+	if err := os.RemoveAll(sourcesPath); err != nil {
+		return fmt.Errorf("failed to clear file sources: %w", err)
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(sourcesPath, 0755); err != nil {
+		return fmt.Errorf("failed to create file sources directory: %w", err)
+	}
+	for name, content := range sources {
+		if err := os.WriteFile(filepath.Join(sourcesPath, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write source of %s: %w", name, err)
+		}
+	}
+	for htmlName, html := range rendered {
+		if err := os.WriteFile(filepath.Join(folderPath, htmlName), []byte(html), 0644); err != nil {
+			return fmt.Errorf("failed to write rendered %s: %w", htmlName, err)
+		}
+	}
+	return nil
+}
+
+// pageFileLinkTransformer rewrites markdown links between the files of a
+// multi-file page, such as [Next](chapter2.md#intro), to their rendered HTML
+// files. Links to the index file point at the page folder.
+type pageFileLinkTransformer struct{}
+
+func (pageFileLinkTransformer) Transform(doc *ast.Document, _ text.Reader, pc parser.Context) {
+	files, _ := pc.Get(pageFilesContextKey).(map[string]string)
+	if len(files) == 0 {
+		return
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := n.(*ast.Link)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		target, fragment := link.Destination, []byte(nil)
+		if i := bytes.IndexAny(target, "?#"); i >= 0 {
+			target, fragment = target[:i], target[i:]
+		}
+		name := strings.TrimPrefix(string(target), "./")
+		if _, ok := files[name]; ok {
+			link.Destination = append([]byte(pageFileHTMLName(name)), fragment...)
+		} else if pageFileNamePattern.MatchString(name) && strings.TrimSuffix(name, filepath.Ext(name)) == indexFileStem {
+			link.Destination = append([]byte("./"), fragment...)
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkPageHTML validates the headHTML and footerHTML of an upload, answering
+// the request itself when they are rejected. They are raw HTML, so they are
+// only accepted where raw HTML is enabled for the page, and only for markdown
+// and text pages: raw HTML pages are complete documents already.
+func checkPageHTML(c *gin.Context, req UploadRequest) bool {
+	if req.HeadHTML == "" && req.FooterHTML == "" {
+		return true
+	}
+	if req.Type == "html" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "headHTML and footerHTML only apply to markdown and text pages")
+		return false
+	}
+	if !markdownOptionsFor(req).Unsafe {
+		message := "headHTML and footerHTML need raw HTML: send allowRawHTML or enable PNG_MARKDOWN_UNSAFE"
+		if !getConfig().MarkdownUnsafeAllowed {
+			message = "headHTML and footerHTML are not permitted on this server"
+		}
+		respondError(c, http.StatusForbidden, codeForbidden, message)
+		return false
+	}
+	if headBreakoutPattern.MatchString(req.HeadHTML) || headBreakoutPattern.MatchString(req.FooterHTML) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "headHTML and footerHTML must not contain <html>, <head> or <body> tags")
+		return false
+	}
+	return true
+}
+
+// pageHeadTag returns the page's own head elements, after the custom head.
+// Like the raw HTML in its content, they are dropped when the page is
+// re-rendered after raw HTML was disabled.
+func pageHeadTag(req UploadRequest) string {
+	head := strings.TrimSpace(req.HeadHTML)
+	if head == "" || !markdownOptionsFor(req).Unsafe {
+		return ""
+	}
+	return "<!-- page head -->\n" + head + "\n<!-- /page head -->"
+}
+
+// pageFooterHTMLTag returns the page's own footer, placed after its content
+// and before the footer shared by every page.
+func pageFooterHTMLTag(req UploadRequest) string {
+	footer := strings.TrimSpace(req.FooterHTML)
+	if footer == "" || !markdownOptionsFor(req).Unsafe {
+		return ""
+	}
+	return "<!-- page footer -->" + footer + "<!-- /page footer -->"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// pageLog is a small store of values keyed by the ID of a page that no
+// longer exists, such as when it was deleted or where it moved. It is saved
+// as a JSON object to its file on every change, changes being rare.
+type pageLog[V any] struct {
+	mu      sync.Mutex
+	entries map[string]V
+}
+
+func newPageLog[V any]() *pageLog[V] {
+	return &pageLog[V]{entries: map[string]V{}}
+}
+
+// load replaces the log with the one stored in path, if it exists. IDs that
+// were published again since are dropped.
+func (l *pageLog[V]) load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries := map[string]V{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for pageID := range entries {
+		if _, err := os.Stat(filepath.Join("public", pageID)); err == nil || !isValidPageID(pageID) {
+			delete(entries, pageID)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = entries
+	return nil
+}
+
+// get returns the entry of pageID, if it has one.
+func (l *pageLog[V]) get(pageID string) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	value, ok := l.entries[pageID]
+	return value, ok
+}
+
+// all returns a copy of every entry.
+func (l *pageLog[V]) all() map[string]V {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.entries)
+}
+
+// update lets change edit the entries under the lock, and saves the log to
+// path when change reports it modified them.
+func (l *pageLog[V]) update(path string, change func(entries map[string]V) bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !change(l.entries) {
+		return nil
+	}
+	data, err := json.Marshal(l.entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// remove drops the entry of pageID, reporting whether it had one, and saves
+// the log to path if it changed.
+func (l *pageLog[V]) remove(path, pageID string) (bool, error) {
+	var removed bool
+	err := l.update(path, func(entries map[string]V) bool {
+		_, removed = entries[pageID]
+		delete(entries, pageID)
+		return removed
+	})
+	return removed, err
+}
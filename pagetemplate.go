@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"log"
+	"time"
+)
+
+// pageLayout is the document generated around rendered markdown and text.
+// The parts marked template.HTML or template.CSS in pageLayoutData are built
+// and escaped by the server; everything else is escaped here. The "article"
+// template is the content element alone, stored as is for fragment pages.
+const pageLayout = `{{define "article"}}{{.ArticleStartTag}}{{if .ReadingMinutes}}<span class="reading-time">{{.ReadingMinutes}} min read</span>{{end}}{{.Content}}{{.Backlinks}}{{.ArticleEndTag}}{{end}}<!DOCTYPE html>
+{{.StartTag}}
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    {{with .CanonicalURL}}<link rel="canonical" href="{{.}}">{{end}}
+    <meta property="og:title" content="{{.Title}}">
+    {{.DescriptionTags}}
+    {{with .OGImageURL}}<meta property="og:image" content="{{.}}">{{end}}
+    {{.SocialTags}}
+    <style>{{.ThemeCSS}}</style>
+    {{.HeadingAnchorStyle}}{{.CustomHead}}{{.PageHead}}
+</head>
+<body>{{template "article" .}}{{.PageFooter}}{{.Footer}}{{.TaskListScript}}</body>
+</html>`
+
+// wrapFragment stores a markdown or text page as the element holding its
+// content only, instead of the full document sent by default ("full").
+const wrapFragment = "fragment"
+
+// articleStart and articleEnd surround the element wrapping the content, whose
+// tag is configurable, so it can be found again without parsing the page. They
+// are part of the tags as html/template drops comments from the layout.
+const (
+	articleStart = "<!-- article -->"
+	articleEnd   = "<!-- /article -->"
+)
+
+var pageTemplate = template.Must(template.New("page").Parse(pageLayout))
+
+// articleContentAttr marks the element wrapping the content whatever its tag
+// and class, so page scripts can select it.
+const articleContentAttr = "data-page-content"
+
+// articleTags are the tags of the element wrapping the content, from
+// PNG_ARTICLE_TAG and PNG_ARTICLE_CLASS, with their markers. The tag was
+// validated when loaded.
+func articleTags() (start, end template.HTML) {
+	cfg := getConfig()
+	startTag := "<" + cfg.ArticleTag + " " + articleContentAttr + ">"
+	if cfg.ArticleClass != "" {
+		startTag = "<" + cfg.ArticleTag + " " + articleContentAttr + ` class="` + html.EscapeString(cfg.ArticleClass) + `">`
+	}
+	return template.HTML(articleStart + startTag), template.HTML("</" + cfg.ArticleTag + ">" + articleEnd)
+}
+
+type pageLayoutData struct {
+	StartTag           template.HTML
+	Title              string
+	CanonicalURL       string
+	DescriptionTags    template.HTML
+	OGImageURL         string
+	SocialTags         template.HTML
+	ThemeCSS           template.CSS
+	HeadingAnchorStyle template.HTML
+	CustomHead         template.HTML
+	PageHead           template.HTML
+	ArticleStartTag    template.HTML
+	ArticleEndTag      template.HTML
+	ReadingMinutes     int
+	Content            template.HTML
+	Backlinks          template.HTML
+	PageFooter         template.HTML
+	Footer             template.HTML
+	TaskListScript     template.HTML
+}
+
+// snippetFuncs returns the helpers available to PNG_CUSTOM_HEAD and
+// PNG_PAGE_FOOTER: year is the current year, date formats the current time,
+// or the time given after the layout, in PNG_TIMEZONE with a Go layout such
+// as "January 2, 2006", and siteTitle is PNG_SITE_TITLE.
+func snippetFuncs(config func() *Config) template.FuncMap {
+	return template.FuncMap{
+		"year": func() int { return time.Now().In(config().location).Year() },
+		"date": func(layout string, t ...time.Time) string {
+			at := time.Now()
+			if len(t) > 0 {
+				at = t[0]
+			}
+			return at.In(config().location).Format(layout)
+		},
+		"siteTitle": func() string { return config().SiteTitle },
+	}
+}
+
+// snippetData describes the page a snippet is rendered into.
+type snippetData struct {
+	ID        string
+	Title     string
+	URL       string
+	Published time.Time
+	Updated   time.Time
+}
+
+// parseSnippet parses an operator-provided snippet. Its text is kept
+// verbatim; only the values of its actions are escaped. It is rendered once
+// against a sample page, with the configuration being loaded, so mistakes such
+// as an unknown field are reported then rather than on the next upload.
+func parseSnippet(name, snippet string, cfg *Config) (*template.Template, error) {
+	if snippet == "" {
+		return nil, nil
+	}
+	sample, err := template.New(name).Funcs(snippetFuncs(func() *Config { return cfg })).Parse(snippet)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := sample.Execute(&bytes.Buffer{}, snippetData{ID: "sample", Title: "Sample", URL: "/sample/", Published: now, Updated: now}); err != nil {
+		return nil, err
+	}
+	return template.New(name).Funcs(snippetFuncs(getConfig)).Parse(snippet)
+}
+
+// renderSnippet renders a snippet for a page, or "" when none is configured.
+// Snippets were checked when loaded, so a failure is only logged.
+func renderSnippet(tmpl *template.Template, data snippetData) string {
+	if tmpl == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("Error rendering %s for page %s: %v", tmpl.Name(), data.ID, err)
+		return ""
+	}
+	return buf.String()
+}
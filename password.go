@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords are rejected whatever PNG_MIN_PASSWORD_LENGTH is.
+var commonPasswords = map[string]bool{
+	"admin":     true,
+	"password":  true,
+	"changeme":  true,
+	"123456":    true,
+	"12345678":  true,
+	"123456789": true,
+	"qwerty":    true,
+	"letmein":   true,
+	"secret":    true,
+}
+
+// passwordWeakness explains why the configured password is weak, or returns
+// an empty string when it is acceptable or authentication is disabled.
+func passwordWeakness(cfg Config) string {
+	if cfg.Username == "" || cfg.Password == "" {
+		return ""
+	}
+	password := cfg.Password
+	switch {
+	case commonPasswords[strings.ToLower(password)]:
+		return "it is a commonly used password"
+	case strings.EqualFold(password, cfg.Username):
+		return "it is the same as PNG_USERNAME"
+	case len([]rune(password)) < cfg.MinPasswordLength:
+		return fmt.Sprintf("it is shorter than %d characters", cfg.MinPasswordLength)
+	case characterClasses(password) < 2:
+		return "it only uses one kind of character: mix letters, digits or symbols"
+	}
+	return ""
+}
+
+// characterClasses counts how many of lowercase letters, uppercase letters,
+// digits and other characters appear in s.
+func characterClasses(s string) int {
+	var lower, upper, digit, other int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// warnWeakPassword logs a warning when the password is weak but
+// PNG_STRICT_PASSWORD is off; with it on, the configuration is rejected.
+func warnWeakPassword() {
+	cfg := getConfig()
+	if reason := passwordWeakness(*cfg); reason != "" {
+		log.Printf("Warning: PNG_PASSWORD is weak (%s). Set PNG_STRICT_PASSWORD=true to refuse to start with such a password", reason)
+	}
+}
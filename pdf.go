@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PNG_PDF_RENDERER values.
+const (
+	pdfRendererWkhtmltopdf = "wkhtmltopdf"
+	pdfRendererChrome      = "chrome"
+)
+
+const pdfContentType = "application/pdf"
+
+// PDFRenderer converts a self-contained HTML file to PDF. Implementations
+// run an external program, which may not be installed.
+type PDFRenderer interface {
+	// Command is the program the renderer runs.
+	Command() string
+	Render(ctx context.Context, htmlPath, pdfPath string) error
+}
+
+// newPDFRenderer returns the renderer for PNG_PDF_RENDERER, nil when PDF
+// export is off. PNG_PDF_COMMAND replaces the default program name.
+func newPDFRenderer(cfg Config) (PDFRenderer, error) {
+	switch cfg.PDFRenderer {
+	case "":
+		return nil, nil
+	case pdfRendererWkhtmltopdf:
+		return wkhtmltopdfRenderer{command: cmp.Or(cfg.PDFCommand, "wkhtmltopdf")}, nil
+	case pdfRendererChrome:
+		return chromeRenderer{command: cmp.Or(cfg.PDFCommand, "chromium")}, nil
+	default:
+		return nil, fmt.Errorf("must be empty, wkhtmltopdf or chrome, got %q", cfg.PDFRenderer)
+	}
+}
+
+// wkhtmltopdfRenderer uses wkhtmltopdf. Scripts in the page are not run.
+type wkhtmltopdfRenderer struct {
+	command string
+}
+
+func (r wkhtmltopdfRenderer) Command() string { return r.command }
+
+func (r wkhtmltopdfRenderer) Render(ctx context.Context, htmlPath, pdfPath string) error {
+	return runPDFCommand(ctx, r.command, "--quiet", "--disable-javascript", htmlPath, pdfPath)
+}
+
+// chromeRenderer prints the page with headless Chrome or Chromium. Scripts in
+// the page are not run.
+type chromeRenderer struct {
+	command string
+}
+
+func (r chromeRenderer) Command() string { return r.command }
+
+func (r chromeRenderer) Render(ctx context.Context, htmlPath, pdfPath string) error {
+	return runPDFCommand(ctx, r.command, "--headless", "--disable-gpu", "--blink-settings=scriptEnabled=false",
+		"--no-pdf-header-footer", "--print-to-pdf="+pdfPath, "file://"+htmlPath)
+}
+
+// runPDFCommand runs a renderer, including its output in the error when it
+// fails.
+func runPDFCommand(ctx context.Context, command string, args ...string) error {
+	output, err := exec.CommandContext(ctx, command, args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// respondPDF converts an exported page to PDF and sends it as an attachment,
+// or answers 501 when no renderer is configured or installed.
+func respondPDF(c *gin.Context, pageID string, document []byte) {
+	cfg := getConfig()
+	if cfg.pdfRenderer == nil {
+		respondError(c, http.StatusNotImplemented, codePDFUnavailable, "PDF export is disabled: set PNG_PDF_RENDERER to enable it")
+		return
+	}
+	if _, err := exec.LookPath(cfg.pdfRenderer.Command()); err != nil {
+		log.Printf("PDF renderer unavailable: %v", err)
+		respondError(c, http.StatusNotImplemented, codePDFUnavailable, "The PDF renderer "+cfg.pdfRenderer.Command()+" is not installed")
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "press-n-go-pdf-")
+	if err != nil {
+		log.Printf("Error creating PDF work directory: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not render PDF")
+		return
+	}
+	defer os.RemoveAll(dir)
+	htmlPath, pdfPath := filepath.Join(dir, "page.html"), filepath.Join(dir, "page.pdf")
+	if err := os.WriteFile(htmlPath, document, 0600); err != nil {
+		log.Printf("Error writing PDF input for %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not render PDF")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.PDFTimeout)
+	defer cancel()
+	err = cfg.pdfRenderer.Render(ctx, htmlPath, pdfPath)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		respondError(c, http.StatusServiceUnavailable, codeTimeout, "PDF rendering timed out")
+		return
+	}
+	if err != nil {
+		log.Printf("Error rendering PDF of %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeRenderFailed, "Could not render PDF")
+		return
+	}
+	pdf, err := os.ReadFile(pdfPath)
+	if err != nil {
+		log.Printf("Error reading PDF of %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeRenderFailed, "Could not render PDF")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, pageID))
+	c.Data(http.StatusOK, pdfContentType, pdf)
+}
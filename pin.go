@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handlePinPage sets or clears a page's pinned flag. Pinned pages are skipped
+// by auto-pruning and can only be deleted with ?force=true. Only the metadata
+// changes, so the page is neither re-rendered nor marked as updated.
+func handlePinPage(pinned bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pageID := c.Param("id")
+		if !isValidPageID(pageID) {
+			respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+			return
+		}
+		if _, err := os.Stat(filepath.Join("public", pageID)); os.IsNotExist(err) {
+			respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+			return
+		}
+		changed := false
+		meta, err := updatePageMeta(pageID, func(meta *PageMeta) error {
+			changed = meta.Pinned != pinned
+			meta.Pinned = pinned
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error updating metadata for %s: %v", pageID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "Could not update page")
+			return
+		}
+		if changed {
+			recordAudit(c, auditActionEdit, pageID)
+			pageEvents.publish(eventPageUpdated, pageID)
+		}
+		respondJSON(c, http.StatusOK, newPage(pageID, meta))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withPathPrefix mounts handler under PNG_PATH_PREFIX: the prefix is removed
+// before routing, so the routes themselves stay rooted at "/", and requests
+// outside of it get a 404.
+func withPathPrefix(prefix string, handler http.Handler) http.Handler {
+	if prefix == "" {
+		return handler
+	}
+	stripped := http.StripPrefix(prefix, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// sitePath turns a path relative to the application root into the one
+// clients must use, including PNG_PATH_PREFIX.
+func sitePath(path string) string {
+	return getConfig().PathPrefix + path
+}
+
+// pagePath is the public path of a page.
+func pagePath(pageID string) string {
+	return sitePath("/" + pageID + "/")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPathPrefix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Join("public", "page1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("public", "page1", "index.html"), []byte("<p>page one</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setTestConfig(t, Config{
+		PathPrefix:    "/blog",
+		TrailingSlash: trailingSlashRedirect,
+		Username:      "admin",
+		Password:      "secret",
+	})
+
+	router := gin.New()
+	router.Use(servePages())
+	router.GET("/", authRequired(), func(c *gin.Context) { c.String(http.StatusOK, "panel") })
+	router.POST("/api/upload", func(c *gin.Context) { c.JSON(http.StatusOK, pageURLs(c, "page2")) })
+	handler := withPathPrefix("/blog", router)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		wantStatus   int
+		wantBody     string
+		wantLocation string
+	}{
+		{name: "page under the prefix", method: http.MethodGet, path: "/blog/page1/", wantStatus: http.StatusOK, wantBody: "<p>page one</p>"},
+		{name: "page index.html under the prefix", method: http.MethodGet, path: "/blog/page1/index.html", wantStatus: http.StatusOK, wantBody: "<p>page one</p>"},
+		{name: "page without the slash redirects within the prefix", method: http.MethodGet, path: "/blog/page1", wantStatus: http.StatusMovedPermanently, wantLocation: "/blog/page1/"},
+		{name: "prefix without the slash", method: http.MethodGet, path: "/blog", wantStatus: http.StatusMovedPermanently, wantLocation: "/blog/"},
+		{name: "page outside the prefix", method: http.MethodGet, path: "/page1/", wantStatus: http.StatusNotFound},
+		{name: "path merely starting like the prefix", method: http.MethodGet, path: "/blogger/page1/", wantStatus: http.StatusNotFound},
+		{name: "login redirect keeps the prefix", method: http.MethodGet, path: "/blog/", wantStatus: http.StatusFound, wantLocation: "/blog/login"},
+		{name: "returned URL includes the prefix", method: http.MethodPost, path: "/blog/api/upload", wantStatus: http.StatusOK,
+			wantBody: `{"absoluteUrl":"http://example.com/blog/page2/","url":"/blog/page2/"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if location := rec.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
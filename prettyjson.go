@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wantsPrettyJSON reports whether the client asked for indented JSON with
+// ?pretty=true, which is easier to read when calling the API by hand.
+func wantsPrettyJSON(c *gin.Context) bool {
+	return c.Query("pretty") == "true"
+}
+
+// respondJSON is c.JSON, indented when the client asked for it.
+func respondJSON(c *gin.Context, status int, obj any) {
+	if wantsPrettyJSON(c) {
+		c.IndentedJSON(status, obj)
+		return
+	}
+	c.JSON(status, obj)
+}
+
+// indentJSON indents an encoded response body for ?pretty=true, returning it
+// unchanged otherwise.
+func indentJSON(c *gin.Context, body []byte) []byte {
+	if !wantsPrettyJSON(c) {
+		return body
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "    "); err != nil {
+		return body
+	}
+	return indented.Bytes()
+}
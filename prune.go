@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prunePages deletes the oldest pages once there are more than
+// PNG_MAX_PAGES_KEEP, never touching pinned pages or the page just created.
+// It runs under pageCreateMu, after the upload has succeeded, so failures
+// are logged rather than reported to the client.
+func prunePages(c *gin.Context, keep int, createdID string) {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		log.Printf("Error reading public directory for pruning: %v", err)
+		return
+	}
+	type candidate struct {
+		id   string
+		meta PageMeta
+	}
+	var candidates []candidate
+	total := 0
+	for _, entry := range entries {
+		if !isPageDir(entry) {
+			continue
+		}
+		total++
+		meta, err := readPageMeta(entry.Name())
+		if err != nil {
+			log.Printf("Error reading metadata for %s: %v", entry.Name(), err)
+			continue
+		}
+		if meta.Pinned || entry.Name() == createdID {
+			continue
+		}
+		candidates = append(candidates, candidate{id: entry.Name(), meta: meta})
+	}
+	if total <= keep {
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].meta.CreatedAt.Before(candidates[j].meta.CreatedAt)
+	})
+	for _, page := range candidates[:min(total-keep, len(candidates))] {
+		if err := deletePage(c, page.id, auditActionPrune); err != nil {
+			log.Printf("Error auto-pruning page %s: %v", page.id, err)
+			continue
+		}
+		log.Printf("Auto-pruned page %s (created %s): more than %d pages", page.id, page.meta.CreatedAt.Format("2006-01-02 15:04:05"), keep)
+	}
+}
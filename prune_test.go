@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useTestDeletion points the deleted pages log and the audit log at a
+// temporary folder and returns the audit log's path.
+func useTestDeletion(t *testing.T) string {
+	t.Helper()
+	useTestPageLogs(t)
+	cfg := *getConfig()
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	setTestConfig(t, cfg)
+	t.Chdir(t.TempDir())
+	return cfg.AuditLog
+}
+
+// auditActions returns the action and page of every audit entry.
+func auditActions(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, entry.Action+" "+entry.PageID)
+	}
+	return actions
+}
+
+func TestPrunePages(t *testing.T) {
+	auditLog := useTestDeletion(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"oldest", "pinned", "older", "recent", "created"} {
+		newTestPage(t, id, PageMeta{Type: "markdown", CreatedAt: start.Add(time.Duration(i) * time.Hour), Pinned: id == "pinned"})
+	}
+	pageViews.increment("oldest")
+	events := pageEvents.subscribe()
+	defer pageEvents.unsubscribe(events)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/upload", nil)
+	prunePages(c, 3, "created")
+
+	for id, wantKept := range map[string]bool{"oldest": false, "older": false, "pinned": true, "recent": true, "created": true} {
+		_, err := os.Stat(filepath.Join("public", id))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", id, kept, wantKept)
+		}
+		if deleted := isDeletedPage(id); deleted == wantKept {
+			t.Errorf("%s recorded as deleted = %v, want %v", id, deleted, !wantKept)
+		}
+	}
+	if views := pageViews.get("oldest"); views != 0 {
+		t.Errorf("views of a pruned page = %d, want them forgotten", views)
+	}
+	if got := strings.Join(auditActions(t, auditLog), ", "); got != "prune oldest, prune older" {
+		t.Errorf("audit = %s, want both prunes", got)
+	}
+	for _, id := range []string{"oldest", "older"} {
+		if event := <-events; event.Type != eventPageDeleted || event.ID != id {
+			t.Errorf("event = %+v, want %s deleted", event, id)
+		}
+	}
+}
+
+func TestHandleDeletePage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auditLog := useTestDeletion(t)
+	newTestPage(t, "page", PageMeta{Type: "markdown"})
+	router := gin.New()
+	router.DELETE("/api/pages/:id", handleDeletePage)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/pages/page?redirect=/other/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join("public", "page")); !os.IsNotExist(err) {
+		t.Errorf("page folder still exists: %v", err)
+	}
+	if redirect, ok := findPageRedirect("page"); !ok || redirect.To != "/other/" {
+		t.Errorf("redirect = %+v, %v, want /other/", redirect, ok)
+	}
+	if got := strings.Join(auditActions(t, auditLog), ", "); got != "delete page" {
+		t.Errorf("audit = %s, want the deletion", got)
+	}
+}
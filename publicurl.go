@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var hostPattern = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?$|^\[[0-9A-Fa-f:.]+\](:[0-9]+)?$`)
+
+// pageURLs is the body returned after a page is written: its path and, when
+// it can be determined, its absolute URL.
+func pageURLs(c *gin.Context, pageID string) gin.H {
+	response := gin.H{"url": pagePath(pageID)}
+	if base := requestBaseURL(c); base != "" {
+		response["absoluteUrl"] = base + "/" + pageID + "/"
+	}
+	return response
+}
+
+// requestBaseURL is PNG_BASE_URL or, when it is unset, the address the
+// client used to reach the server, including PNG_PATH_PREFIX. The
+// X-Forwarded-Proto and X-Forwarded-Host headers are only honored from
+// PNG_TRUSTED_PROXIES. It is empty when the Host header is not a valid host.
+func requestBaseURL(c *gin.Context) string {
+	cfg := getConfig()
+	if cfg.BaseURL != "" {
+		return cfg.BaseURL
+	}
+
+	host := requestHost(c)
+	if !hostPattern.MatchString(host) {
+		return ""
+	}
+	return requestScheme(c) + "://" + host + cfg.PathPrefix
+}
+
+// requestScheme is the scheme the client used: the X-Forwarded-Proto of a
+// trusted proxy when it sends one, and otherwise that of the connection.
+func requestScheme(c *gin.Context) string {
+	if fromTrustedProxy(c) {
+		if proto := firstHeaderValue(c.GetHeader("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			return proto
+		}
+	}
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestHost is the host the client used: the X-Forwarded-Host of a trusted
+// proxy when it sends one, and otherwise the Host header. It is not validated.
+func requestHost(c *gin.Context) string {
+	if fromTrustedProxy(c) {
+		if forwardedHost := firstHeaderValue(c.GetHeader("X-Forwarded-Host")); forwardedHost != "" {
+			return forwardedHost
+		}
+	}
+	return c.Request.Host
+}
+
+// fromTrustedProxy reports whether the connection comes from one of
+// PNG_TRUSTED_PROXIES.
+func fromTrustedProxy(c *gin.Context) bool {
+	addr, err := netip.ParseAddr(c.RemoteIP())
+	if err != nil {
+		return false
+	}
+	// The list was validated when the router was set up
+	proxies, _ := parseAllowlist(trustedProxies())
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstHeaderValue returns the first entry of a comma-separated header, as
+// set by the proxy closest to the client.
+func firstHeaderValue(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.ToLower(strings.TrimSpace(first))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitSweepInterval is how often clients whose bucket has refilled are
+// forgotten.
+const rateLimitSweepInterval = time.Minute
+
+// maxRateLimitClients bounds the clients tracked at once. Past it, new
+// clients are not limited until the next sweep, rather than letting a flood of
+// addresses grow the table without end.
+const maxRateLimitClients = 100_000
+
+// tokenBucket holds the requests a client may still make, refilled at
+// PNG_RATE_LIMIT per second up to PNG_RATE_LIMIT_BURST.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketLimiter keeps one token bucket per client.
+type bucketLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+var requestLimiter = &bucketLimiter{buckets: map[string]*tokenBucket{}}
+
+// allow takes a token from the bucket of key and reports whether there was
+// one, along with how long until the next one when there was not.
+func (l *bucketLimiter) allow(key string, rate float64, burst int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now, rate, burst)
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitClients {
+			return true, 0
+		}
+		bucket = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = min(float64(burst), bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep forgets the clients whose bucket is full again: starting over with a
+// new one changes nothing for them.
+func (l *bucketLimiter) sweep(now time.Time, rate float64, burst int) {
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rate >= float64(burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitKey identifies the client of a request. IPv6 clients usually get a
+// whole /64, so they are counted per /64 rather than per address.
+func rateLimitKey(addr netip.Addr) string {
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
+
+// rateLimit implements PNG_RATE_LIMIT, holding each client to a number of
+// requests per second with bursts up to PNG_RATE_LIMIT_BURST, on every route.
+// Paths in PNG_RATE_LIMIT_EXEMPT_PATHS, such as health checks, and clients in
+// PNG_RATE_LIMIT_EXEMPT_IPS are never limited. Like PNG_ADMIN_IP_ALLOWLIST,
+// the client address comes from ClientIP().
+func rateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := getConfig()
+		if cfg.RateLimit <= 0 || slices.Contains(cfg.RateLimitExemptPaths, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err != nil {
+			c.Next()
+			return
+		}
+		addr = addr.Unmap()
+		for _, prefix := range cfg.rateLimitExempt {
+			if prefix.Contains(addr) {
+				c.Next()
+				return
+			}
+		}
+		if ok, retry := requestLimiter.allow(rateLimitKey(addr), cfg.RateLimit, cfg.RateLimitBurst); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			abortWithError(c, http.StatusTooManyRequests, codeRateLimited, "Too many requests, try again later")
+			return
+		}
+		c.Next()
+	}
+}
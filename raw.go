@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// articlePattern finds the content of pages rendered before the wrapper
+	// element was marked with articleStart and articleEnd.
+	articlePattern = regexp.MustCompile(`(?s)<article[ >].*</article>`)
+	markedPattern  = regexp.MustCompile(`(?s)` + regexp.QuoteMeta(articleStart) + `(.*?)` + regexp.QuoteMeta(articleEnd))
+	bodyPattern    = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+)
+
+// handleRawPage returns a page's rendered index.html. With ?fragment=true
+// only the content is returned, without the document head, so it can be
+// embedded in another page: the element wrapping the content of markdown and
+// text pages, <article> unless PNG_ARTICLE_TAG says otherwise, or the
+// inside of <body> for HTML pages.
+func handleRawPage(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	indexPath := filepath.Join("public", pageID, "index.html")
+	if c.Query("fragment") != "true" {
+		if _, err := os.Stat(indexPath); err != nil {
+			respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+			return
+		}
+		c.Header("Content-Type", htmlContentType)
+		c.File(indexPath)
+		return
+	}
+
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+	meta, err := readPageMeta(pageID)
+	if err != nil {
+		log.Printf("Error reading metadata for %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not read page")
+		return
+	}
+	c.Data(http.StatusOK, htmlContentType, pageFragment(data, meta.Type))
+}
+
+// pageFragment extracts the embeddable part of a rendered page, falling back
+// to the whole document when it has no <article> or <body>.
+func pageFragment(data []byte, pageType string) []byte {
+	if pageType == "markdown" || pageType == "text" {
+		if match := markedPattern.FindSubmatch(data); match != nil {
+			return match[1]
+		}
+		if article := articlePattern.Find(data); article != nil {
+			return article
+		}
+	}
+	if match := bodyPattern.FindSubmatch(data); match != nil {
+		return match[1]
+	}
+	return data
+}
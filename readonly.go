@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyRetryAfter is the Retry-After hint, in seconds, sent while writes
+// are blocked.
+const readOnlyRetryAfter = 300
+
+var readOnly atomic.Bool
+
+// setReadOnly switches maintenance mode, logging only actual transitions.
+func setReadOnly(enabled bool) {
+	if readOnly.Swap(enabled) == enabled {
+		return
+	}
+	if enabled {
+		log.Printf("Read-only mode enabled: uploads, edits and deletions are blocked")
+	} else {
+		log.Printf("Read-only mode disabled: writes are allowed again")
+	}
+}
+
+// readOnlyGuard rejects mutating requests while read-only mode is on.
+func readOnlyGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if readOnly.Load() {
+			c.Header("Retry-After", strconv.Itoa(readOnlyRetryAfter))
+			abortWithError(c, http.StatusServiceUnavailable, codeReadOnly, "The server is in read-only mode, please retry later")
+			return
+		}
+		c.Next()
+	}
+}
+
+func handleGetReadOnly(c *gin.Context) {
+	respondJSON(c, http.StatusOK, gin.H{"readOnly": readOnly.Load()})
+}
+
+func handleSetReadOnly(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	setReadOnly(*req.Enabled)
+	respondJSON(c, http.StatusOK, gin.H{"readOnly": readOnly.Load()})
+}
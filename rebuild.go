@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	rebuildRebuilt = "rebuilt"
+	rebuildSkipped = "skipped"
+	rebuildFailed  = "failed"
+)
+
+// RebuildResult is the outcome of re-rendering one page.
+type RebuildResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RebuildStatus reports the progress of the last rebuild started with
+// POST /api/admin/rebuild.
+type RebuildStatus struct {
+	Running    bool            `json:"running"`
+	Total      int             `json:"total"`
+	Done       int             `json:"done"`
+	Failed     int             `json:"failed"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Results    []RebuildResult `json:"results"`
+}
+
+// rebuildJob runs at most one rebuild at a time.
+type rebuildJob struct {
+	mu     sync.Mutex
+	status RebuildStatus
+}
+
+var pageRebuild = &rebuildJob{status: RebuildStatus{Results: []RebuildResult{}}}
+
+// snapshot returns a copy of the status that is safe to serialize.
+func (j *rebuildJob) snapshot() RebuildStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	status.Results = append([]RebuildResult{}, j.status.Results...)
+	return status
+}
+
+// start begins rebuilding pageIDs in the background, unless a rebuild is
+// already running.
+func (j *rebuildJob) start(pageIDs []string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.Running {
+		return false
+	}
+	now := time.Now().UTC()
+	j.status = RebuildStatus{Running: true, Total: len(pageIDs), StartedAt: &now, Results: []RebuildResult{}}
+	go j.run(pageIDs)
+	return true
+}
+
+func (j *rebuildJob) run(pageIDs []string) {
+	for _, pageID := range pageIDs {
+		result := rebuildPage(pageID)
+		j.mu.Lock()
+		j.status.Done++
+		if result.Status == rebuildFailed {
+			j.status.Failed++
+		}
+		j.status.Results = append(j.status.Results, result)
+		j.mu.Unlock()
+	}
+
+	j.mu.Lock()
+	now := time.Now().UTC()
+	j.status.Running = false
+	j.status.FinishedAt = &now
+	log.Printf("Rebuild finished: %d pages, %d failed", j.status.Total, j.status.Failed)
+	j.mu.Unlock()
+}
+
+// rebuildPage re-renders one page from its source with the current settings.
+// Raw HTML pages are served as uploaded, so there is nothing to rebuild.
+func rebuildPage(pageID string) RebuildResult {
+	meta, err := readPageMeta(pageID)
+	if err != nil {
+		return RebuildResult{ID: pageID, Status: rebuildFailed, Error: err.Error()}
+	}
+	if meta.Type == "html" {
+		return RebuildResult{ID: pageID, Status: rebuildSkipped}
+	}
+	if err := repairPage(context.Background(), pageID, ""); err != nil {
+		log.Printf("Error rebuilding page %s: %v", pageID, err)
+		return RebuildResult{ID: pageID, Status: rebuildFailed, Error: err.Error()}
+	}
+	pageEvents.publish(eventPageUpdated, pageID)
+	return RebuildResult{ID: pageID, Status: rebuildRebuilt}
+}
+
+// handleStartRebuild re-renders every page in the background, for instance
+// after changing the theme, custom head or markdown settings. Progress is
+// available from handleGetRebuild.
+func handleStartRebuild(c *gin.Context) {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		log.Printf("Error listing pages: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list pages")
+		return
+	}
+	var pageIDs []string
+	for _, entry := range entries {
+		if isPageDir(entry) {
+			pageIDs = append(pageIDs, entry.Name())
+		}
+	}
+	if !pageRebuild.start(pageIDs) {
+		respondError(c, http.StatusConflict, codeRebuildRunning, "A rebuild is already running")
+		return
+	}
+	log.Printf("Rebuild started: %d pages", len(pageIDs))
+	recordAudit(c, auditActionRebuild, "")
+	respondJSON(c, http.StatusAccepted, pageRebuild.snapshot())
+}
+
+func handleGetRebuild(c *gin.Context) {
+	respondJSON(c, http.StatusOK, pageRebuild.snapshot())
+}
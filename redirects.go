@@ -0,0 +1,175 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PageRedirect sends requests for a page that was moved or deleted
+// elsewhere. To is a path on this site, such as the /new-id/ of a moved page,
+// or an absolute http(s) URL.
+type PageRedirect struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// pageRedirects holds the redirects of moved and deleted pages, keyed by the
+// ID they redirect from, so old URLs keep working. It is kept in
+// PNG_REDIRECTS_FILE.
+var pageRedirects = newPageLog[PageRedirect]()
+
+// loadPageRedirects reads PNG_REDIRECTS_FILE at startup. An empty setting
+// disables redirects: moved and deleted pages then leave their old URL
+// answering 404 or 410.
+func loadPageRedirects() {
+	path := getConfig().RedirectsFile
+	if path == "" {
+		return
+	}
+	if err := pageRedirects.load(path); err != nil {
+		log.Printf("Warning: could not load page redirects from %s: %v", path, err)
+	}
+}
+
+// recordPageRedirect redirects from to to, along with the pages already
+// redirecting to from, so moving a page twice never chains redirects. A page
+// that would then redirect to itself loses its redirect instead. Failures are
+// logged but never fail the move or deletion that asked for it.
+func recordPageRedirect(from, to string) {
+	path := getConfig().RedirectsFile
+	if path == "" {
+		return
+	}
+	err := pageRedirects.update(path, func(redirects map[string]PageRedirect) bool {
+		for old, redirect := range redirects {
+			if redirect.To != pageRedirectPath(from) {
+				continue
+			}
+			if to == pageRedirectPath(old) {
+				delete(redirects, old)
+				continue
+			}
+			redirect.To = to
+			redirects[old] = redirect
+		}
+		redirects[from] = PageRedirect{From: from, To: to, CreatedAt: time.Now().UTC()}
+		return true
+	})
+	if err != nil {
+		log.Printf("Error saving page redirects to %s: %v", path, err)
+	}
+}
+
+// forgetPageRedirect is called when a page is published, in case its ID
+// belonged to a moved or deleted page.
+func forgetPageRedirect(pageID string) {
+	path := getConfig().RedirectsFile
+	if path == "" {
+		return
+	}
+	if _, err := pageRedirects.remove(path, pageID); err != nil {
+		log.Printf("Error saving page redirects to %s: %v", path, err)
+	}
+}
+
+// findPageRedirect returns the redirect of pageID, if redirects are enabled
+// and it has one.
+func findPageRedirect(pageID string) (PageRedirect, bool) {
+	if getConfig().RedirectsFile == "" {
+		return PageRedirect{}, false
+	}
+	return pageRedirects.get(pageID)
+}
+
+// pageRedirectPath is the target recorded for a page moved to pageID.
+func pageRedirectPath(pageID string) string {
+	return "/" + pageID + "/"
+}
+
+// checkRedirectTarget validates the target given when deleting pageID: a
+// path on this site or an absolute http(s) URL, other than the page itself.
+// Paths of pages that were moved or deleted are refused too, as they could
+// lead back to pageID.
+func checkRedirectTarget(pageID, target string) error {
+	if strings.HasPrefix(target, "/") {
+		if strings.HasPrefix(target, "//") || strings.ContainsAny(target, "\\\r\n") {
+			return errors.New("redirect must be a path on this site, such as /other-page/, or an absolute URL")
+		}
+		first, _, _ := strings.Cut(strings.TrimPrefix(target, "/"), "/")
+		if first == pageID {
+			return errors.New("redirect cannot point to the deleted page")
+		}
+		if _, ok := findPageRedirect(first); ok || isDeletedPage(first) {
+			return errors.New("redirect cannot point to a page that was moved or deleted")
+		}
+		return nil
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("redirect must be a path on this site, such as /other-page/, or an absolute URL")
+	}
+	return nil
+}
+
+// redirectPage answers a request for a moved or deleted page with a 301 to
+// the redirect's target. When that is another page, the rest of the path and
+// the query are kept, so the files of a moved page follow it.
+func redirectPage(c *gin.Context, redirect PageRedirect, rest string) {
+	location := redirect.To
+	if pageID, ok := strings.CutSuffix(strings.TrimPrefix(redirect.To, "/"), "/"); ok && isValidPageID(pageID) {
+		location = pageRedirectPath(pageID) + rest
+		if c.Request.URL.RawQuery != "" {
+			location += "?" + c.Request.URL.RawQuery
+		}
+	}
+	if strings.HasPrefix(location, "/") {
+		location = sitePath(location)
+	}
+	c.Redirect(http.StatusMovedPermanently, location)
+	c.Abort()
+}
+
+// handleListRedirects returns the redirects left by moved and deleted pages.
+func handleListRedirects(c *gin.Context) {
+	if getConfig().RedirectsFile == "" {
+		respondError(c, http.StatusNotFound, codeRedirectsDisabled, "Redirects are not enabled")
+		return
+	}
+	redirects := slices.SortedFunc(maps.Values(pageRedirects.all()), func(a, b PageRedirect) int {
+		return cmp.Compare(a.From, b.From)
+	})
+	respondJSON(c, http.StatusOK, redirects)
+}
+
+// handleDeleteRedirect removes the redirect of a page ID, which then answers
+// 404 or 410 again.
+func handleDeleteRedirect(c *gin.Context) {
+	path := getConfig().RedirectsFile
+	if path == "" {
+		respondError(c, http.StatusNotFound, codeRedirectsDisabled, "Redirects are not enabled")
+		return
+	}
+	pageID := c.Param("id")
+	removed, err := pageRedirects.remove(path, pageID)
+	if err != nil {
+		log.Printf("Error saving page redirects to %s: %v", path, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to delete redirect")
+		return
+	}
+	if !removed {
+		respondError(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("No redirect from %s", pageID))
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{"message": "Redirect deleted successfully"})
+}
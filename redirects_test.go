@@ -0,0 +1,133 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTestPageLogs points redirects and deleted pages at empty logs in a
+// temporary directory for the rest of the test.
+func useTestPageLogs(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	setTestConfig(t, Config{
+		RedirectsFile:    filepath.Join(dir, "redirects.json"),
+		DeletedPagesFile: filepath.Join(dir, "deleted.json"),
+	})
+	previousRedirects, previousDeleted := pageRedirects, deletedPages
+	pageRedirects, deletedPages = newPageLog[PageRedirect](), newPageLog[time.Time]()
+	t.Cleanup(func() { pageRedirects, deletedPages = previousRedirects, previousDeleted })
+}
+
+func TestMoveThenDeleteWithRedirectBack(t *testing.T) {
+	useTestPageLogs(t)
+
+	// a is moved to b, then b is deleted asking to redirect to /a/
+	recordPageRedirect("a", pageRedirectPath("b"))
+	if err := checkRedirectTarget("b", "/a/"); err == nil {
+		t.Fatal("checkRedirectTarget accepted a target that redirects back to the deleted page")
+	}
+	if redirect, ok := findPageRedirect("a"); !ok || redirect.To != "/b/" {
+		t.Fatalf("redirect from a = %+v, %v, want /b/", redirect, ok)
+	}
+}
+
+func TestRecordPageRedirect(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves [][2]string
+		want  map[string]string
+	}{
+		{
+			name:  "single move",
+			moves: [][2]string{{"a", "/b/"}},
+			want:  map[string]string{"a": "/b/"},
+		},
+		{
+			name:  "moving twice does not chain",
+			moves: [][2]string{{"a", "/b/"}, {"b", "/c/"}},
+			want:  map[string]string{"a": "/c/", "b": "/c/"},
+		},
+		{
+			name:  "redirect back to the origin drops the loop",
+			moves: [][2]string{{"a", "/b/"}, {"b", "/a/"}},
+			want:  map[string]string{"b": "/a/"},
+		},
+		{
+			name:  "external target",
+			moves: [][2]string{{"a", "/b/"}, {"b", "https://example.com/"}},
+			want:  map[string]string{"a": "https://example.com/", "b": "https://example.com/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestPageLogs(t)
+			for _, move := range tt.moves {
+				recordPageRedirect(move[0], move[1])
+			}
+			got := pageRedirects.all()
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d redirects %+v, want %v", len(got), got, tt.want)
+			}
+			for from, to := range tt.want {
+				if got[from].To != to {
+					t.Errorf("redirect from %s goes to %q, want %q", from, got[from].To, to)
+				}
+				if got[from].To == pageRedirectPath(from) {
+					t.Errorf("redirect from %s points to itself", from)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRedirectTarget(t *testing.T) {
+	useTestPageLogs(t)
+	recordPageRedirect("moved", "/elsewhere/")
+	recordDeletedPage("gone")
+
+	tests := []struct {
+		target string
+		ok     bool
+	}{
+		{"/other/", true},
+		{"/other/file.png", true},
+		{"https://example.com/x", true},
+		{"/page/", false},
+		{"/page/sub", false},
+		{"/moved/", false},
+		{"/gone/", false},
+		{"//example.com/", false},
+		{"/a\\b", false},
+		{"javascript:alert(1)", false},
+		{"ftp://example.com/", false},
+		{"https://", false},
+	}
+	for _, tt := range tests {
+		err := checkRedirectTarget("page", tt.target)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkRedirectTarget(%q) = %v, want ok %v", tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestPageLogPersists(t *testing.T) {
+	useTestPageLogs(t)
+	path := getConfig().RedirectsFile
+	recordPageRedirect("a", "/b/")
+
+	loaded := newPageLog[PageRedirect]()
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if redirect, ok := loaded.get("a"); !ok || redirect.To != "/b/" {
+		t.Fatalf("loaded redirect from a = %+v, %v, want /b/", redirect, ok)
+	}
+	if removed, err := loaded.remove(path, "a"); err != nil || !removed {
+		t.Fatalf("remove = %v, %v, want true", removed, err)
+	}
+	if removed, _ := loaded.remove(path, "a"); removed {
+		t.Fatal("removing a missing entry reported true")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentConfig holds the active configuration. A reload swaps in a new
+// *Config as a whole, so once a request has called getConfig it keeps a
+// consistent view of every setting. The stored Config must not be modified.
+var currentConfig atomic.Pointer[Config]
+
+func getConfig() *Config {
+	return currentConfig.Load()
+}
+
+// loadConfig reads the configuration and the files it references.
+func loadConfig() (*Config, error) {
+	cfg, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	customHead, err := readCustomHead(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid custom head: %w", err)
+	}
+	if cfg.customHead, err = parseSnippet("custom head", customHead, &cfg); err != nil {
+		return nil, fmt.Errorf("Invalid custom head: %w", err)
+	}
+	if cfg.pageFooter, err = parseSnippet("page footer", strings.TrimSpace(cfg.PageFooter), &cfg); err != nil {
+		return nil, fmt.Errorf("Invalid PNG_PAGE_FOOTER: %w", err)
+	}
+	if cfg.notFoundPage, cfg.serverErrorPage, err = readErrorPages(cfg); err != nil {
+		return nil, fmt.Errorf("Invalid error page: %w", err)
+	}
+	if cfg.rootPage, err = readRootPage(cfg); err != nil {
+		return nil, fmt.Errorf("Invalid PNG_ROOT_FILE: %w", err)
+	}
+	if cfg.robotsTxt, err = readRobotsTxt(cfg); err != nil {
+		return nil, fmt.Errorf("Invalid robots.txt: %w", err)
+	}
+	if cfg.OGImage {
+		if cfg.ogFont, err = readOGFont(cfg); err != nil {
+			return nil, fmt.Errorf("Invalid PNG_OG_FONT: %w", err)
+		}
+	}
+	return &cfg, nil
+}
+
+// reloadConfig re-reads the configuration and swaps it in only once it is
+// entirely valid. Settings consumed while starting up (port, TLS, cookie keys,
+// proxies, server timeouts and route access) keep their startup values until
+// the next restart.
+func reloadConfig() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := htmlTemplates.load(cfg.LoginTemplate); err != nil {
+		return fmt.Errorf("Unable to parse templates: %w", err)
+	}
+	// The prefix is baked into the handler at startup; keep URLs consistent with it
+	cfg.PathPrefix = getConfig().PathPrefix
+	currentConfig.Store(cfg)
+	return nil
+}
+
+func handleReloadConfig(c *gin.Context) {
+	if err := reloadConfig(); err != nil {
+		log.Printf("Configuration reload failed: %v", err)
+		respondError(c, http.StatusBadRequest, codeInvalidConfig, err.Error())
+		return
+	}
+	log.Printf("Configuration reloaded")
+	respondJSON(c, http.StatusOK, gin.H{"reloaded": true})
+}
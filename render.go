@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
+)
+
+// errRenderRejected marks markdown that is too expensive to render, either
+// because it takes too long or expands into too much HTML.
+var errRenderRejected = errors.New("content rejected")
+
+var errOutputTooLarge = errors.New("rendered output too large")
+
+// limitedBuffer is a bytes.Buffer that refuses to grow past limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		return 0, errOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// renderMarkdown converts markdown to HTML under the PNG_RENDER_TIMEOUT and
+// PNG_MAX_RENDERED_SIZE limits. Goldmark cannot be interrupted, so on timeout
+// the conversion goroutine is abandoned and its result discarded.
+func renderMarkdown(requestCtx context.Context, converter goldmark.Markdown, source []byte, parserContext parser.Context) (string, error) {
+	cfg := getConfig()
+	ctx := requestCtx
+	if cfg.RenderTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(requestCtx, cfg.RenderTimeout)
+		defer cancel()
+	}
+
+	type result struct {
+		html string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		buf := &limitedBuffer{limit: cfg.MaxRenderedSize}
+		err := converter.Convert(source, buf, parser.WithContext(parserContext))
+		done <- result{html: buf.String(), err: err}
+	}()
+
+	select {
+	case res := <-done:
+		if errors.Is(res.err, errOutputTooLarge) {
+			return "", fmt.Errorf("%w: rendered HTML exceeds %d bytes", errRenderRejected, cfg.MaxRenderedSize)
+		}
+		if res.err != nil {
+			return "", fmt.Errorf("failed to convert markdown: %w", res.err)
+		}
+		return res.html, nil
+	case <-ctx.Done():
+		// The request itself going away is reported as is, not as a render failure
+		if err := requestCtx.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: rendering took longer than %s", errRenderRejected, cfg.RenderTimeout)
+	}
+}
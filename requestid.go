@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDKey   = "requestID"
+	traceParentKey = "traceparent"
+)
+
+// traceParentContextKey carries the request's traceparent to the requests
+// the server makes on its behalf, such as URL fetches.
+type traceParentContextKey struct{}
+
+var (
+	headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	requestIDPattern  = regexp.MustCompile(`^[A-Za-z0-9._:+/=-]{1,128}$`)
+	// traceParentPattern matches a version 00 W3C traceparent, capturing the
+	// trace ID, parent ID and flags.
+	traceParentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+)
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read never fails
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestTracing gives every request an ID, taken from the PNG_REQUEST_ID_HEADER
+// of a trusted proxy or generated, which is echoed in the response, written
+// to the access log and returned with API errors. With PNG_TRACEPARENT it
+// also continues the W3C trace a trusted proxy started, or starts one, with a
+// span of its own. Headers from other clients are ignored, so they cannot
+// pass off their requests as someone else's.
+func requestTracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := getConfig()
+		trusted := fromTrustedProxy(c)
+		if header := cfg.RequestIDHeader; header != "" {
+			id := c.GetHeader(header)
+			if !trusted || !requestIDPattern.MatchString(id) {
+				id = randomHex(16)
+			}
+			c.Set(requestIDKey, id)
+			c.Header(header, id)
+		}
+		if cfg.TraceParent {
+			traceID, flags := "", "00"
+			match := traceParentPattern.FindStringSubmatch(c.GetHeader("traceparent"))
+			if trusted && match != nil && strings.Trim(match[1], "0") != "" && strings.Trim(match[2], "0") != "" {
+				traceID, flags = match[1], match[3]
+			}
+			if traceID == "" {
+				traceID = randomHex(16)
+			}
+			traceParent := "00-" + traceID + "-" + randomHex(8) + "-" + flags
+			c.Set(traceParentKey, traceParent)
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), traceParentContextKey{}, traceParent))
+			// The Trace Context Level 2 response header
+			c.Header("traceresponse", traceParent)
+		}
+		c.Next()
+	}
+}
+
+// requestIDOf returns the ID given to the request, "" when
+// PNG_REQUEST_ID_HEADER is empty.
+func requestIDOf(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// logFormatter is gin's default access log line with the request ID and,
+// with PNG_TRACEPARENT, the traceparent appended.
+func logFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor, methodColor, resetColor = param.StatusCodeColor(), param.MethodColor(), param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	var ids string
+	for _, key := range []string{requestIDKey, traceParentKey} {
+		if value, ok := param.Keys[key].(string); ok {
+			ids += " | " + value
+		}
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v%s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		param.Path,
+		ids,
+		param.ErrorMessage,
+	)
+}
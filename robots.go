@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const textContentType = "text/plain; charset=utf-8"
+
+// readRobotsTxt loads the operator's robots.txt from PNG_ROBOTS_TXT or
+// PNG_ROBOTS_TXT_FILE, or returns nil to have one generated.
+func readRobotsTxt(cfg Config) ([]byte, error) {
+	if cfg.RobotsTxtFile != "" {
+		content, err := os.ReadFile(cfg.RobotsTxtFile)
+		if err != nil {
+			return nil, fmt.Errorf("PNG_ROBOTS_TXT_FILE: %w", err)
+		}
+		return content, nil
+	}
+	if strings.TrimSpace(cfg.RobotsTxt) == "" {
+		return nil, nil
+	}
+	return []byte(strings.TrimSpace(cfg.RobotsTxt) + "\n"), nil
+}
+
+// handleRobotsTxt serves /robots.txt. Unless the operator provided their own,
+// it allows everything and points to PNG_SITEMAP_URL when set. Unlisted and
+// draft pages are never listed, as that would reveal them to anyone: they are
+// sent with X-Robots-Tag instead (see pageSecurityHeaders).
+func handleRobotsTxt(c *gin.Context) {
+	cfg := getConfig()
+	if cfg.robotsTxt != nil {
+		c.Data(http.StatusOK, textContentType, cfg.robotsTxt)
+		return
+	}
+
+	var b strings.Builder
+	// An empty Disallow allows everything
+	b.WriteString("User-agent: *\nDisallow:\n")
+	if cfg.SitemapURL != "" {
+		b.WriteString("\nSitemap: " + cfg.SitemapURL + "\n")
+	}
+	c.Data(http.StatusOK, textContentType, []byte(b.String()))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRobotsTxtHidesNothing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	newTestPage(t, "open", PageMeta{Type: "markdown"})
+	newTestPage(t, "secret", PageMeta{Type: "markdown", Unlisted: true})
+	newTestPage(t, "wip", PageMeta{Type: "markdown", Draft: true})
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "default", want: "User-agent: *\nDisallow:\n"},
+		{name: "with sitemap", cfg: Config{SitemapURL: "https://press.example.com/sitemap.xml"},
+			want: "User-agent: *\nDisallow:\n\nSitemap: https://press.example.com/sitemap.xml\n"},
+		{name: "configured", cfg: Config{robotsTxt: []byte("User-agent: *\nDisallow: /\n")}, want: "User-agent: *\nDisallow: /\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, tt.cfg)
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+			handleRobotsTxt(c)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("robots.txt = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(rec.Body.String(), "secret") || strings.Contains(rec.Body.String(), "wip") {
+				t.Error("robots.txt reveals unlisted or draft pages")
+			}
+		})
+	}
+}
+
+func TestNonPublicPagesAreNoindex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	setTestConfig(t, Config{})
+	newTestPage(t, "open", PageMeta{Type: "markdown"})
+	newTestPage(t, "secret", PageMeta{Type: "markdown", Unlisted: true})
+	newTestPage(t, "wip", PageMeta{Type: "markdown", Draft: true})
+
+	router := gin.New()
+	router.Use(pageSecurityHeaders())
+	router.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/open/", want: ""},
+		{path: "/secret/", want: "noindex"},
+		{path: "/secret/assets/photo.png", want: "noindex"},
+		{path: "/wip/", want: "noindex"},
+		{path: "/missing/", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got := rec.Header().Get("X-Robots-Tag"); got != tt.want {
+				t.Errorf("X-Robots-Tag = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PNG_ROOT_MODE values, selecting what anonymous visitors get at "/".
+const (
+	rootModeDashboard  = "dashboard"
+	rootModePageList   = "pagelist"
+	rootModeCustomFile = "custom-file"
+)
+
+// readRootPage reads PNG_ROOT_FILE for the custom-file root mode.
+func readRootPage(cfg Config) ([]byte, error) {
+	if cfg.RootMode != rootModeCustomFile {
+		return nil, nil
+	}
+	return os.ReadFile(cfg.RootFile)
+}
+
+// publicRoot answers "/" for anonymous visitors with the page list or the
+// custom landing page, unless PNG_ROOT_MODE is dashboard. Logged-in users,
+// and everyone when authentication is disabled, fall through to the panel.
+func publicRoot() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := getConfig()
+		if cfg.RootMode == rootModeDashboard || isLoggedIn(c) {
+			c.Next()
+			return
+		}
+		if cfg.RootMode == rootModeCustomFile {
+			c.Data(http.StatusOK, htmlContentType, cfg.rootPage)
+			c.Abort()
+			return
+		}
+
+		pages, err := listPages()
+		if err != nil {
+			log.Printf("Error reading public directory: %v", err)
+			renderServerError(c)
+			c.Abort()
+			return
+		}
+		visible := pages[:0]
+		for _, page := range pages {
+			if page.Visibility == visibilityPublic {
+				visible = append(visible, page)
+			}
+		}
+		sort.Slice(visible, func(i, j int) bool {
+			return visible[i].CreatedAt.After(visible[j].CreatedAt)
+		})
+		c.HTML(http.StatusOK, "pagelist.html", gin.H{"Pages": visible})
+		c.Abort()
+	}
+}
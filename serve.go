@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PNG_TRAILING_SLASH policies for page folders requested without the slash.
+const (
+	trailingSlashRedirect = "redirect"
+	trailingSlashServe    = "serve"
+	trailingSlashStrict   = "strict"
+)
+
+// servePages serves files from the public directory, mapping page folders to
+// their index.html. A page folder without one answers 503 unless
+// PNG_AUTO_REPAIR can re-render it. http.ServeContent takes care of Last-Modified,
+// If-Modified-Since, Range and header-only HEAD responses. Requests that do
+// not match a file fall through to the other routes, except for the URLs of
+// deleted pages, which answer 410 Gone.
+func servePages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		urlPath := c.Request.URL.Path
+		if urlPath == "/" {
+			c.Next()
+			return
+		}
+
+		// Cleaning the rooted path removes any ".." before it touches the disk
+		cleanPath := path.Clean("/" + urlPath)
+		if !isPublicPagePath(cleanPath) {
+			c.Next()
+			return
+		}
+		filePath := filepath.Join("public", filepath.FromSlash(cleanPath))
+		pageID, rest, _ := strings.Cut(strings.TrimPrefix(cleanPath, "/"), "/")
+		info, err := os.Stat(filePath)
+		// Directories that are not pages, such as PNG_IGNORED_DIRS, are not
+		// served
+		if (rest != "" || (err == nil && info.IsDir())) && !isValidPageID(pageID) {
+			c.Next()
+			return
+		}
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && isValidPageID(pageID) {
+				if _, err := os.Stat(filepath.Join("public", pageID)); errors.Is(err, os.ErrNotExist) {
+					if redirect, ok := findPageRedirect(pageID); ok {
+						redirectPage(c, redirect, rest)
+						return
+					}
+					if isDeletedPage(pageID) {
+						renderGone(c)
+						return
+					}
+				}
+			}
+			c.Next()
+			return
+		}
+		if info.IsDir() {
+			if !strings.HasSuffix(urlPath, "/") {
+				switch getConfig().TrailingSlash {
+				case trailingSlashRedirect:
+					target := sitePath(urlPath + "/")
+					if c.Request.URL.RawQuery != "" {
+						target += "?" + c.Request.URL.RawQuery
+					}
+					c.Redirect(http.StatusMovedPermanently, target)
+					c.Abort()
+					return
+				case trailingSlashStrict:
+					c.Next()
+					return
+				}
+			}
+			filePath = filepath.Join(filePath, "index.html")
+			info, err = os.Stat(filePath)
+			if errors.Is(err, os.ErrNotExist) {
+				if !autoRepairPage(c.Request.Context(), pageID) {
+					respondUnrendered(c, pageID)
+					return
+				}
+				info, err = os.Stat(filePath)
+			}
+			if err != nil || info.IsDir() {
+				c.Next()
+				return
+			}
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			c.Next()
+			return
+		}
+		defer file.Close()
+		if strings.HasPrefix(rest, assetsDirName+"/") {
+			setAssetHeaders(c, info.Name())
+		}
+		http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+		c.Abort()
+	}
+}
+
+// isPublicPagePath reports whether a cleaned URL path may be served from the
+// public directory: a page folder, its index.html, the HTML of its additional
+// files and og.png, or a file in its assets folder. Everything else, such as
+// source.txt, meta.json, the files folder and dotfiles, stays private; the
+// source is available through /api/pages/:id/source.
+func isPublicPagePath(cleanPath string) bool {
+	parts := strings.Split(strings.TrimPrefix(cleanPath, "/"), "/")
+	for _, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return true
+	case 2:
+		return strings.HasSuffix(parts[1], ".html") || parts[1] == ogImageFileName
+	case 3:
+		return parts[1] == assetsDirName
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	cookieHashKeyLength  = 64
+	cookieBlockKeyLength = 32
+)
+
+// cookieNamePattern matches the RFC 6265 token characters allowed in a
+// cookie name.
+var cookieNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// setupCookieCodecs builds the secure cookie codecs from the configured keys,
+// falling back to random keys (which do not survive a restart) when unset.
+//
+// PNG_COOKIE_KEYS holds an ordered list of "hashKey:blockKey" pairs: the first
+// pair encodes new sessions and every pair is tried when decoding, so a new key
+// can be introduced while sessions issued with the previous one stay valid.
+func setupCookieCodecs() error {
+	cfg := getConfig()
+	single := cfg.CookieHashKey != "" || cfg.CookieBlockKey != ""
+	if len(cfg.CookieKeys) > 0 && single {
+		return errors.New("set either PNG_COOKIE_KEYS or PNG_COOKIE_HASH_KEY/PNG_COOKIE_BLOCK_KEY, not both")
+	}
+
+	if len(cfg.CookieKeys) > 0 {
+		var keyPairs [][]byte
+		for i, pair := range cfg.CookieKeys {
+			hashValue, blockValue, found := strings.Cut(strings.TrimSpace(pair), ":")
+			if !found {
+				return fmt.Errorf("PNG_COOKIE_KEYS entry %d: expected hashKey:blockKey", i+1)
+			}
+			hashKey, blockKey, err := decodeKeyPair(hashValue, blockValue)
+			if err != nil {
+				return fmt.Errorf("PNG_COOKIE_KEYS entry %d: %w", i+1, err)
+			}
+			keyPairs = append(keyPairs, hashKey, blockKey)
+		}
+		cookieCodecs = newCookieCodecs(keyPairs...)
+		return nil
+	}
+
+	if !single {
+		log.Printf("WARNING: PNG_COOKIE_HASH_KEY and PNG_COOKIE_BLOCK_KEY are not set; using random keys, sessions will not survive a restart")
+		cookieCodecs = newCookieCodecs(
+			securecookie.GenerateRandomKey(cookieHashKeyLength),
+			securecookie.GenerateRandomKey(cookieBlockKeyLength),
+		)
+		return nil
+	}
+	if cfg.CookieHashKey == "" || cfg.CookieBlockKey == "" {
+		return errors.New("PNG_COOKIE_HASH_KEY and PNG_COOKIE_BLOCK_KEY must be set together")
+	}
+	hashKey, blockKey, err := decodeKeyPair(cfg.CookieHashKey, cfg.CookieBlockKey)
+	if err != nil {
+		return err
+	}
+	cookieCodecs = newCookieCodecs(hashKey, blockKey)
+	return nil
+}
+
+// newCookieCodecs builds codecs without securecookie's own 30 day age limit:
+// each session carries its expiry, which depends on "remember me".
+func newCookieCodecs(keyPairs ...[]byte) []securecookie.Codec {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(0)
+		}
+	}
+	return codecs
+}
+
+// decodeKeyPair decodes and validates a hash/block key pair.
+func decodeKeyPair(hashValue, blockValue string) ([]byte, []byte, error) {
+	hashKey, err := decodeKey(hashValue, cookieHashKeyLength)
+	if err != nil {
+		return nil, nil, fmt.Errorf("hash key: %w", err)
+	}
+	blockKey, err := decodeKey(blockValue, cookieBlockKeyLength)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block key: %w", err)
+	}
+	return hashKey, blockKey, nil
+}
+
+// decodeKey accepts a hex or base64 encoded key and checks its decoded length.
+func decodeKey(value string, length int) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	var key []byte
+	if decoded, err := hex.DecodeString(value); err == nil {
+		key = decoded
+	} else if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+		key = decoded
+	} else if decoded, err := base64.URLEncoding.DecodeString(value); err == nil {
+		key = decoded
+	} else {
+		return nil, errors.New("key must be hex or base64 encoded")
+	}
+	if len(key) != length {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", length, len(key))
+	}
+	return key, nil
+}
+
+// parseSameSite maps the PNG_COOKIE_SAMESITE setting to its http.SameSite mode.
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite mode %q (expected lax, strict or none)", value)
+	}
+}
+
+// isSecureRequest reports whether the request reached us over HTTPS, either
+// directly or through one of PNG_TRUSTED_PROXIES setting X-Forwarded-Proto.
+func isSecureRequest(c *gin.Context) bool {
+	return requestScheme(c) == "https"
+}
+
+// cookieSecure decides the Secure flag for the session cookie.
+func cookieSecure(c *gin.Context) bool {
+	return getConfig().CookieSecure || acmeEnabled() || isSecureRequest(c)
+}
+
+// setSessionCookie writes the session cookie with the configured attributes.
+// A negative maxAge deletes it.
+func setSessionCookie(c *gin.Context, value string, maxAge int) {
+	cfg := getConfig()
+	sameSite, _ := parseSameSite(cfg.CookieSameSite)
+	secure := cookieSecure(c)
+	// Browsers reject SameSite=None cookies that are not also Secure.
+	if sameSite == http.SameSiteNoneMode {
+		secure = true
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(cfg.CookieName, value, maxAge, sitePath("/"), cfg.CookieDomain, secure, true)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCookieSecure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name         string
+		cookieSecure bool
+		remoteAddr   string
+		tls          bool
+		proto        string
+		want         bool
+	}{
+		{name: "plain HTTP", remoteAddr: "203.0.113.7:5000", want: false},
+		{name: "direct HTTPS", remoteAddr: "203.0.113.7:5000", tls: true, want: true},
+		{name: "trusted proxy forwarding https", remoteAddr: "127.0.0.1:5000", proto: "https", want: true},
+		{name: "trusted proxy forwarding http", remoteAddr: "127.0.0.1:5000", proto: "http", want: false},
+		{name: "trusted proxy listing several", remoteAddr: "127.0.0.1:5000", proto: "https, http", want: true},
+		{name: "client spoofing the header", remoteAddr: "203.0.113.7:5000", proto: "https", want: false},
+		{name: "forced secure", cookieSecure: true, remoteAddr: "203.0.113.7:5000", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, Config{CookieSecure: tt.cookieSecure, TrustedProxies: []string{"127.0.0.1"}})
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/login", nil)
+			c.Request.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				c.Request.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				c.Request.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := cookieSecure(c); got != tt.want {
+				t.Errorf("cookieSecure = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
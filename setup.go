@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// setupMu makes sure only one visitor completes the setup.
+var setupMu sync.Mutex
+
+var (
+	// defaultSetupFile keeps the credentials out of the served directory.
+	defaultSetupFile = filepath.Join("data", "setup.json")
+	// legacySetupFile is where setups used to be saved, inside public.
+	legacySetupFile = filepath.Join("public", ".setup.json")
+)
+
+// setupPending reports whether the instance is waiting for its first-run
+// setup: PNG_ALLOW_SETUP is on and no credentials are configured yet. The
+// panel and API stay closed until then instead of running without auth.
+func setupPending() bool {
+	return getConfig().AllowSetup && authDisabled()
+}
+
+// checkSetupFile rejects a PNG_SETUP_FILE inside the public directory, where
+// a misconfigured file server or proxy could serve the credentials. Symbolic
+// links are followed as far as the path exists.
+func checkSetupFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	publicDir, err := resolvePath("public")
+	if err != nil {
+		return err
+	}
+	setupPath, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(publicDir, setupPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.New("the credentials cannot be kept inside the public directory")
+	}
+	return nil
+}
+
+// resolvePath makes path absolute, resolving the symbolic links of its
+// longest existing parent.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		parent := filepath.Dir(path)
+		if !errors.Is(err, os.ErrNotExist) || parent == path {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// mergeSetupFile adds the credentials saved by a completed setup to the
+// configuration being read. Environment variables still take precedence. A
+// setup saved to legacySetupFile is moved to the default location first.
+func mergeSetupFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	if path == defaultSetupFile {
+		if err := moveLegacySetupFile(path); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	viper.SetConfigFile(path)
+	return viper.MergeInConfig()
+}
+
+// moveLegacySetupFile moves the credentials of a setup completed before they
+// were kept out of public, so upgrading does not reopen /setup. It copies
+// rather than renames, as public is often a separate volume.
+func moveLegacySetupFile(path string) error {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	data, err := os.ReadFile(legacySetupFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return err
+	}
+	log.Printf("Moved the setup credentials from %s to %s", legacySetupFile, path)
+	return os.Remove(legacySetupFile)
+}
+
+// writeSetupFile saves the credentials chosen during setup. The file only
+// holds them, so it is kept private to the server's user.
+func writeSetupFile(path, username, password string) error {
+	data, err := json.MarshalIndent(map[string]string{
+		"PNG_USERNAME": username,
+		"PNG_PASSWORD": password,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// redirectToSetup answers a request for the dashboard or the API while the
+// setup is pending.
+func redirectToSetup(c *gin.Context) {
+	if wantsJSON(c) {
+		abortWithError(c, http.StatusServiceUnavailable, codeSetupRequired, "The server has not been set up yet: choose credentials at /setup")
+		return
+	}
+	c.Redirect(http.StatusFound, sitePath("/setup"))
+	c.Abort()
+}
+
+func showSetupPage(c *gin.Context) {
+	if !setupPending() {
+		renderNotFound(c)
+		return
+	}
+	c.HTML(http.StatusOK, "setup.html", gin.H{})
+}
+
+// handleSetup saves the first credentials, reloads the configuration so they
+// apply at once and logs the operator in. Afterwards /setup is gone.
+func handleSetup(c *gin.Context) {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	if !setupPending() {
+		renderNotFound(c)
+		return
+	}
+
+	username := strings.TrimSpace(c.PostForm("username"))
+	password := c.PostForm("password")
+	candidate := *getConfig()
+	candidate.Username, candidate.Password = username, password
+	var message string
+	switch {
+	case username == "" || password == "":
+		message = "Username and password are required"
+	case password != c.PostForm("confirm"):
+		message = "The passwords do not match"
+	case strings.ContainsFunc(username+password, isControlRune):
+		message = "Username and password cannot contain control characters"
+	default:
+		if reason := passwordWeakness(candidate); reason != "" {
+			message = "This password is too weak: " + reason
+		}
+	}
+	if message != "" {
+		c.HTML(http.StatusBadRequest, "setup.html", gin.H{"Error": message, "Username": username})
+		return
+	}
+
+	cfg := getConfig()
+	if err := writeSetupFile(cfg.SetupFile, username, password); err != nil {
+		log.Printf("Error writing setup file %s: %v", cfg.SetupFile, err)
+		c.HTML(http.StatusInternalServerError, "setup.html", gin.H{"Error": "Failed to save the credentials", "Username": username})
+		return
+	}
+	if err := reloadConfig(); err != nil {
+		log.Printf("Error applying the setup: %v", err)
+		c.HTML(http.StatusInternalServerError, "setup.html", gin.H{"Error": "The credentials were saved but could not be applied: restart the server", "Username": username})
+		return
+	}
+	log.Printf("Setup completed: credentials saved to %s", cfg.SetupFile)
+	if err := createSession(c, false); err != nil {
+		c.Redirect(http.StatusFound, sitePath("/login"))
+		return
+	}
+	c.Redirect(http.StatusFound, sitePath("/"))
+}
+
+func isControlRune(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
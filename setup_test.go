@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSetupFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("public", 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if err := os.Symlink("public", "linked"); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: defaultSetupFile},
+		{path: ""},
+		{path: "publicity/setup.json"},
+		{path: filepath.Join(outside, "setup.json")},
+		{path: legacySetupFile, wantErr: true},
+		{path: "public/nested/dir/setup.json", wantErr: true},
+		{path: "./data/../public/setup.json", wantErr: true},
+		{path: filepath.Join(wd, "public", "setup.json"), wantErr: true},
+		{path: "linked/setup.json", wantErr: true},
+		{path: "public", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := checkSetupFile(tt.path); (err != nil) != tt.wantErr {
+				t.Errorf("checkSetupFile(%q) = %v, want error %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStartRefusesSetupFileInPublic(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("PNG_SETUP_FILE", legacySetupFile)
+	if _, err := readConfig(); err == nil || !strings.Contains(err.Error(), "PNG_SETUP_FILE") {
+		t.Fatalf("readConfig error = %v, want PNG_SETUP_FILE rejected", err)
+	}
+}
+
+func TestLegacySetupFileIsMoved(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("public", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSetupFile(legacySetupFile, "admin", "Xy9!long-passw0rd"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PNG_SETUP_FILE", defaultSetupFile)
+	cfg, err := readConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Username != "admin" || cfg.Password != "Xy9!long-passw0rd" {
+		t.Errorf("credentials = %q, %q, want the saved setup", cfg.Username, cfg.Password)
+	}
+	if _, err := os.Stat(legacySetupFile); !os.IsNotExist(err) {
+		t.Errorf("%s still exists: %v", legacySetupFile, err)
+	}
+	info, err := os.Stat(defaultSetupFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("%s mode = %v, want 0600", defaultSetupFile, info.Mode().Perm())
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout is how long in-flight requests get to finish once the
+// server is asked to stop. Connections still open past it, such as event
+// streams, are closed.
+const shutdownTimeout = 10 * time.Second
+
+// serveUntilDone runs the listen function of each server until one of them
+// fails or ctx is cancelled, then shuts them all down gracefully. It returns
+// the error that stopped the servers, or nil when ctx did.
+func serveUntilDone(ctx context.Context, servers map[*http.Server]func() error) error {
+	errCh := make(chan error, len(servers))
+	for _, listen := range servers {
+		go func() {
+			errCh <- listen()
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %s for requests to finish", shutdownTimeout)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for server := range servers {
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Printf("Error shutting down the server on %s: %v", server.Addr, shutdownErr)
+			server.Close()
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logSlowRequests logs a warning for requests taking longer than
+// PNG_SLOW_REQUEST_MS, with the route, method, status and duration. The
+// request ID is included for correlation.
+// The event stream is skipped as it stays open on purpose.
+func logSlowRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		threshold := time.Duration(getConfig().SlowRequestMS) * time.Millisecond
+		if threshold <= 0 {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+		if elapsed < threshold || c.FullPath() == eventsPath {
+			return
+		}
+		// Pages served by middleware have no route of their own
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		requestID := requestIDOf(c)
+		if requestID == "" {
+			requestID = "-"
+		}
+		log.Printf("WARNING: slow request: %s %s answered %d in %s (request ID %s)", c.Request.Method, route, c.Writer.Status(), elapsed.Round(time.Millisecond), requestID)
+	}
+}
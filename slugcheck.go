@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const slugCheckWindow = time.Minute
+
+// SlugAvailability is the answer of GET /api/slugs/available. Slug is the
+// normalized form an upload would use.
+type SlugAvailability struct {
+	Slug      string `json:"slug"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// windowLimiter counts requests per key over fixed windows. All counts are
+// dropped when a window ends, so memory stays bounded by the clients seen in
+// one window.
+type windowLimiter struct {
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+// allow counts a request for key and reports whether it is within limit,
+// along with the time left before the window resets.
+func (l *windowLimiter) allow(key string, limit int, window time.Duration) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.counts == nil || now.Sub(l.start) >= window {
+		l.start = now
+		l.counts = map[string]int{}
+	}
+	l.counts[key]++
+	return l.counts[key] <= limit, l.start.Add(window).Sub(now)
+}
+
+// slugChecks limits anonymous availability checks, which PNG_PUBLIC_READ
+// would otherwise let anyone use to enumerate existing pages.
+var slugChecks windowLimiter
+
+// handleSlugAvailable tells whether an upload could use a slug, applying the
+// same rules and existence check as POST /api/upload. Anonymous clients are
+// held to PNG_SLUG_CHECK_LIMIT checks a minute.
+func handleSlugAvailable(c *gin.Context) {
+	if limit := getConfig().SlugCheckLimit; limit > 0 && !isLoggedIn(c) {
+		if ok, retry := slugChecks.allow(c.ClientIP(), limit, slugCheckWindow); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			respondError(c, http.StatusTooManyRequests, codeRateLimited, "Too many slug checks, try again later")
+			return
+		}
+	}
+
+	slug, err := normalizeSlug(c.Query("slug"))
+	if err != nil {
+		reason := strings.TrimPrefix(err.Error(), "invalid slug: ")
+		respondJSON(c, http.StatusOK, SlugAvailability{Slug: c.Query("slug"), Reason: reason})
+		return
+	}
+	_, err = os.Stat(filepath.Join("public", slug))
+	switch {
+	case err == nil:
+		respondJSON(c, http.StatusOK, SlugAvailability{Slug: slug, Reason: "a page with this slug already exists"})
+	case errors.Is(err, os.ErrNotExist):
+		respondJSON(c, http.StatusOK, SlugAvailability{Slug: slug, Available: true})
+	default:
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not check the slug")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// maxFolderNameLength keeps PNG_MAX_SLUG_LENGTH within what every common
+// filesystem accepts for a single name.
+const maxFolderNameLength = 255
+
+// reservedSlugs are top-level paths used by the server itself, which a page
+// would otherwise shadow or be shadowed by.
+var reservedSlugs = map[string]bool{
+	"api":    true,
+	"assets": true,
+	"login":  true,
+	"logout": true,
+	"p":      true,
+	"setup":  true,
+}
+
+// windowsReservedNames are device names Windows refuses as file names, with
+// or without an extension, so a page folder using one could not be copied
+// there.
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// isWindowsReservedName reports whether name is a Windows device name,
+// whatever its case and extension.
+func isWindowsReservedName(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	return windowsReservedNames[strings.ToLower(strings.TrimRight(base, " "))]
+}
+
+// normalizeSlug checks a client-chosen page ID so that its folder behaves
+// the same on every platform, and returns it in Unicode NFC form. Each rule
+// has its own message, so clients know what to change.
+func normalizeSlug(slug string) (string, error) {
+	slug = norm.NFC.String(slug)
+	maxLength := getConfig().MaxSlugLength
+	switch {
+	case slug == "":
+		return "", errors.New("invalid slug: it is empty")
+	case strings.HasSuffix(slug, ".") || strings.HasSuffix(slug, " "):
+		return "", errors.New("invalid slug: it cannot end with a dot or a space")
+	case len(slug) > maxLength:
+		return "", fmt.Errorf("invalid slug: it is longer than %d characters", maxLength)
+	case !slugPattern.MatchString(slug):
+		return "", errors.New("invalid slug: use lowercase letters, digits, '-' and '_', starting with a letter or digit")
+	case reservedSlugs[slug] || slices.Contains(getConfig().IgnoredDirs, slug):
+		return "", errors.New("invalid slug: " + slug + " is reserved")
+	case isWindowsReservedName(slug):
+		return "", errors.New("invalid slug: " + slug + " is a reserved device name on Windows")
+	}
+	return slug, nil
+}
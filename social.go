@@ -0,0 +1,42 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	stdhtml "html"
+	"strings"
+)
+
+// Link preview defaults: pages are documents, and get the large card when
+// they have a preview image to show in it.
+const (
+	defaultOGType         = "article"
+	twitterCardSummary    = "summary"
+	twitterCardLargeImage = "summary_large_image"
+)
+
+// socialTags are the link preview tags of a markdown or text page besides its
+// title, description and image: og:type, og:url, og:site_name from
+// PNG_SITE_TITLE, twitter:card and author. Tags without a value are left out.
+func socialTags(req UploadRequest, meta *PageMeta, canonicalURL string, hasImage bool) string {
+	twitterCard := twitterCardSummary
+	if hasImage {
+		twitterCard = twitterCardLargeImage
+	}
+	tags := []string{fmt.Sprintf(`<meta property="og:type" content="%s">`, cmp.Or(req.OGType, defaultOGType))}
+	if canonicalURL != "" {
+		tags = append(tags, fmt.Sprintf(`<meta property="og:url" content="%s">`, stdhtml.EscapeString(canonicalURL)))
+	}
+	if siteTitle := getConfig().SiteTitle; siteTitle != "" {
+		tags = append(tags, fmt.Sprintf(`<meta property="og:site_name" content="%s">`, stdhtml.EscapeString(siteTitle)))
+	}
+	tags = append(tags, fmt.Sprintf(`<meta name="twitter:card" content="%s">`, cmp.Or(req.TwitterCard, twitterCard)))
+	if meta.Author != "" {
+		author := stdhtml.EscapeString(meta.Author)
+		tags = append(tags, fmt.Sprintf(`<meta name="author" content="%s">`, author))
+		if cmp.Or(req.OGType, defaultOGType) == defaultOGType {
+			tags = append(tags, fmt.Sprintf(`<meta property="article:author" content="%s">`, author))
+		}
+	}
+	return strings.Join(tags, "\n    ")
+}
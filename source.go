@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	sourceFileName           = "source.txt"
+	compressedSourceFileName = "source.txt.gz"
+)
+
+// readPageSource returns the source a page was published from and when it was
+// written. It is read from source.txt.gz when the page was stored with
+// PNG_COMPRESS_SOURCES, and from source.txt otherwise, so pages stored either
+// way can coexist while the setting changes. A missing source returns an
+// error satisfying os.IsNotExist.
+func readPageSource(pageID string) ([]byte, time.Time, error) {
+	return readSourceIn(filepath.Join("public", pageID))
+}
+
+// readSourceIn reads the source kept in folderPath, a page folder or one of
+// its versions, in either form.
+func readSourceIn(folderPath string) ([]byte, time.Time, error) {
+	file, err := os.Open(filepath.Join(folderPath, compressedSourceFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		path := filepath.Join(folderPath, sourceFileName)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		data, err := os.ReadFile(path)
+		return data, info.ModTime(), err
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("corrupt compressed source: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("corrupt compressed source: %w", err)
+	}
+	return data, info.ModTime(), nil
+}
+
+// hasPageSource reports whether a page folder still holds its source, in
+// either form.
+func hasPageSource(folderPath string) bool {
+	for _, name := range []string{compressedSourceFileName, sourceFileName} {
+		if _, err := os.Stat(filepath.Join(folderPath, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writePageSource stores a page's source, gzipped when PNG_COMPRESS_SOURCES is
+// on, and removes the copy in the other form left by an earlier write.
+func writePageSource(folderPath string, content []byte) error {
+	name, stale := sourceFileName, compressedSourceFileName
+	if getConfig().CompressSources {
+		name, stale = compressedSourceFileName, sourceFileName
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(content); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		content = buf.Bytes()
+	}
+	if err := os.WriteFile(filepath.Join(folderPath, name), content, 0644); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(folderPath, stale)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
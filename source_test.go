@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageSourceRoundTrip(t *testing.T) {
+	large := strings.Repeat("# Title\n\nSome *markdown* with ünïcödé.\n", 2000)
+	tests := []struct {
+		name     string
+		compress bool
+		content  string
+		wantFile string
+		goneFile string
+	}{
+		{name: "plain", content: "# hi\n", wantFile: sourceFileName, goneFile: compressedSourceFileName},
+		{name: "compressed", compress: true, content: "# hi\n", wantFile: compressedSourceFileName, goneFile: sourceFileName},
+		{name: "compressed large", compress: true, content: large, wantFile: compressedSourceFileName, goneFile: sourceFileName},
+		{name: "compressed empty", compress: true, content: "", wantFile: compressedSourceFileName, goneFile: sourceFileName},
+		{name: "compressed binary", compress: true, content: "\x00\x1f\x8b\xff", wantFile: compressedSourceFileName, goneFile: sourceFileName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, Config{CompressSources: tt.compress})
+			dir := t.TempDir()
+			if err := writePageSource(dir, []byte(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := readSourceIn(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("read back %d bytes, want the %d written", len(got), len(tt.content))
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.wantFile)); err != nil {
+				t.Errorf("%s was not written: %v", tt.wantFile, err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.goneFile)); !os.IsNotExist(err) {
+				t.Errorf("%s exists, want only %s", tt.goneFile, tt.wantFile)
+			}
+			if !hasPageSource(dir) {
+				t.Error("hasPageSource = false")
+			}
+		})
+	}
+}
+
+func TestCompressedSourceIsGzip(t *testing.T) {
+	setTestConfig(t, Config{CompressSources: true})
+	dir := t.TempDir()
+	content := strings.Repeat("compressible ", 1000)
+	if err := writePageSource(dir, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, compressedSourceFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(content) {
+		t.Errorf("stored %d bytes for %d of source", len(data), len(content))
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil || string(plain) != content {
+		t.Fatalf("gunzip = %d bytes, %v, want the source", len(plain), err)
+	}
+}
+
+func TestSourceMigration(t *testing.T) {
+	tests := []struct {
+		name   string
+		first  bool
+		second bool
+	}{
+		{name: "plain to compressed", first: false, second: true},
+		{name: "compressed to plain", first: true, second: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setTestConfig(t, Config{CompressSources: tt.first})
+			if err := writePageSource(dir, []byte("old")); err != nil {
+				t.Fatal(err)
+			}
+			// A page written before the setting changed is still readable
+			setTestConfig(t, Config{CompressSources: tt.second})
+			if got, _, err := readSourceIn(dir); err != nil || string(got) != "old" {
+				t.Fatalf("read before rewrite = %q, %v, want old", got, err)
+			}
+			if err := writePageSource(dir, []byte("new")); err != nil {
+				t.Fatal(err)
+			}
+			if got, _, err := readSourceIn(dir); err != nil || string(got) != "new" {
+				t.Fatalf("read after rewrite = %q, %v, want new", got, err)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Errorf("got %d source files, want the stale one removed", len(entries))
+			}
+		})
+	}
+}
+
+func TestReadSourceErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := readSourceIn(dir); !os.IsNotExist(err) {
+		t.Errorf("missing source error = %v, want not exist", err)
+	}
+	if hasPageSource(dir) {
+		t.Error("hasPageSource = true for an empty folder")
+	}
+	if err := os.WriteFile(filepath.Join(dir, compressedSourceFileName), []byte("not gzip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readSourceIn(dir); err == nil || !strings.Contains(err.Error(), "corrupt compressed source") {
+		t.Errorf("corrupt source error = %v, want corrupt compressed source", err)
+	}
+}
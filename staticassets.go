@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticAssetsDir holds the stylesheet and scripts of the dashboard and
+// error pages, served on /assets.
+const staticAssetsDir = "assets"
+
+// staticAssetVersion is a hash of staticAssetsDir, computed when the
+// templates are loaded, so asset URLs change whenever a file does.
+var staticAssetVersion atomic.Pointer[string]
+
+// hashStaticAssets hashes the names and contents of the files in dir.
+func hashStaticAssets(dir string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		hash.Write([]byte(filepath.ToSlash(path) + "\x00"))
+		_, err = io.Copy(hash, file)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// updateStaticAssetVersion recomputes staticAssetVersion. Should the assets
+// not be readable, URLs go out unversioned rather than failing the load.
+func updateStaticAssetVersion() {
+	version, err := hashStaticAssets(staticAssetsDir)
+	if err != nil {
+		log.Printf("Warning: could not hash %s, asset URLs are not versioned: %v", staticAssetsDir, err)
+	}
+	staticAssetVersion.Store(&version)
+}
+
+// currentStaticAssetVersion returns staticAssetVersion, empty until the
+// templates are loaded.
+func currentStaticAssetVersion() string {
+	if version := staticAssetVersion.Load(); version != nil {
+		return *version
+	}
+	return ""
+}
+
+// staticAssetURL is the assetURL template function: the path of a file in
+// staticAssetsDir, versioned so browsers fetch it again once it changes.
+func staticAssetURL(name string) string {
+	assetURL := getConfig().PathPrefix + "/assets/" + name
+	if version := currentStaticAssetVersion(); version != "" {
+		assetURL += "?v=" + url.QueryEscape(version)
+	}
+	return assetURL
+}
+
+// staticAssetCacheControl lets any cache keep an asset requested with the
+// current version for a year, as its URL changes with its content. Other
+// requests, unversioned or with an outdated version, must revalidate.
+func staticAssetCacheControl() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if version := currentStaticAssetVersion(); version != "" && c.Query("v") == version {
+			c.Header("Cache-Control", cacheControlImmutable)
+		} else {
+			c.Header("Cache-Control", "public, no-cache")
+		}
+		c.Next()
+	}
+}
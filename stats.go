@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsLargestPages is how many pages GET /api/stats lists by size.
+const statsLargestPages = 10
+
+// PageSize is one entry of the largest pages in GET /api/stats.
+type PageSize struct {
+	ID        string `json:"id"`
+	Title     string `json:"title,omitempty"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// Stats is the GET /api/stats response.
+type Stats struct {
+	PageCount    int        `json:"pageCount"`
+	TotalBytes   int64      `json:"totalBytes"`
+	LargestPages []PageSize `json:"largestPages"`
+}
+
+// handleStats reports the disk space used by pages. Sizes are computed from
+// the page folders on each request, so assets added later are counted too.
+func handleStats(c *gin.Context) {
+	pages, err := listPages()
+	if err != nil {
+		log.Printf("Error reading public directory: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not compute stats")
+		return
+	}
+
+	stats := Stats{PageCount: len(pages), LargestPages: []PageSize{}}
+	for _, page := range pages {
+		size, err := folderSize(filepath.Join("public", page.ID))
+		if err != nil {
+			log.Printf("Error computing size of %s: %v", page.ID, err)
+		}
+		stats.TotalBytes += size
+		stats.LargestPages = append(stats.LargestPages, PageSize{ID: page.ID, Title: page.Title, SizeBytes: size})
+	}
+	sort.Slice(stats.LargestPages, func(i, j int) bool {
+		return stats.LargestPages[i].SizeBytes > stats.LargestPages[j].SizeBytes
+	})
+	if len(stats.LargestPages) > statsLargestPages {
+		stats.LargestPages = stats.LargestPages[:statsLargestPages]
+	}
+	respondJSON(c, http.StatusOK, stats)
+}
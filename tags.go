@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTagLength bounds PNG_MAX_TAG_LENGTH, keeping tags usable in URLs and
+// the dashboard.
+const maxTagLength = 128
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// TagCount is one entry of the GET /api/tags response.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// checkTag rejects a normalized tag outside the allowed character set or
+// longer than PNG_MAX_TAG_LENGTH.
+func checkTag(tag string) error {
+	maxLength := getConfig().MaxTagLength
+	if !tagPattern.MatchString(tag) || len(tag) > maxLength {
+		return fmt.Errorf("invalid tag %q: tags may only contain letters, digits, '-' and '_' (max %d characters)", tag, maxLength)
+	}
+	return nil
+}
+
+// normalizeTags trims, lowercases and de-duplicates tags, rejecting any that
+// fail checkTag and lists longer than PNG_MAX_TAGS.
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if err := checkTag(tag); err != nil {
+			return nil, err
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if maxTags := getConfig().MaxTags; maxTags > 0 && len(normalized) > maxTags {
+		return nil, fmt.Errorf("too many tags: a page may have at most %d, got %d", maxTags, len(normalized))
+	}
+	return normalized, nil
+}
+
+func handleListTags(c *gin.Context) {
+	pages, err := listPages()
+	if err != nil {
+		log.Printf("Error reading public directory: %v", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list tags")
+		return
+	}
+
+	listAll := isLoggedIn(c)
+	counts := make(map[string]int)
+	for _, page := range pages {
+		if !listAll && page.Visibility != visibilityPublic {
+			continue
+		}
+		for _, tag := range page.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	respondJSON(c, http.StatusOK, tags)
+}
+
+// TagRenameRequest is the body of POST /api/tags/rename.
+type TagRenameRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to"   binding:"required"`
+}
+
+// TagDeleteRequest is the body of POST /api/tags/delete.
+type TagDeleteRequest struct {
+	Tag string `json:"tag" binding:"required"`
+}
+
+// TagBulkResult reports the pages changed by a bulk tag operation.
+type TagBulkResult struct {
+	Affected int      `json:"affected"`
+	Pages    []string `json:"pages"`
+}
+
+// errTagsUnchanged skips writing the metadata of pages a bulk operation does
+// not touch.
+var errTagsUnchanged = errors.New("tags unchanged")
+
+// retagPages applies rewrite to the tags of every page, each under its own
+// metadata lock, and returns the IDs of the pages whose tags changed. Only
+// meta.json is written: the tags are not part of the rendered page.
+func retagPages(c *gin.Context, rewrite func(tags []string) ([]string, bool)) ([]string, error) {
+	entries, err := os.ReadDir("public")
+	if err != nil {
+		return nil, err
+	}
+	affected := []string{}
+	for _, entry := range entries {
+		if !isPageDir(entry) {
+			continue
+		}
+		pageID := entry.Name()
+		_, err := updatePageMeta(pageID, func(meta *PageMeta) error {
+			tags, changed := rewrite(meta.Tags)
+			if !changed {
+				return errTagsUnchanged
+			}
+			meta.Tags = tags
+			return nil
+		})
+		if errors.Is(err, errTagsUnchanged) {
+			continue
+		}
+		if err != nil {
+			return affected, fmt.Errorf("page %s: %w", pageID, err)
+		}
+		affected = append(affected, pageID)
+		recordAudit(c, auditActionEdit, pageID)
+		pageEvents.publish(eventPageUpdated, pageID)
+	}
+	return affected, nil
+}
+
+// handleRenameTag replaces a tag with another on every page carrying it.
+// Pages that already have both keep a single copy.
+func handleRenameTag(c *gin.Context) {
+	var req TagRenameRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	from, to := normalizeTag(req.From), normalizeTag(req.To)
+	if err := checkTag(to); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidTag, err.Error())
+		return
+	}
+	affected, err := retagPages(c, func(tags []string) ([]string, bool) {
+		if !slices.Contains(tags, from) || from == to {
+			return tags, false
+		}
+		renamed := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			if tag == from {
+				tag = to
+			}
+			if !slices.Contains(renamed, tag) {
+				renamed = append(renamed, tag)
+			}
+		}
+		return renamed, true
+	})
+	respondTagBulk(c, "rename", affected, err)
+}
+
+// handleDeleteTag removes a tag from every page carrying it.
+func handleDeleteTag(c *gin.Context) {
+	var req TagDeleteRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	tag := normalizeTag(req.Tag)
+	affected, err := retagPages(c, func(tags []string) ([]string, bool) {
+		if !slices.Contains(tags, tag) {
+			return tags, false
+		}
+		return slices.DeleteFunc(slices.Clone(tags), func(t string) bool { return t == tag }), true
+	})
+	respondTagBulk(c, "delete", affected, err)
+}
+
+// respondTagBulk reports the outcome of a bulk tag operation. Pages are
+// updated one by one, so on failure the ones already changed are logged.
+func respondTagBulk(c *gin.Context, operation string, affected []string, err error) {
+	if err != nil {
+		log.Printf("Error during tag %s after updating %d pages %v: %v", operation, len(affected), affected, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not update tags")
+		return
+	}
+	log.Printf("Tag %s: %d pages updated", operation, len(affected))
+	respondJSON(c, http.StatusOK, TagBulkResult{Affected: len(affected), Pages: affected})
+}
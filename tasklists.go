@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	stdhtml "html"
+	"strings"
+)
+
+// taskListJS enables the GFM task list checkboxes and keeps their state in
+// the visitor's localStorage, keyed by page ID and checkbox index. Nothing is
+// sent back to the server. The page ID is read from the script tag so the
+// body is the same on every page and can be allowed by its CSP hash. The
+// checkboxes are found through articleContentAttr, as the wrapping element's
+// tag and class are configurable.
+const taskListJS = `
+(function () {
+    var key = "press-n-go:tasks:" + document.currentScript.dataset.pageId;
+    var saved = {};
+    try { saved = JSON.parse(localStorage.getItem(key)) || {}; } catch (e) {}
+    document.querySelectorAll('[` + articleContentAttr + `] li > input[type="checkbox"]').forEach(function (box, i) {
+        box.disabled = false;
+        if (i in saved) box.checked = saved[i];
+        box.addEventListener("change", function () {
+            saved[i] = box.checked;
+            try { localStorage.setItem(key, JSON.stringify(saved)); } catch (e) {}
+        });
+    });
+})();
+`
+
+// taskListScript returns the script making task lists interactive when
+// PNG_INTERACTIVE_TASKS is on and the rendered page has any.
+func taskListScript(pageID, htmlContent string) string {
+	if !getConfig().InteractiveTasks || !strings.Contains(htmlContent, `type="checkbox"`) {
+		return ""
+	}
+	return fmt.Sprintf(`<script data-page-id="%s">%s</script>`, stdhtml.EscapeString(pageID), taskListJS)
+}
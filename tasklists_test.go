@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTaskListScriptFindsContent(t *testing.T) {
+	t.Chdir(t.TempDir())
+	tests := []struct {
+		name         string
+		articleTag   string
+		articleClass string
+		wantStart    string
+	}{
+		{name: "default article", articleTag: "article", articleClass: "markdown-body", wantStart: `<article data-page-content class="markdown-body">`},
+		{name: "main without class", articleTag: "main", wantStart: `<main data-page-content>`},
+		{name: "div with another class", articleTag: "div", articleClass: "prose", wantStart: `<div data-page-content class="prose">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultTestConfig(t)
+			cfg.ArticleTag, cfg.ArticleClass, cfg.InteractiveTasks, cfg.OGImage = tt.articleTag, tt.articleClass, true, false
+			setTestConfig(t, cfg)
+			page, err := renderPage(context.Background(), "tasks", UploadRequest{Type: "markdown", Content: "- [ ] one\n- [x] two\n"}, &PageMeta{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(page.html, articleStart+tt.wantStart) {
+				t.Errorf("page does not start its content with %s:\n%s", tt.wantStart, page.html)
+			}
+			if !strings.Contains(page.html, `<script data-page-id="tasks">`+taskListJS+`</script>`) {
+				t.Errorf("page has no task list script:\n%s", page.html)
+			}
+		})
+	}
+	if !strings.Contains(taskListJS, `querySelectorAll('[data-page-content] li > input[type="checkbox"]')`) {
+		t.Error("task list script does not select the checkboxes by the content attribute")
+	}
+	if strings.Contains(taskListJS, "article") {
+		t.Error("task list script depends on the article tag")
+	}
+}
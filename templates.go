@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+const templatesGlob = "templates/*.html"
+
+// templateSet renders the dashboard templates and lets them be re-parsed
+// while requests are being served. scriptHashes allow their inline scripts in
+// PNG_DASHBOARD_CSP.
+type templateSet struct {
+	current      atomic.Pointer[template.Template]
+	scriptHashes atomic.Pointer[[]string]
+}
+
+var htmlTemplates = &templateSet{}
+
+// templateFuncs are available to every template. basePath is PNG_PATH_PREFIX,
+// to be put in front of the links to the application's own routes, assetURL
+// links to a versioned file of the assets folder, and displayTime and
+// isoTime format timestamps in PNG_TIMEZONE.
+var templateFuncs = template.FuncMap{
+	"basePath":    func() string { return getConfig().PathPrefix },
+	"assetURL":    staticAssetURL,
+	"displayTime": displayTime,
+	"isoTime":     isoTime,
+}
+
+// load parses the templates, replacing login.html with loginTemplate, from
+// PNG_LOGIN_TEMPLATE, when set. The assets they link to are hashed again, so
+// a reload picks up changed files too.
+func (t *templateSet) load(loginTemplate string) error {
+	parsed, err := template.New("").Funcs(templateFuncs).ParseGlob(templatesGlob)
+	if err != nil {
+		return err
+	}
+	files, err := filepath.Glob(templatesGlob)
+	if err != nil {
+		return err
+	}
+	sources := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sources[file] = string(data)
+	}
+	if loginTemplate != "" {
+		data, err := os.ReadFile(loginTemplate)
+		if err != nil {
+			return fmt.Errorf("PNG_LOGIN_TEMPLATE: %w", err)
+		}
+		if _, err := parsed.New("login.html").Parse(string(data)); err != nil {
+			return fmt.Errorf("PNG_LOGIN_TEMPLATE: %w", err)
+		}
+		delete(sources, filepath.Join(filepath.Dir(templatesGlob), "login.html"))
+		sources[loginTemplate] = string(data)
+	}
+	var hashes []string
+	for _, name := range slices.Sorted(maps.Keys(sources)) {
+		hashes = append(hashes, templateScriptHashes(name, sources[name])...)
+	}
+	updateStaticAssetVersion()
+	t.scriptHashes.Store(&hashes)
+	t.current.Store(parsed)
+	return nil
+}
+
+// templateScriptHashes hashes the inline scripts of a template as they are
+// rendered: html/template drops their comments, so each one is rendered on
+// its own first. Scripts holding template actions could not be allowed by
+// hash, so they are reported and left to be blocked by the dashboard CSP.
+func templateScriptHashes(name, source string) []string {
+	var hashes []string
+	for _, match := range inlineScriptPattern.FindAllStringSubmatch(source, -1) {
+		if scriptSrcPattern.MatchString(match[1]) {
+			continue
+		}
+		if strings.Contains(match[2], "{{") {
+			log.Printf("Warning: %s has an inline script with template actions, which PNG_DASHBOARD_CSP will block: "+
+				"pass values through data- attributes instead", name)
+			continue
+		}
+		script, err := template.New("").Parse("<script>" + match[2] + "</script>")
+		if err != nil {
+			continue
+		}
+		var rendered strings.Builder
+		if err := script.Execute(&rendered, nil); err != nil {
+			continue
+		}
+		hashes = append(hashes, inlineScriptHashes(rendered.String())...)
+	}
+	return hashes
+}
+
+// inlineScripts returns the hashes allowing the templates' inline scripts.
+func (t *templateSet) inlineScripts() []string {
+	if hashes := t.scriptHashes.Load(); hashes != nil {
+		return *hashes
+	}
+	return nil
+}
+
+func (t *templateSet) Instance(name string, data any) render.Render {
+	return render.HTML{Template: t.current.Load(), Name: name, Data: data}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewPageID stands in for the page ID of previews not tied to a page, for
+// heading ID prefixes and the like.
+const previewPageID = "preview"
+
+// ThemePreviewRequest is the body of POST /api/preview/themes.
+type ThemePreviewRequest struct {
+	Content string   `json:"content" binding:"required"`
+	Type    string   `json:"type"    binding:"omitempty,oneof=markdown text"`
+	Themes  []string `json:"themes"  binding:"required"`
+	// PageID, when set, renders the content as that page would be.
+	PageID string `json:"pageId"`
+}
+
+// handleThemePreview renders content once per built-in theme asked for,
+// without writing anything, and answers the full pages keyed by theme name so
+// they can be compared side by side.
+func handleThemePreview(c *gin.Context) {
+	var req ThemePreviewRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.PageID != "" && !isValidPageID(req.PageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	// Every theme can only be asked for once, which bounds the work done
+	if len(req.Themes) > len(builtinThemes) {
+		respondError(c, http.StatusBadRequest, codeInvalidTheme, fmt.Sprintf("At most %d themes can be previewed at once", len(builtinThemes)))
+		return
+	}
+	for i, theme := range req.Themes {
+		if _, ok := builtinThemes[theme]; !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidTheme, fmt.Sprintf("Unknown theme %q: use github, blueprint or win98", theme))
+			return
+		}
+		if slices.Contains(req.Themes[:i], theme) {
+			respondError(c, http.StatusBadRequest, codeInvalidTheme, fmt.Sprintf("Theme %q is listed twice", theme))
+			return
+		}
+	}
+	upload := UploadRequest{Content: req.Content, Type: cmp.Or(req.Type, "markdown")}
+	if err := validateContent(upload); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidContent, err.Error())
+		return
+	}
+
+	pageID := cmp.Or(req.PageID, previewPageID)
+	previews := make(map[string]string, len(req.Themes))
+	for _, theme := range req.Themes {
+		upload.Theme = theme
+		page, err := renderDocument(c.Request.Context(), pageID, "", upload, &PageMeta{})
+		if err != nil {
+			writePageError(c, err)
+			return
+		}
+		previews[theme] = page.html
+	}
+	respondJSON(c, http.StatusOK, previews)
+}
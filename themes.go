@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// builtinThemes are the stylesheets selectable with "theme" in an upload,
+// keyed by name. Markdown and text pages without a theme or themeCSS get
+// PNG_DEFAULT_THEME.
+var builtinThemes = map[string]string{
+	"github": `
+    body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif, "Apple Color Emoji", "Segoe UI Emoji"; line-height: 1.6; color: #24292e; background-color: #fff; margin: 0; padding: 0; }
+    .markdown-body { box-sizing: border-box; min-width: 200px; max-width: 980px; margin: 0 auto; padding: 45px; }
+    h1, h2, h3, h4, h5, h6 { margin-top: 24px; margin-bottom: 16px; font-weight: 600; line-height: 1.25; border-bottom: 1px solid #eaecef; padding-bottom: .3em; }
+    a { color: #0366d6; text-decoration: none; } a:hover { text-decoration: underline; }
+    pre { background-color: #f6f8fa; border-radius: 6px; padding: 16px; }`,
+	"blueprint": `
+    body { font-family: 'Roboto Mono', monospace; line-height: 1.6; color: #fff; background-color: #0a2f5e; background-image: linear-gradient(rgba(255,255,255,0.05) 1px, transparent 1px), linear-gradient(90deg, rgba(255,255,255,0.05) 1px, transparent 1px); background-size: 20px 20px; }
+    .markdown-body { box-sizing: border-box; max-width: 980px; margin: 0 auto; padding: 45px; }
+    h1, h2, h3 { color: #fff; border-bottom: 1px solid #fff; }
+    a { color: #fff; text-decoration: underline; }
+    pre { background-color: rgba(0,0,0,0.2); border: 1px solid #fff; padding: 1em; }
+    blockquote { border-left: 3px solid #fff; padding-left: 1em; color: #eee; }`,
+	"win98": `
+    body { font-family: 'Tahoma', 'MS Sans Serif', sans-serif; font-size: 12px; line-height: 1.4; color: #000; background-color: #008080; }
+    .markdown-body { box-sizing: border-box; max-width: 980px; margin: 1em auto; padding: 2px; border: 2px solid; border-top-color: #fff; border-left-color: #fff; border-right-color: #000; border-bottom-color: #000; background: #c0c0c0; }
+    .markdown-body-content { padding: 1em; }
+    h1, h2, h3 { font-size: 13px; font-weight: bold; background: linear-gradient(to right, #000080, #1084d0); color: #fff; padding: 4px 6px; margin: 1em 0; }
+    a { color: #0000ff; }
+    pre { font-family: 'Courier New', monospace; background: #fff; border: 1px solid; border-top-color: #808080; border-left-color: #808080; border-right-color: #fff; border-bottom-color: #fff; padding: 1em; margin: 1em 0; overflow-x: auto; box-shadow: 1px 1px 0 #000; }
+    blockquote { border: 1px solid #808080; padding: 1em; margin: 1em 0; background: #e0e0e0; }
+    table { border-collapse: collapse; } table th, table td { border: 1px solid #808080; padding: 5px; } table th { background: #c0c0c0; border: 2px outset; }`,
+}
+
+// themeNone disables the default theme in PNG_DEFAULT_THEME.
+const themeNone = "none"
+
+// pageThemeCSS returns the stylesheet for an upload: its themeCSS when given,
+// even empty, else its named theme, else PNG_DEFAULT_THEME.
+func pageThemeCSS(req UploadRequest) string {
+	if req.ThemeCSS != nil {
+		return *req.ThemeCSS
+	}
+	if req.Theme != "" {
+		return builtinThemes[req.Theme]
+	}
+	return builtinThemes[getConfig().DefaultTheme]
+}
+
+// styleEndPattern matches what would end the <style> element the theme is
+// embedded in, whatever follows it.
+var styleEndPattern = regexp.MustCompile(`(?i)</style`)
+
+// validateThemeCSS rejects a themeCSS that would not stay inside its <style>
+// element: one containing </style, which would let it inject markup, or with
+// unbalanced braces, unterminated strings or comments, which would swallow or
+// break the rest of the stylesheet. It is a sanity check, not a CSS parser.
+func validateThemeCSS(css string) error {
+	if styleEndPattern.MatchString(css) {
+		return errors.New("themeCSS must not contain </style")
+	}
+	depth := 0
+	for i := 0; i < len(css); i++ {
+		switch c := css[i]; c {
+		case '\\':
+			i++
+		case '/':
+			if i+1 < len(css) && css[i+1] == '*' {
+				end := indexFrom(css, "*/", i+2)
+				if end < 0 {
+					return errors.New("themeCSS has an unterminated comment")
+				}
+				i = end + 1
+			}
+		case '"', '\'':
+			end := i + 1
+			for ; end < len(css) && css[end] != c && css[end] != '\n'; end++ {
+				if css[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(css) || css[end] != c {
+				return fmt.Errorf("themeCSS has an unterminated string at offset %d", i)
+			}
+			i = end
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return fmt.Errorf("themeCSS has an unmatched } at offset %d", i)
+			}
+			depth--
+		}
+	}
+	if depth > 0 {
+		return errors.New("themeCSS has an unclosed {")
+	}
+	return nil
+}
+
+// indexFrom is strings.Index starting at offset from.
+func indexFrom(s, substr string, from int) int {
+	i := strings.Index(s[from:], substr)
+	if i < 0 {
+		return -1
+	}
+	return from + i
+}
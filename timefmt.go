@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	// The alpine image ships without a time zone database for PNG_TIMEZONE
+	_ "time/tzdata"
+)
+
+// displayTime formats t for readers in PNG_TIMEZONE, with an explicit UTC
+// offset. Stored and API timestamps stay in UTC.
+func displayTime(t time.Time) string {
+	return t.In(getConfig().location).Format("2006-01-02 15:04 -07:00")
+}
+
+// isoTime formats t in PNG_TIMEZONE as RFC 3339, for datetime attributes.
+func isoTime(t time.Time) string {
+	return t.In(getConfig().location).Format(time.RFC3339)
+}
+
+// relativeTime describes t relative to now, e.g. "3 days ago".
+func relativeTime(t, now time.Time) string {
+	elapsed := now.Sub(t)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return pluralAgo(int(elapsed/time.Minute), "minute")
+	case elapsed < 24*time.Hour:
+		return pluralAgo(int(elapsed/time.Hour), "hour")
+	case elapsed < 30*24*time.Hour:
+		return pluralAgo(int(elapsed/(24*time.Hour)), "day")
+	case elapsed < 365*24*time.Hour:
+		return pluralAgo(int(elapsed/(30*24*time.Hour)), "month")
+	default:
+		return pluralAgo(int(elapsed/(365*24*time.Hour)), "year")
+	}
+}
+
+func pluralAgo(count int, unit string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s ago", unit)
+	}
+	return fmt.Sprintf("%d %ss ago", count, unit)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newHTTPServer returns a server with the configured connection timeouts, so
+// slow clients cannot hold connections open indefinitely.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	cfg := getConfig()
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       cfg.ServerReadTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+		IdleTimeout:       cfg.ServerIdleTimeout,
+	}
+}
+
+// requestTimeout attaches a deadline of PNG_REQUEST_TIMEOUT to each request
+// context. Handlers doing long work check the context and stop early; if the
+// deadline passed before anything was written, the client gets a 503.
+func requestTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := getConfig().RequestTimeout
+		// The event stream stays open for as long as the client listens
+		if timeout <= 0 || c.FullPath() == eventsPath {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			abortWithError(c, http.StatusServiceUnavailable, codeTimeout, "Request timed out")
+		}
+	}
+}
+
+// writePageError answers a failed page write with the matching status:
+// 503 when the request deadline passed, 400 for invalid content, 422 for
+// content too expensive to render, else 500.
+func writePageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		respondError(c, http.StatusServiceUnavailable, codeTimeout, "Request timed out")
+	case errors.Is(err, errRenderRejected):
+		respondError(c, http.StatusUnprocessableEntity, codeRenderFailed, err.Error())
+	case errors.Is(err, errInvalidContent):
+		respondError(c, http.StatusBadRequest, codeInvalidContent, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+}
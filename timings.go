@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type stopwatchKey struct{}
+
+// stopwatch records how long each phase of a page write took, for the
+// timings returned by uploads in debug mode.
+type stopwatch struct {
+	mu     sync.Mutex
+	start  time.Time
+	last   time.Time
+	phases map[string]float64
+}
+
+func newStopwatch() *stopwatch {
+	now := time.Now()
+	return &stopwatch{start: now, last: now, phases: make(map[string]float64)}
+}
+
+// withStopwatch returns a context carrying sw, picked up by the page write
+// functions.
+func withStopwatch(ctx context.Context, sw *stopwatch) context.Context {
+	return context.WithValue(ctx, stopwatchKey{}, sw)
+}
+
+// lap attributes the time since the previous lap to phase. It does nothing
+// when ctx carries no stopwatch.
+func lap(ctx context.Context, phase string) {
+	sw, ok := ctx.Value(stopwatchKey{}).(*stopwatch)
+	if !ok {
+		return
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := time.Now()
+	sw.phases[phase+"Ms"] += milliseconds(now.Sub(sw.last))
+	sw.last = now
+}
+
+// timings returns the recorded phases and the total since start, in
+// milliseconds.
+func (sw *stopwatch) timings(start time.Time) map[string]float64 {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	result := make(map[string]float64, len(sw.phases)+1)
+	for phase, ms := range sw.phases {
+		result[phase] = ms
+	}
+	result["totalMs"] = milliseconds(time.Since(start))
+	return result
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// acmeEnabled reports whether certificates should be obtained automatically.
+func acmeEnabled() bool {
+	return len(getConfig().ACMEDomains) > 0
+}
+
+// runACME serves the handler over HTTPS on :443 using Let's Encrypt
+// certificates, and answers the HTTP-01 challenge on :80, until ctx is
+// cancelled.
+func runACME(ctx context.Context, handler http.Handler) error {
+	cfg := getConfig()
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+		Cache:      autocert.DirCache(cfg.ACMECacheDir),
+		Email:      cfg.ACMEEmail,
+	}
+
+	// The challenge listener also redirects plain HTTP traffic to HTTPS.
+	challengeServer := &http.Server{
+		Addr:              ":80",
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	tlsConfig := manager.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	server := newHTTPServer(":443", handler)
+	server.TLSConfig = tlsConfig
+
+	return serveUntilDone(ctx, map[*http.Server]func() error{
+		challengeServer: challengeServer.ListenAndServe,
+		server:          func() error { return server.ListenAndServeTLS("", "") },
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	stdhtml "html"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// tocMarker is the paragraph of markdown replaced with the table of contents.
+const tocMarker = "[[TOC]]"
+
+// tocTransformer adds a table of contents to pages rendered with toc, linking
+// to the headings from MinLevel to MaxLevel. It replaces a paragraph reading
+// [[TOC]], or is inserted at the top of the document, after a leading h1,
+// when there is none. No table is added to a page without such headings.
+type tocTransformer struct {
+	MinLevel int
+	MaxLevel int
+}
+
+func (t tocTransformer) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+	var headings []*ast.Heading
+	var markers []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			if _, ok := n.AttributeString("id"); ok && n.Level >= t.MinLevel && n.Level <= t.MaxLevel {
+				headings = append(headings, n)
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.Paragraph:
+			if lines := n.Lines(); lines.Len() == 1 {
+				line := lines.At(0)
+				if strings.TrimSpace(string(line.Value(source))) == tocMarker {
+					markers = append(markers, n)
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	var toc ast.Node
+	if len(headings) > 0 {
+		// A code string is written as is, so the list is built as HTML
+		block := ast.NewTextBlock()
+		list := ast.NewString([]byte(tocHTML(headings, source)))
+		list.SetCode(true)
+		block.AppendChild(block, list)
+		toc = block
+	}
+	if len(markers) == 0 {
+		if toc == nil {
+			return
+		}
+		first := doc.FirstChild()
+		if heading, ok := first.(*ast.Heading); ok && heading.Level == 1 {
+			doc.InsertAfter(doc, first, toc)
+		} else {
+			doc.InsertBefore(doc, first, toc)
+		}
+		return
+	}
+	for i, marker := range markers {
+		switch {
+		case toc == nil || i > 0:
+			// Only the first marker gets the table, the others are dropped
+			marker.Parent().RemoveChild(marker.Parent(), marker)
+		default:
+			marker.Parent().ReplaceChild(marker.Parent(), marker, toc)
+		}
+	}
+}
+
+// tocHTML renders the headings as nested lists, one level per heading level.
+// Deeper headings following a shallower one are nested below it; a heading
+// skipping levels is nested only once.
+func tocHTML(headings []*ast.Heading, source []byte) string {
+	var b strings.Builder
+	b.WriteString(`<nav class="toc" aria-label="Table of contents">` + "\n")
+	var levels []int
+	for _, heading := range headings {
+		for len(levels) > 0 && levels[len(levels)-1] > heading.Level {
+			b.WriteString("</li>\n</ul>\n")
+			levels = levels[:len(levels)-1]
+		}
+		if len(levels) > 0 && levels[len(levels)-1] == heading.Level {
+			b.WriteString("</li>\n")
+		} else {
+			b.WriteString("<ul>\n")
+			levels = append(levels, heading.Level)
+		}
+		id, _ := heading.AttributeString("id")
+		b.WriteString(`<li><a href="#` + stdhtml.EscapeString(string(toBytes(id))) + `">` + stdhtml.EscapeString(headingText(heading, source)) + "</a>")
+	}
+	for range levels {
+		b.WriteString("</li>\n</ul>\n")
+	}
+	b.WriteString("</nav>")
+	return b.String()
+}
+
+// headingText returns the plain text of a heading, without the section
+// numbers and anchors added by the other transformers.
+func headingText(heading *ast.Heading, source []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(heading, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			if class, ok := n.AttributeString("class"); ok && string(toBytes(class)) == "heading-anchor" {
+				return ast.WalkSkipChildren, nil
+			}
+		case *ast.Text:
+			b.Write(n.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			if !n.IsCode() {
+				b.Write(n.Value)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// toBytes returns an attribute value set either as bytes or as a string.
+func toBytes(value any) []byte {
+	switch value := value.(type) {
+	case []byte:
+		return value
+	case string:
+		return []byte(value)
+	}
+	return nil
+}
+
+// checkTOCLevels rejects a table of contents whose levels, from the upload or
+// from PNG_TOC_MIN_LEVEL and PNG_TOC_MAX_LEVEL, are out of order.
+func checkTOCLevels(req UploadRequest) error {
+	opts := markdownOptionsFor(req)
+	if opts.TOCMinLevel > opts.TOCMaxLevel {
+		return errors.New("tocMinLevel cannot be greater than tocMaxLevel")
+	}
+	return nil
+}
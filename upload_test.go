@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadForm builds a multipart upload with content in the file field and
+// the other fields as given.
+func uploadForm(t *testing.T, content string, fields map[string]string) (io.Reader, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := form.CreateFormFile("file", "page.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, form.FormDataContentType()
+}
+
+// TestUploadAndUpdateValidation sends the same requests to POST /api/upload
+// and PUT /api/pages/:id, which must bind and validate them alike.
+func TestUploadAndUpdateValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	cfg := defaultTestConfig(t)
+	cfg.OGImage = false
+	cfg.MaxUploadSize = 1 << 10
+	cfg.AllowedTypes = []string{"markdown", "text"}
+	setTestConfig(t, cfg)
+	newTestPage(t, "existing", PageMeta{Type: "markdown"})
+
+	router := gin.New()
+	router.POST("/api/upload", handleUpload)
+	router.PUT("/api/pages/:id", handleUpdatePage)
+
+	jsonBody := func(body string) func(t *testing.T) (io.Reader, string) {
+		return func(*testing.T) (io.Reader, string) { return strings.NewReader(body), "application/json" }
+	}
+	tests := []struct {
+		name       string
+		body       func(t *testing.T) (io.Reader, string)
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "JSON", body: jsonBody(`{"content": "# Hi", "type": "markdown"}`), wantStatus: http.StatusOK},
+		{name: "multipart", body: func(t *testing.T) (io.Reader, string) {
+			return uploadForm(t, "# Hi", map[string]string{"type": "markdown", "tags": "work"})
+		}, wantStatus: http.StatusOK},
+		{name: "unsupported content type", body: func(*testing.T) (io.Reader, string) {
+			return strings.NewReader("# Hi"), "text/markdown"
+		}, wantStatus: http.StatusUnsupportedMediaType, wantCode: codeUnsupportedMedia},
+		{name: "too large", body: jsonBody(`{"content": "` + strings.Repeat("x", 2<<10) + `"}`), wantStatus: http.StatusRequestEntityTooLarge, wantCode: codeTooLarge},
+		{name: "multipart without file", body: func(t *testing.T) (io.Reader, string) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			_ = form.WriteField("type", "markdown")
+			_ = form.Close()
+			return &body, form.FormDataContentType()
+		}, wantStatus: http.StatusBadRequest},
+		{name: "invalid tag", body: jsonBody(`{"content": "# Hi", "tags": ["no spaces"]}`), wantStatus: http.StatusBadRequest, wantCode: codeInvalidTag},
+		{name: "type not allowed", body: jsonBody(`{"content": "<p>hi</p>", "type": "html"}`), wantStatus: http.StatusForbidden, wantCode: codeForbidden},
+		{name: "invalid theme", body: jsonBody(`{"content": "# Hi", "themeCSS": "body { color: red"}`), wantStatus: http.StatusBadRequest, wantCode: codeInvalidTheme},
+		{name: "binary content", body: jsonBody(`{"content": "a\u0000b"}`), wantStatus: http.StatusBadRequest, wantCode: codeInvalidContent},
+	}
+	for _, endpoint := range []struct{ method, path string }{
+		{method: http.MethodPost, path: "/api/upload"},
+		{method: http.MethodPut, path: "/api/pages/existing"},
+	} {
+		for _, tt := range tests {
+			t.Run(endpoint.method+" "+tt.name, func(t *testing.T) {
+				body, contentType := tt.body(t)
+				req := httptest.NewRequest(endpoint.method, endpoint.path, body)
+				req.Header.Set("Content-Type", contentType)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+				}
+				if tt.wantCode != "" {
+					var apiErr APIError
+					if err := json.Unmarshal(rec.Body.Bytes(), &apiErr); err != nil || apiErr.Code != tt.wantCode {
+						t.Errorf("error = %s, want code %s", rec.Body.String(), tt.wantCode)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUpdatePageFromForm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	cfg := defaultTestConfig(t)
+	cfg.OGImage = false
+	setTestConfig(t, cfg)
+	newTestPage(t, "existing", PageMeta{Type: "markdown"})
+
+	router := gin.New()
+	router.PUT("/api/pages/:id", handleUpdatePage)
+	body, contentType := uploadForm(t, "# Updated\n", map[string]string{"type": "markdown", "tags": "Work"})
+	req := httptest.NewRequest(http.MethodPut, "/api/pages/existing", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	meta, err := readPageMeta("existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "Updated" || len(meta.Tags) != 1 || meta.Tags[0] != "work" {
+		t.Errorf("meta = %+v, want the form's title and normalized tag", meta)
+	}
+	page, err := os.ReadFile(filepath.Join("public", "existing", "index.html"))
+	if err != nil || !strings.Contains(string(page), "Updated") {
+		t.Errorf("rendered page = %q, %v, want the new content", page, err)
+	}
+}
+
+func TestUploadFormFlags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name          string
+		fields        map[string]string
+		wantErr       string
+		wantForceNew  bool
+		wantOverwrite bool
+	}{
+		{name: "absent", fields: map[string]string{}},
+		{name: "true values", fields: map[string]string{"forceNew": "true", "overwrite": "1"}, wantForceNew: true, wantOverwrite: true},
+		{name: "false values", fields: map[string]string{"forceNew": "false", "overwrite": "0"}},
+		{name: "invalid overwrite", fields: map[string]string{"overwrite": "yes"}, wantErr: `overwrite must be a boolean, not "yes"`},
+		{name: "invalid forceNew", fields: map[string]string{"forceNew": "on"}, wantErr: `forceNew must be a boolean, not "on"`},
+		{name: "empty overwrite", fields: map[string]string{"overwrite": ""}, wantErr: `overwrite must be a boolean, not ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := uploadForm(t, "# Hi", tt.fields)
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/upload", body)
+			c.Request.Header.Set("Content-Type", contentType)
+			var req UploadRequest
+			err := bindUploadForm(c, &req)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.ForceNew != tt.wantForceNew || req.Overwrite != tt.wantOverwrite {
+				t.Errorf("forceNew, overwrite = %v, %v, want %v, %v", req.ForceNew, req.Overwrite, tt.wantForceNew, tt.wantOverwrite)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+var errMissingUploadFile = errors.New("file is required: send the content as a multipart file field")
+
+// bindUploadRequest fills req from either a JSON body or a multipart form
+// carrying the content as a file field, reporting the error itself when it
+// returns false. Both are capped at PNG_MAX_UPLOAD_SIZE.
+func bindUploadRequest(c *gin.Context, cfg *Config, req *UploadRequest) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxUploadSize)
+	var err error
+	switch c.ContentType() {
+	case binding.MIMEJSON:
+		err = bindJSON(c, req)
+	case binding.MIMEMultipartPOSTForm:
+		err = bindUploadForm(c, req)
+	default:
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, fmt.Sprintf("Unsupported Content-Type %q: send application/json or multipart/form-data", c.ContentType()))
+		return false
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondError(c, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("The upload exceeds the maximum size of %d bytes", cfg.MaxUploadSize))
+		return false
+	}
+	if err != nil {
+		respondBindError(c, err)
+		return false
+	}
+	return true
+}
+
+// bindUploadForm reads a multipart upload: the content comes from the file
+// field and the other fields are named like their JSON counterparts.
+func bindUploadForm(c *gin.Context, req *UploadRequest) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return errMissingUploadFile
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	req.Content = string(content)
+	req.Type = c.PostForm("type")
+	if themeCSS, ok := c.GetPostForm("themeCSS"); ok {
+		req.ThemeCSS = &themeCSS
+	}
+	req.Theme = c.PostForm("theme")
+	req.Lang = c.PostForm("lang")
+	req.Dir = c.PostForm("dir")
+	req.Tags = c.PostFormArray("tags")
+	req.Title = c.PostForm("title")
+	req.Description = c.PostForm("description")
+	req.Author = c.PostForm("author")
+	req.OGType = c.PostForm("ogType")
+	req.TwitterCard = c.PostForm("twitterCard")
+	if req.ForceNew, err = formFlag(c, "forceNew"); err != nil {
+		return err
+	}
+	req.Slug = c.PostForm("slug")
+	req.Visibility = c.PostForm("visibility")
+	req.HeadHTML = c.PostForm("headHTML")
+	req.FooterHTML = c.PostForm("footerHTML")
+	req.Wrap = c.PostForm("wrap")
+	if req.Overwrite, err = formFlag(c, "overwrite"); err != nil {
+		return err
+	}
+	if req.Draft, err = formBool(c, "draft"); err != nil {
+		return err
+	}
+	if req.HardWraps, err = formBool(c, "hardWraps"); err != nil {
+		return err
+	}
+	if req.NumberHeadings, err = formBool(c, "numberHeadings"); err != nil {
+		return err
+	}
+	if req.TOC, err = formBool(c, "toc"); err != nil {
+		return err
+	}
+	if req.TOCMinLevel, err = formInt(c, "tocMinLevel"); err != nil {
+		return err
+	}
+	if req.TOCMaxLevel, err = formInt(c, "tocMaxLevel"); err != nil {
+		return err
+	}
+	if req.AllowRawHTML, err = formBool(c, "allowRawHTML"); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(req)
+}
+
+// formBool reads an optional boolean form field, nil when it is absent.
+func formBool(c *gin.Context, name string) (*bool, error) {
+	value, ok := c.GetPostForm(name)
+	if !ok {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a boolean, not %q", name, value)
+	}
+	return &b, nil
+}
+
+// formFlag reads a boolean form field for a plain bool, false when absent.
+func formFlag(c *gin.Context, name string) (bool, error) {
+	b, err := formBool(c, name)
+	if err != nil || b == nil {
+		return false, err
+	}
+	return *b, nil
+}
+
+// formInt reads an optional integer form field, nil when absent.
+func formInt(c *gin.Context, name string) (*int, error) {
+	value, ok := c.GetPostForm(name)
+	if !ok {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer, not %q", name, value)
+	}
+	return &i, nil
+}
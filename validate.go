@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/goldmark"
+	gmmeta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Statuses of the link targets reported by POST /api/validate.
+const (
+	linkStatusOK        = "ok"
+	linkStatusMissing   = "missing"
+	linkStatusExternal  = "external"
+	linkStatusRelative  = "relative"
+	linkStatusUnchecked = "unchecked"
+	linkStatusBlocked   = "disallowed"
+)
+
+type ValidateRequest struct {
+	Content string `json:"content" binding:"required"`
+	// PageID, when set, is the page whose assets relative references are
+	// checked against.
+	PageID string `json:"pageId"`
+}
+
+type LinkTarget struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+}
+
+type ValidationResult struct {
+	Valid    bool         `json:"valid"`
+	Title    string       `json:"title"`
+	Errors   []string     `json:"errors"`
+	Warnings []string     `json:"warnings"`
+	Links    []LinkTarget `json:"links"`
+}
+
+// outlineMarkdown parses markdown without any of the page transformers, so
+// links are seen as written, including the ones PNG_LINK_SCHEMES would drop.
+var outlineMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, gmmeta.Meta),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// handleValidate checks markdown the way an upload would render it, without
+// writing anything, and reports structured diagnostics.
+func handleValidate(c *gin.Context) {
+	var req ValidateRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.PageID != "" && !isValidPageID(req.PageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+
+	result := ValidationResult{Errors: []string{}, Warnings: []string{}, Links: []LinkTarget{}}
+	source := []byte(req.Content)
+
+	parserContext := newMarkdownContext(req.PageID)
+	htmlContent, err := renderMarkdown(c.Request.Context(), markdownConverter(markdownOptionsFor(UploadRequest{})), source, parserContext)
+	switch {
+	case errors.Is(err, errRenderRejected):
+		result.Errors = append(result.Errors, err.Error())
+	case err != nil:
+		writePageError(c, err)
+		return
+	default:
+		fm, err := parseFrontMatter(gmmeta.Get(parserContext))
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		result.Title = fm.Title
+		if result.Title == "" {
+			result.Title = extractTitle(htmlContent)
+			if result.Title == defaultPageTitle {
+				result.Warnings = append(result.Warnings, "No title: add a level 1 heading or a front matter title")
+			}
+		}
+	}
+
+	result.Links, result.Warnings = checkLinks(source, req.PageID, result.Warnings)
+	result.Valid = len(result.Errors) == 0
+	respondJSON(c, http.StatusOK, result)
+}
+
+// checkLinks lists the link and image targets of the markdown source and
+// checks what can be checked locally: in-page fragments, the page's assets
+// and the allowed URL schemes. External URLs are not fetched.
+func checkLinks(source []byte, pageID string, warnings []string) ([]LinkTarget, []string) {
+	doc := outlineMarkdown.Parser().Parse(text.NewReader(source))
+	headingIDs := map[string]bool{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			if id, ok := heading.AttributeString("id"); ok {
+				if id, ok := id.([]byte); ok {
+					headingIDs[string(id)] = true
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	links := []LinkTarget{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var target LinkTarget
+		switch node := n.(type) {
+		case *ast.Link:
+			target = LinkTarget{Kind: "link", Target: string(node.Destination)}
+		case *ast.Image:
+			target = LinkTarget{Kind: "image", Target: string(node.Destination)}
+			if !node.HasChildren() {
+				warnings = append(warnings, "Image "+target.Target+" has no alt text")
+			}
+		case *ast.AutoLink:
+			target = LinkTarget{Kind: "link", Target: string(node.URL(source))}
+			if node.AutoLinkType == ast.AutoLinkEmail {
+				target.Target = "mailto:" + target.Target
+			}
+		default:
+			return ast.WalkContinue, nil
+		}
+		target.Status = linkTargetStatus(target.Target, pageID, headingIDs)
+		switch target.Status {
+		case linkStatusMissing:
+			warnings = append(warnings, "Broken "+target.Kind+": "+target.Target)
+		case linkStatusBlocked:
+			warnings = append(warnings, "The "+target.Kind+" "+target.Target+" uses a URL scheme that is not allowed and will be removed")
+		}
+		links = append(links, target)
+		return ast.WalkContinue, nil
+	})
+	return links, warnings
+}
+
+func linkTargetStatus(target, pageID string, headingIDs map[string]bool) string {
+	if !linkSchemeAllowed(target) {
+		return linkStatusBlocked
+	}
+	if linkScheme(target) != "" || strings.HasPrefix(target, "//") {
+		return linkStatusExternal
+	}
+	if fragment, ok := strings.CutPrefix(target, "#"); ok {
+		if headingIDs[fragment] {
+			return linkStatusOK
+		}
+		return linkStatusMissing
+	}
+
+	assetPath, _, _ := strings.Cut(target, "#")
+	assetPath, _, _ = strings.Cut(assetPath, "?")
+	name, ok := strings.CutPrefix(path.Clean(assetPath), assetsDirName+"/")
+	if !ok {
+		return linkStatusRelative
+	}
+	if pageID == "" {
+		return linkStatusUnchecked
+	}
+	if !isValidAssetName(name) {
+		return linkStatusMissing
+	}
+	if _, err := os.Stat(filepath.Join("public", pageID, assetsDirName, name)); err != nil {
+		return linkStatusMissing
+	}
+	return linkStatusOK
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionsDirName holds the previous versions of a page, one folder each with
+// its source, meta.json and additional files. Like source.txt it is never
+// served.
+const versionsDirName = "versions"
+
+// versionLayout names version folders after the time they were replaced, so
+// they sort chronologically.
+const versionLayout = "20060102T150405.000000000Z"
+
+var versionPattern = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}\.[0-9]{9}Z$`)
+
+var (
+	errNoVersion   = errors.New("version not found")
+	errKeepVersion = errors.New("could not keep the current version")
+)
+
+// PageVersion is a previous version of a page, as listed by
+// GET /api/pages/:id/versions.
+type PageVersion struct {
+	Version string `json:"version"`
+	// SavedAt is when the version was replaced, UpdatedAt when it was
+	// published.
+	SavedAt   time.Time `json:"savedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Type      string    `json:"type,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	SizeBytes int64     `json:"sizeBytes"`
+}
+
+// snapshotPage keeps the current version of a page before it is replaced. It
+// returns the new version, or "" when versioning is off or the page has no
+// source to keep. Assets are shared by all versions and not copied.
+func snapshotPage(pageID string) (string, error) {
+	folderPath := filepath.Join("public", pageID)
+	if getConfig().MaxVersions == 0 || !hasPageSource(folderPath) {
+		return "", nil
+	}
+	meta, err := readPageMeta(pageID)
+	if err != nil {
+		return "", err
+	}
+	version := time.Now().UTC().Format(versionLayout)
+	versionPath := filepath.Join(folderPath, versionsDirName, version)
+	if err := os.MkdirAll(versionPath, 0755); err != nil {
+		return "", err
+	}
+	names := []string{sourceFileName, compressedSourceFileName, metaFileName}
+	for _, name := range meta.Files {
+		names = append(names, filepath.Join(pageFilesDirName, name))
+	}
+	for _, name := range names {
+		if err := copyPageFile(folderPath, versionPath, name); err != nil {
+			os.RemoveAll(versionPath)
+			return "", err
+		}
+	}
+	return version, nil
+}
+
+// copyPageFile copies name, a path relative to the page folder, into the
+// version folder. Missing files are skipped.
+func copyPageFile(folderPath, versionPath, name string) error {
+	data, err := os.ReadFile(filepath.Join(folderPath, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(versionPath, name)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0644)
+}
+
+// discardVersion removes a version kept for a change that then failed.
+func discardVersion(pageID, version string) {
+	if version == "" {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join("public", pageID, versionsDirName, version)); err != nil {
+		log.Printf("Error removing version %s of page %s: %v", version, pageID, err)
+	}
+}
+
+// listVersions returns the versions kept for a page, oldest first.
+func listVersions(pageID string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join("public", pageID, versionsDirName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, entry := range entries {
+		if entry.IsDir() && versionPattern.MatchString(entry.Name()) {
+			versions = append(versions, entry.Name())
+		}
+	}
+	slices.Sort(versions)
+	return versions, nil
+}
+
+// pruneVersions removes the oldest versions of a page beyond maxVersions.
+func pruneVersions(pageID string, maxVersions int) {
+	versions, err := listVersions(pageID)
+	if err != nil {
+		log.Printf("Error listing versions of page %s: %v", pageID, err)
+		return
+	}
+	for len(versions) > maxVersions {
+		discardVersion(pageID, versions[0])
+		versions = versions[1:]
+	}
+}
+
+// readVersionMeta loads the meta.json kept with a version, which is empty for
+// pages published before metadata existed.
+func readVersionMeta(versionPath string) (PageMeta, error) {
+	var meta PageMeta
+	data, err := os.ReadFile(filepath.Join(versionPath, metaFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// versionRequest rebuilds the upload of a previous version, with the type,
+// theme and other choices it was published with.
+func versionRequest(pageID, version string) (UploadRequest, error) {
+	versionPath := filepath.Join("public", pageID, versionsDirName, version)
+	source, _, err := readSourceIn(versionPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return UploadRequest{}, errNoVersion
+	}
+	if err != nil {
+		return UploadRequest{}, fmt.Errorf("could not read source: %w", err)
+	}
+	meta, err := readVersionMeta(versionPath)
+	if err != nil {
+		return UploadRequest{}, fmt.Errorf("could not read metadata: %w", err)
+	}
+	if meta.Type == "" {
+		return UploadRequest{}, errNoType
+	}
+	files, err := readPageFiles(versionPath, meta.Files)
+	if err != nil {
+		return UploadRequest{}, fmt.Errorf("could not read file sources: %w", err)
+	}
+	return storedRequest(source, meta.Type, meta, files), nil
+}
+
+// handleListVersions lists the previous versions of a page, newest first.
+func handleListVersions(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	if info, err := os.Stat(filepath.Join("public", pageID)); err != nil || !info.IsDir() {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+	versions, err := listVersions(pageID)
+	if err != nil {
+		log.Printf("Error listing versions of page %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not list versions")
+		return
+	}
+	result := make([]PageVersion, 0, len(versions))
+	for _, version := range slices.Backward(versions) {
+		versionPath := filepath.Join("public", pageID, versionsDirName, version)
+		savedAt, _ := time.Parse(versionLayout, version)
+		item := PageVersion{Version: version, SavedAt: savedAt}
+		meta, err := readVersionMeta(versionPath)
+		if err != nil {
+			log.Printf("Error reading version %s of page %s: %v", version, pageID, err)
+		}
+		item.UpdatedAt, item.Type, item.Title = meta.UpdatedAt, meta.Type, meta.Title
+		if item.SizeBytes, err = folderSize(versionPath); err != nil {
+			log.Printf("Error computing size of version %s of page %s: %v", version, pageID, err)
+		}
+		result = append(result, item)
+	}
+	respondJSON(c, http.StatusOK, result)
+}
+
+// handleRestoreVersion publishes a previous version of a page again. The
+// version being replaced is kept like on any edit, so a restore can itself be
+// undone.
+func handleRestoreVersion(c *gin.Context) {
+	pageID := c.Param("id")
+	if !isValidPageID(pageID) {
+		respondError(c, http.StatusBadRequest, codeInvalidID, "Invalid page ID")
+		return
+	}
+	version := c.Param("version")
+	if !versionPattern.MatchString(version) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Version not found")
+		return
+	}
+	if info, err := os.Stat(filepath.Join("public", pageID)); err != nil || !info.IsDir() {
+		respondError(c, http.StatusNotFound, codeNotFound, "Page not found")
+		return
+	}
+	req, err := versionRequest(pageID, version)
+	switch {
+	case errors.Is(err, errNoVersion):
+		respondError(c, http.StatusNotFound, codeNotFound, "Version not found")
+		return
+	case errors.Is(err, errNoType):
+		respondError(c, http.StatusBadRequest, codeInvalidType, "The version has no metadata to take its type from")
+		return
+	case err != nil:
+		log.Printf("Error reading version %s of page %s: %v", version, pageID, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not read version")
+		return
+	}
+
+	if !editPage(c, pageID, req) {
+		return
+	}
+	recordAudit(c, auditActionRestore, pageID)
+	pageEvents.publish(eventPageUpdated, pageID)
+	respondJSON(c, http.StatusOK, pageURLs(c, pageID))
+}
+
+// editPage replaces a page with req through replacePage. It reports whether
+// the page was updated, having answered the request if not.
+func editPage(c *gin.Context, pageID string, req UploadRequest) bool {
+	err := replacePage(c.Request.Context(), pageID, req)
+	if errors.Is(err, errKeepVersion) {
+		log.Printf("Error keeping the current version of page %s: %v", pageID, err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Could not keep the current version")
+		return false
+	}
+	if err != nil {
+		writePageError(c, err)
+		return false
+	}
+	return true
+}
+
+// replacePage replaces a page with req, keeping the current version first and
+// dropping the oldest ones beyond PNG_MAX_VERSIONS once it succeeded.
+func replacePage(ctx context.Context, pageID string, req UploadRequest) error {
+	version, err := snapshotPage(pageID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errKeepVersion, err)
+	}
+	err = updatePageFile(ctx, pageID, req)
+	pageCache.remove(pageID)
+	if err != nil {
+		discardVersion(pageID, version)
+		return err
+	}
+	if version != "" {
+		pruneVersions(pageID, getConfig().MaxVersions)
+	}
+	return nil
+}
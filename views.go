@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// viewCounter counts page views in memory. Counts are written to
+// PNG_VIEWS_FILE every PNG_VIEWS_FLUSH_INTERVAL and when the server stops,
+// so a crash loses at most one interval.
+type viewCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	dirty  bool
+	// flushMu keeps two flushes from writing the file at the same time
+	flushMu sync.Mutex
+}
+
+var pageViews = &viewCounter{counts: make(map[string]int64)}
+
+func (v *viewCounter) increment(pageID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.counts[pageID]++
+	v.dirty = true
+}
+
+func (v *viewCounter) get(pageID string) int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.counts[pageID]
+}
+
+// remove forgets a deleted page's count.
+func (v *viewCounter) remove(pageID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.counts[pageID]; ok {
+		delete(v.counts, pageID)
+		v.dirty = true
+	}
+}
+
+// move carries a moved page's count over to its new ID.
+func (v *viewCounter) move(from, to string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if count, ok := v.counts[from]; ok {
+		delete(v.counts, from)
+		v.counts[to] += count
+		v.dirty = true
+	}
+}
+
+// load replaces the counts with the ones stored in path, if it exists.
+func (v *viewCounter) load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int64)
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.counts = counts
+	v.dirty = false
+	return nil
+}
+
+// flush writes the counts to path through a temporary file, so a crash
+// mid-write never leaves a truncated file. Nothing is written when no count
+// changed since the last flush.
+func (v *viewCounter) flush(path string) error {
+	v.flushMu.Lock()
+	defer v.flushMu.Unlock()
+
+	v.mu.Lock()
+	if !v.dirty {
+		v.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(v.counts)
+	v.dirty = false
+	v.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		// Try again on the next flush
+		v.mu.Lock()
+		v.dirty = true
+		v.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// startViewCounting loads the stored counts and flushes them periodically.
+// It does nothing when PNG_VIEW_COUNTS is off.
+func startViewCounting() {
+	cfg := getConfig()
+	if !cfg.ViewCounts {
+		return
+	}
+	if err := pageViews.load(cfg.ViewsFile); err != nil {
+		log.Printf("Warning: could not load view counts from %s: %v", cfg.ViewsFile, err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.ViewsFlushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			flushViews()
+		}
+	}()
+}
+
+// stopViewCounting saves the counts once the server has stopped.
+func stopViewCounting() {
+	if getConfig().ViewCounts {
+		flushViews()
+	}
+}
+
+func flushViews() {
+	path := getConfig().ViewsFile
+	if err := pageViews.flush(path); err != nil {
+		log.Printf("Error saving view counts to %s: %v", path, err)
+	}
+}
+
+// countViews counts successful GET requests for a page's index.html, whether
+// served from disk or from the page cache. Assets and preview images are not
+// counted.
+func countViews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if !getConfig().ViewCounts || c.Request.Method != http.MethodGet || c.Writer.Status() != http.StatusOK {
+			return
+		}
+		pageID, rest, _ := strings.Cut(strings.TrimPrefix(path.Clean("/"+c.Request.URL.Path), "/"), "/")
+		if (rest != "" && rest != "index.html") || !isValidPageID(pageID) {
+			return
+		}
+		// Other routes, such as /login, also answer 200
+		if info, err := os.Stat(filepath.Join("public", pageID)); err != nil || !info.IsDir() {
+			return
+		}
+		pageViews.increment(pageID)
+	}
+}
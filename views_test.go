@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestViewCounterConcurrentIncrements(t *testing.T) {
+	const workers, perWorker = 16, 500
+	path := filepath.Join(t.TempDir(), "views.json")
+	counter := &viewCounter{counts: map[string]int64{}}
+
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perWorker {
+				counter.increment("page")
+				if j%100 == 0 {
+					if err := counter.flush(path); err != nil {
+						t.Errorf("worker %d: flush: %v", i, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := counter.get("page"); got != workers*perWorker {
+		t.Fatalf("count = %d, want %d", got, workers*perWorker)
+	}
+	if err := counter.flush(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &viewCounter{counts: map[string]int64{}}
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.get("page"); got != workers*perWorker {
+		t.Fatalf("saved count = %d, want %d", got, workers*perWorker)
+	}
+}
+
+func TestViewCounterMoveAndRemove(t *testing.T) {
+	counter := &viewCounter{counts: map[string]int64{"a": 3, "b": 2}}
+	counter.move("a", "b")
+	if got := counter.get("b"); got != 5 {
+		t.Errorf("count of b after move = %d, want 5", got)
+	}
+	if got := counter.get("a"); got != 0 {
+		t.Errorf("count of a after move = %d, want 0", got)
+	}
+	counter.remove("b")
+	if got := counter.get("b"); got != 0 {
+		t.Errorf("count of b after remove = %d, want 0", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+// Visibilities of a page. Public pages are listed on the public index and to
+// anonymous API readers; unlisted pages are served like any other page but
+// only listed to logged-in users, for sharing by link; drafts are listed to
+// logged-in users only too, and marked as such in the dashboard.
+const (
+	visibilityPublic   = "public"
+	visibilityUnlisted = "unlisted"
+	visibilityDraft    = "draft"
+)
+
+// pageVisibility derives a page's visibility from its metadata.
+func pageVisibility(meta PageMeta) string {
+	switch {
+	case meta.Draft:
+		return visibilityDraft
+	case meta.Unlisted:
+		return visibilityUnlisted
+	}
+	return visibilityPublic
+}
+
+// applyVisibility sets the draft and unlisted flags from an upload's
+// visibility, which takes precedence over draft and the front matter.
+func applyVisibility(meta *PageMeta, visibility string) {
+	switch visibility {
+	case visibilityPublic:
+		meta.Draft, meta.Unlisted = false, false
+	case visibilityUnlisted:
+		meta.Draft, meta.Unlisted = false, true
+	case visibilityDraft:
+		meta.Draft, meta.Unlisted = true, false
+	default:
+		meta.Unlisted = false
+	}
+}